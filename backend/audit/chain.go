@@ -0,0 +1,231 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// chainLockKey - ключ advisory-блокировки, сериализующей добавление в цепочку
+const chainLockKey = 727100
+
+// Event - запись журнала для добавления в цепочку.
+// Before/After - JSON-текст или nil.
+type Event struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int
+	IP         string
+	UserAgent  string
+	Before     *string
+	After      *string
+}
+
+// Append добавляет событие в audit_events, связывая его хешем с предыдущей записью
+func Append(db *sql.DB, e Event) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := AppendTx(tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AppendTx добавляет событие в транзакции tx: изменение и запись о нем фиксируются вместе.
+// Блокировка цепочки держится до конца транзакции, поэтому событие стоит добавлять
+// непосредственно перед фиксацией.
+func AppendTx(tx *sql.Tx, e Event) error {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", chainLockKey); err != nil {
+		return err
+	}
+
+	// JSONB хранит JSON в нормализованном виде, поэтому хешируем именно его
+	var before, after sql.NullString
+	err := tx.QueryRow("SELECT $1::jsonb::text, $2::jsonb::text", e.Before, e.After).Scan(&before, &after)
+	if err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRow("SELECT hash FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	var id int64
+	if err := tx.QueryRow("SELECT nextval('audit_events_id_seq')").Scan(&id); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	row := chainRow{
+		ID:         id,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		Before:     before,
+		After:      after,
+		CreatedAt:  createdAt,
+		PrevHash:   prevHash,
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO audit_events (id, actor_id, action, target_type, target_id, ip, user_agent, before, after, created_at, prev_hash, hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		id, e.ActorID, e.Action, e.TargetType, e.TargetID, e.IP, e.UserAgent, before, after, createdAt, prevHash, row.computeHash())
+	return err
+}
+
+// chainRow - поля записи, участвующие в хеше
+type chainRow struct {
+	ID         int64
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int
+	IP         string
+	UserAgent  string
+	Before     sql.NullString
+	After      sql.NullString
+	CreatedAt  time.Time
+	PrevHash   string
+	Hash       sql.NullString
+}
+
+// computeHash вычисляет SHA-256 от предыдущего хеша и канонического представления записи
+func (c chainRow) computeHash() string {
+	fields := []string{
+		c.PrevHash,
+		strconv.FormatInt(c.ID, 10),
+		optionalInt(c.ActorID),
+		c.Action,
+		c.TargetType,
+		optionalInt(c.TargetID),
+		c.IP,
+		c.UserAgent,
+		optionalString(c.Before),
+		optionalString(c.After),
+		c.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	h := sha256.New()
+	for _, f := range fields {
+		// Длина перед значением исключает неоднозначность склейки полей
+		fmt.Fprintf(h, "%d:%s\n", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func optionalInt(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func optionalString(v sql.NullString) string {
+	if !v.Valid {
+		return "-"
+	}
+	return "+" + v.String
+}
+
+// ChainLegacy включает в цепочку записи, созданные до ее появления
+func ChainLegacy(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", chainLockKey); err != nil {
+		return err
+	}
+
+	var pending int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM audit_events WHERE hash IS NULL").Scan(&pending); err != nil {
+		return err
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	var hashed int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM audit_events WHERE hash IS NOT NULL").Scan(&hashed); err != nil {
+		return err
+	}
+	if hashed > 0 {
+		return fmt.Errorf("audit chain: %d unhashed events found after chain start", pending)
+	}
+
+	rows, err := queryChainRows(tx)
+	if err != nil {
+		return err
+	}
+	var chain []chainRow
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		chain = append(chain, row)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("ALTER TABLE audit_events DISABLE TRIGGER audit_events_no_modify"); err != nil {
+		return err
+	}
+	prevHash := ""
+	for _, row := range chain {
+		row.CreatedAt = row.CreatedAt.Truncate(time.Microsecond)
+		row.PrevHash = prevHash
+		hash := row.computeHash()
+		if _, err := tx.Exec("UPDATE audit_events SET prev_hash = $1, hash = $2 WHERE id = $3", prevHash, hash, row.ID); err != nil {
+			return err
+		}
+		prevHash = hash
+	}
+	if _, err := tx.Exec("ALTER TABLE audit_events ENABLE TRIGGER audit_events_no_modify"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryChainRows(q queryer) (*sql.Rows, error) {
+	return q.Query(`
+	SELECT id, actor_id, action, target_type, target_id, ip, user_agent,
+		before::text, after::text, created_at, COALESCE(prev_hash, ''), hash
+	FROM audit_events ORDER BY id`)
+}
+
+func scanChainRow(rows *sql.Rows) (chainRow, error) {
+	var row chainRow
+	err := rows.Scan(&row.ID, &row.ActorID, &row.Action, &row.TargetType, &row.TargetID, &row.IP, &row.UserAgent,
+		&row.Before, &row.After, &row.CreatedAt, &row.PrevHash, &row.Hash)
+	return row, err
+}
+
+// shortHash используется в сообщениях о нарушениях
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestComputeHashDetectsChanges(t *testing.T) {
+	actor := 7
+	row := chainRow{
+		ID:         1,
+		ActorID:    &actor,
+		Action:     "document.update",
+		TargetType: "document",
+		IP:         "10.0.0.1",
+		Before:     sql.NullString{String: `{"title": "a"}`, Valid: true},
+		After:      sql.NullString{String: `{"title": "b"}`, Valid: true},
+		CreatedAt:  time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+	}
+	original := row.computeHash()
+
+	if again := row.computeHash(); again != original {
+		t.Fatalf("hash is not deterministic: %s != %s", again, original)
+	}
+
+	tampered := row
+	tampered.After = sql.NullString{String: `{"title": "c"}`, Valid: true}
+	if tampered.computeHash() == original {
+		t.Error("changing after must change the hash")
+	}
+
+	relinked := row
+	relinked.PrevHash = "deadbeef"
+	if relinked.computeHash() == original {
+		t.Error("changing prev_hash must change the hash")
+	}
+
+	// Пустая строка и NULL должны давать разные хеши
+	nulled := row
+	nulled.Before = sql.NullString{}
+	empty := row
+	empty.Before = sql.NullString{Valid: true}
+	if nulled.computeHash() == empty.computeHash() {
+		t.Error("NULL and empty before must hash differently")
+	}
+}
+
+func TestCheckpointSignature(t *testing.T) {
+	t.Setenv("AUDIT_SIGNING_KEY", "")
+	t.Setenv("DEV_MODE", "")
+	if _, err := NewSignerFromEnv(); err == nil {
+		t.Fatal("development key must require DEV_MODE")
+	}
+	t.Setenv("DEV_MODE", "1")
+	signer, err := NewSignerFromEnv()
+	if err != nil {
+		t.Fatalf("NewSignerFromEnv: %v", err)
+	}
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	signature := signer.sign(checkpointMessage(42, "abc", createdAt))
+
+	if !signer.verify(checkpointMessage(42, "abc", createdAt), signature) {
+		t.Error("valid signature rejected")
+	}
+	if signer.verify(checkpointMessage(41, "abc", createdAt), signature) {
+		t.Error("signature accepted for another event")
+	}
+	if signer.verify(checkpointMessage(42, "abd", createdAt), signature) {
+		t.Error("signature accepted for another hash")
+	}
+}
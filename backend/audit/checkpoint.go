@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Signer подписывает контрольные точки цепочки ключом Ed25519.
+// Публичный ключ можно передать регулятору для независимой проверки.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSignerFromEnv создает подписчика из AUDIT_SIGNING_KEY (base64, seed 32 байта).
+// Ключ разработки из открытой строки используется только при DEV_MODE=1: им может подписать любой.
+func NewSignerFromEnv() (*Signer, error) {
+	encoded := os.Getenv("AUDIT_SIGNING_KEY")
+	if encoded == "" {
+		if os.Getenv("DEV_MODE") != "1" {
+			return nil, fmt.Errorf("AUDIT_SIGNING_KEY is not set (DEV_MODE=1 allows the development key)")
+		}
+		seed := sha256.Sum256([]byte("dev_audit_key_change_me"))
+		return &Signer{key: ed25519.NewKeyFromSeed(seed[:])}, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("AUDIT_SIGNING_KEY: expected %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return &Signer{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey возвращает публичный ключ в base64
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+func (s *Signer) sign(msg []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, msg))
+}
+
+func (s *Signer) verify(msg []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(s.key.Public().(ed25519.PublicKey), msg, sig)
+}
+
+// checkpointMessage - подписываемое содержимое контрольной точки
+func checkpointMessage(lastEventID int64, lastHash string, createdAt time.Time) []byte {
+	return []byte(fmt.Sprintf("docflow-audit-checkpoint:%d:%s:%s",
+		lastEventID, lastHash, createdAt.UTC().Format(time.RFC3339Nano)))
+}
+
+// CreateCheckpoint подписывает текущую вершину цепочки.
+// Если с прошлой контрольной точки событий не было, ничего не делает.
+func CreateCheckpoint(db *sql.DB, signer *Signer) error {
+	var (
+		lastID   int64
+		lastHash string
+	)
+	err := db.QueryRow("SELECT id, hash FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&lastID, &lastHash)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM audit_checkpoints WHERE last_event_id = $1)", lastID).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	signature := signer.sign(checkpointMessage(lastID, lastHash, createdAt))
+	_, err = db.Exec(`
+	INSERT INTO audit_checkpoints (last_event_id, last_hash, signature, created_at)
+	VALUES ($1, $2, $3, $4)`, lastID, lastHash, signature, createdAt)
+	return err
+}
+
+// RunCheckpoints периодически создает контрольные точки до закрытия stop
+func RunCheckpoints(db *sql.DB, signer *Signer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := CreateCheckpoint(db, signer); err != nil {
+				log.Printf("audit: failed to create checkpoint: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Problem описывает найденное нарушение целостности
+type Problem struct {
+	EventID      *int64 `json:"event_id,omitempty"`
+	CheckpointID *int64 `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// VerifyResult - итог проверки журнала
+type VerifyResult struct {
+	Valid              bool      `json:"valid"`
+	EventsChecked      int       `json:"events_checked"`
+	CheckpointsChecked int       `json:"checkpoints_checked"`
+	LastEventID        int64     `json:"last_event_id"`
+	LastHash           string    `json:"last_hash"`
+	PublicKey          string    `json:"public_key"`
+	Problems           []Problem `json:"problems"`
+}
+
+// Verify пересчитывает цепочку хешей и сверяет ее с подписанными контрольными точками.
+// Обнаруживает измененные, удаленные и вставленные в обход приложения записи.
+func Verify(db *sql.DB, signer *Signer) (VerifyResult, error) {
+	result := VerifyResult{PublicKey: signer.PublicKey(), Problems: []Problem{}}
+	addProblem := func(eventID *int64, checkpointID *int64, format string, args ...any) {
+		result.Problems = append(result.Problems, Problem{EventID: eventID, CheckpointID: checkpointID, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	rows, err := queryChainRows(db)
+	if err != nil {
+		return result, err
+	}
+	hashes := make(map[int64]string)
+	prevHash := ""
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			rows.Close()
+			return result, err
+		}
+		id := row.ID
+		result.EventsChecked++
+
+		if !row.Hash.Valid {
+			addProblem(&id, nil, "event has no hash")
+			continue
+		}
+		if row.PrevHash != prevHash {
+			addProblem(&id, nil, "previous hash mismatch: expected %s, stored %s (preceding event altered or deleted)",
+				shortHash(prevHash), shortHash(row.PrevHash))
+		}
+		if computed := row.computeHash(); computed != row.Hash.String {
+			addProblem(&id, nil, "content hash mismatch: event was modified")
+		}
+		hashes[id] = row.Hash.String
+		prevHash = row.Hash.String
+		result.LastEventID = id
+		result.LastHash = row.Hash.String
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return result, err
+	}
+	rows.Close()
+
+	cpRows, err := db.Query("SELECT id, last_event_id, last_hash, signature, created_at FROM audit_checkpoints ORDER BY id")
+	if err != nil {
+		return result, err
+	}
+	defer cpRows.Close()
+	for cpRows.Next() {
+		var (
+			cpID, lastID        int64
+			lastHash, signature string
+			createdAt           time.Time
+		)
+		if err := cpRows.Scan(&cpID, &lastID, &lastHash, &signature, &createdAt); err != nil {
+			return result, err
+		}
+		result.CheckpointsChecked++
+
+		if !signer.verify(checkpointMessage(lastID, lastHash, createdAt), signature) {
+			addProblem(nil, &cpID, "invalid checkpoint signature")
+			continue
+		}
+		stored, ok := hashes[lastID]
+		if !ok {
+			addProblem(&lastID, &cpID, "event covered by checkpoint is missing (deleted)")
+		} else if stored != lastHash {
+			addProblem(&lastID, &cpID, "event hash differs from signed checkpoint (chain rewritten)")
+		}
+	}
+	if err := cpRows.Err(); err != nil {
+		return result, err
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result, nil
+}
@@ -107,6 +107,639 @@ func CreateTables(db *sql.DB) error {
 			END IF;
 		END$$;`)
 
+	// Роли пользователей: администраторы и рецензенты задаются через ADMIN_LOGINS и REVIEWER_LOGINS
+	// или назначаются администратором (PUT /users/{id}/role)
+	_, _ = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user'`)
+	if reviewers := getEnv("REVIEWER_LOGINS", ""); reviewers != "" {
+		_, err = db.Exec(`UPDATE users SET role = 'reviewer' WHERE login = ANY(string_to_array($1, ',')) AND role = 'user'`, reviewers)
+		if err != nil {
+			return err
+		}
+	}
+	if admins := getEnv("ADMIN_LOGINS", ""); admins != "" {
+		_, err = db.Exec(`UPDATE users SET role = 'admin' WHERE login = ANY(string_to_array($1, ','))`, admins)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Создаем таблицу audit_events (журнал аудита, только добавление)
+	auditQuery := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id BIGSERIAL PRIMARY KEY,
+		actor_id INTEGER,
+		action VARCHAR(64) NOT NULL,
+		target_type VARCHAR(64) NOT NULL DEFAULT '',
+		target_id INTEGER,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		before JSONB,
+		after JSONB,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(auditQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at)`)
+
+	// Запрещаем изменение и удаление записей аудита
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+		END;
+		$$ LANGUAGE plpgsql`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_trigger WHERE tgname = 'audit_events_no_modify'
+			) THEN
+				CREATE TRIGGER audit_events_no_modify
+				BEFORE UPDATE OR DELETE ON audit_events
+				FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+			END IF;
+		END$$;`)
+
+	// Цепочка хешей: каждая запись хранит хеш предыдущей
+	_, _ = db.Exec(`ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64)`)
+	_, _ = db.Exec(`ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash VARCHAR(64)`)
+
+	// Создаем таблицу audit_checkpoints (подписанные вершины цепочки)
+	checkpointsQuery := `
+	CREATE TABLE IF NOT EXISTS audit_checkpoints (
+		id BIGSERIAL PRIMARY KEY,
+		last_event_id BIGINT NOT NULL,
+		last_hash VARCHAR(64) NOT NULL,
+		signature TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`
+
+	_, err = db.Exec(checkpointsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_trigger WHERE tgname = 'audit_checkpoints_no_modify'
+			) THEN
+				CREATE TRIGGER audit_checkpoints_no_modify
+				BEFORE UPDATE OR DELETE ON audit_checkpoints
+				FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+			END IF;
+		END$$;`)
+
+	// Создаем таблицу webhooks (исходящие подписки на события)
+	webhooksQuery := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id SERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		events TEXT[] NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(webhooksQuery)
+	if err != nil {
+		return err
+	}
+
+	// Создаем таблицу webhook_deliveries (очередь и журнал доставок)
+	deliveriesQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event VARCHAR(64) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	)`
+
+	_, err = db.Exec(deliveriesQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`)
+
+	// Создаем таблицу event_outbox (события, записанные в транзакции изменения)
+	outboxQuery := `
+	CREATE TABLE IF NOT EXISTS event_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		event_type VARCHAR(64) NOT NULL,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP,
+		processed_at TIMESTAMP,
+		done_subscribers TEXT[] NOT NULL DEFAULT '{}',
+		last_error TEXT
+	)`
+
+	_, err = db.Exec(outboxQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS event_outbox_pending_idx ON event_outbox (next_attempt_at) WHERE processed_at IS NULL`)
+
+	// Доставки вебхуков ссылаются на событие, чтобы повторная обработка не плодила дубликаты
+	_, _ = db.Exec(`ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS event_id BIGINT`)
+	_, _ = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_event_idx ON webhook_deliveries (webhook_id, event_id) WHERE event_id IS NOT NULL`)
+
+	// Жизненный цикл документа: статус и настраиваемые переходы
+	_, _ = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'draft'`)
+
+	// Создаем таблицу workflow_transitions (category_id NULL - схема по умолчанию)
+	transitionsQuery := `
+	CREATE TABLE IF NOT EXISTS workflow_transitions (
+		id SERIAL PRIMARY KEY,
+		category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+		name VARCHAR(64) NOT NULL,
+		from_status VARCHAR(32) NOT NULL,
+		to_status VARCHAR(32) NOT NULL,
+		allowed_roles TEXT[] NOT NULL DEFAULT '{}',
+		allow_author BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+
+	_, err = db.Exec(transitionsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS workflow_transitions_unique_idx ON workflow_transitions (COALESCE(category_id, 0), name, from_status)`)
+
+	// Схема по умолчанию: draft -> review -> approved -> published -> archived
+	_, err = db.Exec(`
+		INSERT INTO workflow_transitions (category_id, name, from_status, to_status, allowed_roles, allow_author)
+		SELECT NULL, t.name, t.from_status, t.to_status, t.allowed_roles, t.allow_author
+		FROM (VALUES
+			('submit', 'draft', 'review', ARRAY['admin'], TRUE),
+			('reject', 'review', 'draft', ARRAY['admin', 'reviewer'], FALSE),
+			('approve', 'review', 'approved', ARRAY['admin', 'reviewer'], FALSE),
+			('publish', 'approved', 'published', ARRAY['admin'], TRUE),
+			('archive', 'published', 'archived', ARRAY['admin'], FALSE)
+		) AS t(name, from_status, to_status, allowed_roles, allow_author)
+		WHERE NOT EXISTS (SELECT 1 FROM workflow_transitions WHERE category_id IS NULL)`)
+	if err != nil {
+		return err
+	}
+
+	// Создаем таблицы групп пользователей
+	groupsQuery := `
+	CREATE TABLE IF NOT EXISTS user_groups (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(groupsQuery)
+	if err != nil {
+		return err
+	}
+
+	groupMembersQuery := `
+	CREATE TABLE IF NOT EXISTS user_group_members (
+		group_id INTEGER NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		PRIMARY KEY (group_id, user_id)
+	)`
+
+	_, err = db.Exec(groupMembersQuery)
+	if err != nil {
+		return err
+	}
+
+	// Создаем таблицы маршрутов согласования
+	approvalRoutesQuery := `
+	CREATE TABLE IF NOT EXISTS approval_routes (
+		id SERIAL PRIMARY KEY,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		mode VARCHAR(16) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP
+	)`
+
+	_, err = db.Exec(approvalRoutesQuery)
+	if err != nil {
+		return err
+	}
+
+	approvalStepsQuery := `
+	CREATE TABLE IF NOT EXISTS approval_steps (
+		id SERIAL PRIMARY KEY,
+		route_id INTEGER NOT NULL REFERENCES approval_routes(id) ON DELETE CASCADE,
+		stage INTEGER NOT NULL,
+		approver_user_id INTEGER REFERENCES users(id),
+		approver_group_id INTEGER REFERENCES user_groups(id),
+		required BOOLEAN NOT NULL DEFAULT TRUE,
+		deadline TIMESTAMP,
+		status VARCHAR(16) NOT NULL,
+		decided_by INTEGER REFERENCES users(id),
+		decided_at TIMESTAMP,
+		comment TEXT,
+		delegated_from INTEGER REFERENCES approval_steps(id),
+		CHECK ((approver_user_id IS NULL) <> (approver_group_id IS NULL))
+	)`
+
+	_, err = db.Exec(approvalStepsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS approval_routes_document_idx ON approval_routes (document_id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS approval_steps_route_idx ON approval_steps (route_id, stage)`)
+
+	// Создаем таблицу tasks (поручения по документам)
+	tasksQuery := `
+	CREATE TABLE IF NOT EXISTS tasks (
+		id SERIAL PRIMARY KEY,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+		title VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		assignee_id INTEGER NOT NULL REFERENCES users(id),
+		author_id INTEGER NOT NULL REFERENCES users(id),
+		due_at TIMESTAMP,
+		priority VARCHAR(16) NOT NULL DEFAULT 'normal',
+		status VARCHAR(16) NOT NULL DEFAULT 'open',
+		overdue BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP
+	)`
+
+	_, err = db.Exec(tasksQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS tasks_assignee_idx ON tasks (assignee_id, status)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS tasks_document_idx ON tasks (document_id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS tasks_due_idx ON tasks (due_at) WHERE NOT overdue AND status IN ('open', 'in_progress')`)
+
+	// Регистрационная нумерация: последовательности, счетчики и журнал выданных номеров
+	numberingQuery := `
+	CREATE TABLE IF NOT EXISTS numbering_sequences (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		prefix VARCHAR(32) NOT NULL DEFAULT '',
+		format VARCHAR(128) NOT NULL DEFAULT '{prefix}-{year}/{n}',
+		padding INTEGER NOT NULL DEFAULT 6,
+		year_reset BOOLEAN NOT NULL DEFAULT TRUE,
+		per_category BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS numbering_counters (
+		sequence_id INTEGER NOT NULL REFERENCES numbering_sequences(id) ON DELETE CASCADE,
+		year INTEGER NOT NULL,
+		category_id INTEGER NOT NULL,
+		value BIGINT NOT NULL,
+		PRIMARY KEY (sequence_id, year, category_id)
+	);
+	CREATE TABLE IF NOT EXISTS document_registrations (
+		number VARCHAR(64) PRIMARY KEY,
+		sequence_id INTEGER NOT NULL REFERENCES numbering_sequences(id),
+		document_id INTEGER REFERENCES documents(id) ON DELETE SET NULL,
+		document_title VARCHAR(255) NOT NULL,
+		category_id INTEGER,
+		registered_by INTEGER REFERENCES users(id),
+		registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(numberingQuery)
+	if err != nil {
+		return err
+	}
+
+	// Номер хранится в документе; журнал гарантирует, что он не выдается повторно
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS registration_number VARCHAR(64) UNIQUE`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS registered_at TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+
+	// Блокировка документа на редактирование (check-out) и версии, создаваемые при check-in
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS locked_by INTEGER REFERENCES users(id) ON DELETE SET NULL`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS locked_at TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS lock_expires_at TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+
+	versionsQuery := `
+	CREATE TABLE IF NOT EXISTS document_versions (
+		id SERIAL PRIMARY KEY,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		version INTEGER NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		content TEXT,
+		category_id INTEGER,
+		file_path VARCHAR(255),
+		comment TEXT NOT NULL DEFAULT '',
+		created_by INTEGER REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (document_id, version)
+	)`
+
+	_, err = db.Exec(versionsQuery)
+	if err != nil {
+		return err
+	}
+
+	// Версия строки для ETag: увеличивается триггером при каждом изменении
+	_, err = db.Exec(`
+	CREATE OR REPLACE FUNCTION bump_row_version() RETURNS trigger AS $$
+	BEGIN
+		NEW.row_version := OLD.row_version + 1;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"documents", "categories"} {
+		_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS row_version BIGINT NOT NULL DEFAULT 1`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+		DROP TRIGGER IF EXISTS ` + table + `_row_version ON ` + table + `;
+		CREATE TRIGGER ` + table + `_row_version BEFORE UPDATE ON ` + table + `
+		FOR EACH ROW EXECUTE FUNCTION bump_row_version()`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Комментарии к документам: ветки обсуждений и упоминания пользователей
+	commentsQuery := `
+	CREATE TABLE IF NOT EXISTS comments (
+		id SERIAL PRIMARY KEY,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+		author_id INTEGER NOT NULL REFERENCES users(id),
+		body TEXT NOT NULL,
+		resolved BOOLEAN NOT NULL DEFAULT FALSE,
+		resolved_by INTEGER REFERENCES users(id),
+		resolved_at TIMESTAMP,
+		edited_at TIMESTAMP,
+		deleted_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS comment_mentions (
+		comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		PRIMARY KEY (comment_id, user_id)
+	)`
+
+	_, err = db.Exec(commentsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS comments_document_idx ON comments (document_id, created_at)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS comment_mentions_user_idx ON comment_mentions (user_id)`)
+
+	// Теги документов (многие ко многим), названия уникальны без учета регистра
+	tagsQuery := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(64) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS tags_name_idx ON tags (lower(name));
+	CREATE TABLE IF NOT EXISTS document_tags (
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (document_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS document_tags_tag_idx ON document_tags (tag_id)`
+
+	_, err = db.Exec(tagsQuery)
+	if err != nil {
+		return err
+	}
+
+	// Пользовательские поля метаданных: схема на категорию и значения в документе
+	fieldsQuery := `
+	CREATE TABLE IF NOT EXISTS category_fields (
+		id SERIAL PRIMARY KEY,
+		category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+		name VARCHAR(63) NOT NULL,
+		label VARCHAR(255) NOT NULL DEFAULT '',
+		type VARCHAR(16) NOT NULL,
+		required BOOLEAN NOT NULL DEFAULT FALSE,
+		options TEXT[] NOT NULL DEFAULT '{}',
+		position INTEGER NOT NULL DEFAULT 0,
+		UNIQUE (category_id, name)
+	)`
+
+	_, err = db.Exec(fieldsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE document_versions ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS documents_metadata_idx ON documents USING GIN (metadata)`)
+
+	// Шаблоны документов с подстановками
+	templatesQuery := `
+	CREATE TABLE IF NOT EXISTS templates (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		title VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+		metadata JSONB NOT NULL DEFAULT '{}',
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(templatesQuery)
+	if err != nil {
+		return err
+	}
+
+	// Превью загруженных файлов: миниатюры изображений и первая страница текста
+	previewsQuery := `
+	CREATE TABLE IF NOT EXISTS document_previews (
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		size VARCHAR(16) NOT NULL,
+		content_type VARCHAR(100) NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		path VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (document_id, size)
+	)`
+
+	_, err = db.Exec(previewsQuery)
+	if err != nil {
+		return err
+	}
+
+	// Файлы превью шифруются отдельными ключами данных, как архивы выгрузок
+	_, _ = db.Exec(`ALTER TABLE document_previews ADD COLUMN IF NOT EXISTS key_id VARCHAR(100)`)
+	_, _ = db.Exec(`ALTER TABLE document_previews ADD COLUMN IF NOT EXISTS wrapped_key BYTEA`)
+
+	// Хранилище файлов по SHA-256 со счетчиком ссылок документов
+	blobsQuery := `
+	CREATE TABLE IF NOT EXISTS blobs (
+		hash CHAR(64) PRIMARY KEY,
+		size BIGINT NOT NULL,
+		ref_count INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	_, err = db.Exec(blobsQuery)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_name VARCHAR(255)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_hash CHAR(64) REFERENCES blobs(hash)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_size BIGINT`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS documents_file_hash_idx ON documents (file_hash)`)
+
+	// Тип файла, определенный по содержимому, и ограничение размера файлов категории
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_type VARCHAR(100)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE categories ADD COLUMN IF NOT EXISTS max_file_size BIGINT`)
+	if err != nil {
+		return err
+	}
+
+	// Ключ данных файла, зашифрованный главным ключом key_id; NULL - файл еще не зашифрован
+	_, err = db.Exec(`ALTER TABLE blobs ADD COLUMN IF NOT EXISTS key_id VARCHAR(100)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE blobs ADD COLUMN IF NOT EXISTS wrapped_key BYTEA`)
+	if err != nil {
+		return err
+	}
+
+	// Публичные ссылки на файлы документов; хранится только хэш токена
+	shareLinksQuery := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id SERIAL PRIMARY KEY,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		mode VARCHAR(20) NOT NULL,
+		password_hash VARCHAR(255),
+		expires_at TIMESTAMP NOT NULL,
+		max_downloads INTEGER,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		failed_attempts INTEGER NOT NULL DEFAULT 0,
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP,
+		last_accessed_at TIMESTAMP
+	)`
+
+	_, err = db.Exec(shareLinksQuery)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS share_links_document_idx ON share_links (document_id)`)
+
+	// Антивирусная проверка: файлы, загруженные раньше, проверяются в фоне
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE documents ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE documents SET scan_status = 'pending' WHERE file_path IS NOT NULL AND scan_status IS NULL`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS documents_scan_pending_idx ON documents (scanned_at) WHERE scan_status = 'pending'`)
+
+	// Фоновые выгрузки документов; архив зашифрован ключом данных, как файлы хранилища
+	exportJobsQuery := `
+	CREATE TABLE IF NOT EXISTS export_jobs (
+		id SERIAL PRIMARY KEY,
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		filter JSONB NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		lease_until TIMESTAMP,
+		document_count INTEGER NOT NULL DEFAULT 0,
+		size BIGINT,
+		file_path VARCHAR(500),
+		key_id VARCHAR(100),
+		wrapped_key BYTEA,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP,
+		expires_at TIMESTAMP
+	)`
+
+	_, err = db.Exec(exportJobsQuery)
+	if err != nil {
+		return err
+	}
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS export_jobs_created_by_idx ON export_jobs (created_by, id)`)
+	_, _ = db.Exec(`CREATE INDEX IF NOT EXISTS export_jobs_active_idx ON export_jobs (id) WHERE status IN ('pending', 'running')`)
+
 	log.Println("Tables created successfully")
 	return nil
 }
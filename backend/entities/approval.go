@@ -0,0 +1,72 @@
+package entities
+
+import "time"
+
+// Режимы маршрута согласования
+const (
+	ApprovalSequential = "sequential"
+	ApprovalParallel   = "parallel"
+)
+
+// Статусы маршрута согласования
+const (
+	RouteInProgress = "in_progress"
+	RouteApproved   = "approved"
+	RouteRejected   = "rejected"
+	RouteCancelled  = "cancelled"
+)
+
+// Статусы шага согласования
+const (
+	StepWaiting   = "waiting"
+	StepPending   = "pending"
+	StepApproved  = "approved"
+	StepRejected  = "rejected"
+	StepDelegated = "delegated"
+	StepSkipped   = "skipped"
+)
+
+type ApprovalRoute struct {
+	ID          int            `json:"id"`
+	DocumentID  int            `json:"document_id"`
+	Mode        string         `json:"mode"`
+	Status      string         `json:"status"`
+	CreatedBy   int            `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at"`
+	Steps       []ApprovalStep `json:"steps"`
+}
+
+type ApprovalStep struct {
+	ID              int        `json:"id"`
+	RouteID         int        `json:"route_id"`
+	Stage           int        `json:"stage"`
+	ApproverUserID  *int       `json:"approver_user_id"`
+	ApproverGroupID *int       `json:"approver_group_id"`
+	Required        bool       `json:"required"`
+	Deadline        *time.Time `json:"deadline"`
+	Overdue         bool       `json:"overdue"`
+	Status          string     `json:"status"`
+	DecidedBy       *int       `json:"decided_by"`
+	DecidedAt       *time.Time `json:"decided_at"`
+	Comment         string     `json:"comment"`
+	DelegatedFrom   *int       `json:"delegated_from"`
+}
+
+type CreateApprovalRouteRequest struct {
+	Mode  string                `json:"mode"`
+	Steps []ApprovalStepRequest `json:"steps"`
+}
+
+type ApprovalStepRequest struct {
+	UserID   *int       `json:"user_id"`
+	GroupID  *int       `json:"group_id"`
+	Required *bool      `json:"required"`
+	Deadline *time.Time `json:"deadline"`
+}
+
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment"`
+	// UserID - кому делегируется шаг (только для delegate)
+	UserID int `json:"user_id"`
+}
@@ -3,9 +3,12 @@ package entities
 import "time"
 
 type Category struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// MaxFileSize - ограничение размера файлов документов категории (null - глобальное)
+	MaxFileSize *int64    `json:"max_file_size"`
+	RowVersion  int64     `json:"row_version"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -19,3 +22,7 @@ type UpdateCategoryRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 }
+
+type UpdateCategoryLimitsRequest struct {
+	MaxFileSize *int64 `json:"max_file_size"`
+}
@@ -0,0 +1,59 @@
+package entities
+
+import "time"
+
+type Comment struct {
+	ID         int        `json:"id"`
+	DocumentID int        `json:"document_id"`
+	ParentID   *int       `json:"parent_id"`
+	AuthorID   int        `json:"author_id"`
+	Body       string     `json:"body"`
+	Mentions   []int64    `json:"mentions"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy *int       `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	EditedAt   *time.Time `json:"edited_at"`
+	Deleted    bool       `json:"deleted"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Replies    []Comment  `json:"replies,omitempty"`
+}
+
+type CreateCommentRequest struct {
+	ParentID *int   `json:"parent_id"`
+	Body     string `json:"body"`
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type ResolveCommentRequest struct {
+	Resolved bool `json:"resolved"`
+}
+
+// CommentMention - событие упоминания пользователя в комментарии
+type CommentMention struct {
+	UserID  int     `json:"user_id"`
+	Comment Comment `json:"comment"`
+}
+
+// CommentDeletion - событие удаления комментария, только идентификаторы
+type CommentDeletion struct {
+	ID         int `json:"id"`
+	DocumentID int `json:"document_id"`
+}
+
+// Виды записей ленты активности документа
+const (
+	ActivityEvent   = "event"
+	ActivityComment = "comment"
+)
+
+// ActivityItem - запись ленты активности: действие из журнала аудита или комментарий
+type ActivityItem struct {
+	Kind    string    `json:"kind"`
+	At      time.Time `json:"at"`
+	ActorID *int      `json:"actor_id"`
+	Action  string    `json:"action,omitempty"`
+	Comment *Comment  `json:"comment,omitempty"`
+}
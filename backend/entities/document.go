@@ -2,25 +2,77 @@ package entities
 
 import "time"
 
+// Статусы жизненного цикла документа
+const (
+	StatusDraft     = "draft"
+	StatusReview    = "review"
+	StatusApproved  = "approved"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// Состояния антивирусной проверки файла документа
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// DocumentStatuses - допустимые статусы документа
+var DocumentStatuses = []string{StatusDraft, StatusReview, StatusApproved, StatusPublished, StatusArchived}
+
 type Document struct {
-	ID         int       `json:"id"`
-	Title      string    `json:"title"`
-	Content    string    `json:"content"`
-	FilePath   string    `json:"file_path"`
-	CategoryID *int      `json:"category_id"`
-	UserID     int       `json:"user_id"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID                 int        `json:"id"`
+	Title              string     `json:"title"`
+	Content            string     `json:"content"`
+	FilePath           string     `json:"file_path"`
+	FileName           string     `json:"file_name"`
+	FileHash           string     `json:"file_hash"`
+	FileSize           int64      `json:"file_size"`
+	FileType           string     `json:"file_type"`
+	ScanStatus         string     `json:"scan_status,omitempty"`
+	CategoryID         *int       `json:"category_id"`
+	UserID             int        `json:"user_id"`
+	Status             string     `json:"status"`
+	RegistrationNumber *string    `json:"registration_number"`
+	RegisteredAt       *time.Time `json:"registered_at"`
+	LockedBy           *int       `json:"locked_by"`
+	LockExpiresAt      *time.Time `json:"lock_expires_at"`
+	RowVersion         int64      `json:"row_version"`
+	Tags               []string   `json:"tags"`
+	Metadata           Metadata   `json:"metadata"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// CreatedDocument - ответ на создание документа. Если такой же файл уже загружен,
+// в Duplicates перечислены документы с ним.
+type CreatedDocument struct {
+	Document
+	Warning    string         `json:"warning,omitempty"`
+	Duplicates []DocumentLink `json:"duplicates,omitempty"`
+}
+
+// DocumentLink - ссылка на документ
+type DocumentLink struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
+// Metadata - значения пользовательских полей документа по схеме категории
+type Metadata map[string]any
+
 type CreateDocumentRequest struct {
-	Title      string `json:"title"`
-	Content    string `json:"content"`
-	CategoryID *int   `json:"category_id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	CategoryID *int     `json:"category_id"`
+	Metadata   Metadata `json:"metadata"`
 }
 
 type UpdateDocumentRequest struct {
-	Title      string `json:"title"`
-	Content    string `json:"content"`
-	CategoryID *int   `json:"category_id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	CategoryID *int     `json:"category_id"`
+	Metadata   Metadata `json:"metadata"`
 }
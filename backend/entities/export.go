@@ -0,0 +1,60 @@
+package entities
+
+import "time"
+
+// Состояния фоновой выгрузки
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	// ExportExpired - архив удален по истечении срока хранения
+	ExportExpired = "expired"
+)
+
+// Ограничения выгрузки
+const (
+	// Наборы больше ExportSyncDocuments документов или ExportSyncBytes байт выгружаются в фоне
+	ExportSyncDocuments = 100
+	ExportSyncBytes     = 200 << 20
+	// ExportMaxIDs - наибольшее число идентификаторов в фильтре
+	ExportMaxIDs = 10000
+	// ExportKeepHours - сколько хранится готовый архив
+	ExportKeepHours = 24
+)
+
+// ExportFilter - отбор документов для выгрузки; условия объединяются через И
+type ExportFilter struct {
+	// CategoryID - документы категории; 0 - документы без категории
+	CategoryID *int     `json:"category_id,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	// TagMode: all (по умолчанию) - все теги, any - хотя бы один
+	TagMode string `json:"tag_mode,omitempty"`
+	// From и To ограничивают дату создания: From включительно, To - нет
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	IDs  []int      `json:"ids,omitempty"`
+	// UserID - документы автора; пользователи, кроме администраторов, выгружают только свои
+	UserID *int `json:"user_id,omitempty"`
+}
+
+type ExportRequest struct {
+	ExportFilter
+	// Async - выгрузить в фоне даже небольшой набор
+	Async bool `json:"async"`
+}
+
+// ExportJob - фоновая выгрузка. URL для скачивания заполнен, когда архив готов.
+type ExportJob struct {
+	ID            int          `json:"id"`
+	Status        string       `json:"status"`
+	Filter        ExportFilter `json:"filter"`
+	DocumentCount int          `json:"document_count"`
+	Size          *int64       `json:"size"`
+	Error         *string      `json:"error"`
+	URL           string       `json:"url,omitempty"`
+	CreatedBy     int          `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	FinishedAt    *time.Time   `json:"finished_at"`
+	ExpiresAt     *time.Time   `json:"expires_at"`
+}
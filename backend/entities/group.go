@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+type Group struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	MemberIDs []int64   `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type SetGroupMembersRequest struct {
+	UserIDs []int64 `json:"user_ids"`
+}
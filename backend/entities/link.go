@@ -0,0 +1,43 @@
+package entities
+
+import "time"
+
+// Режимы публичной ссылки на файл документа
+const (
+	LinkDownload = "download"
+	LinkView     = "view"
+)
+
+// Ограничения публичных ссылок
+const (
+	DefaultLinkDays = 7
+	MaxLinkDays     = 90
+	// MaxLinkPasswordAttempts - после стольких неверных паролей ссылка отзывается
+	MaxLinkPasswordAttempts = 10
+)
+
+// ShareLink - ссылка для скачивания или просмотра файла без учетной записи.
+// Token и URL возвращаются только при создании: в базе хранится хэш токена.
+type ShareLink struct {
+	ID             int        `json:"id"`
+	DocumentID     int        `json:"document_id"`
+	Token          string     `json:"token,omitempty"`
+	URL            string     `json:"url,omitempty"`
+	Mode           string     `json:"mode"`
+	HasPassword    bool       `json:"has_password"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	MaxDownloads   *int       `json:"max_downloads"`
+	DownloadCount  int        `json:"download_count"`
+	CreatedBy      int        `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+}
+
+type CreateShareLinkRequest struct {
+	Mode string `json:"mode"`
+	// ExpiresAt по умолчанию - через DefaultLinkDays дней
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Password     string     `json:"password"`
+	MaxDownloads *int       `json:"max_downloads"`
+}
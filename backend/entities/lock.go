@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// Границы срока блокировки документа (check-out)
+const (
+	DefaultLockMinutes = 30
+	MaxLockMinutes     = 8 * 60
+)
+
+type CheckoutRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+type CheckinRequest struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	CategoryID *int     `json:"category_id"`
+	Metadata   Metadata `json:"metadata"`
+	Comment    string   `json:"comment"`
+	// KeepLocked оставляет документ за пользователем после сохранения версии
+	KeepLocked bool `json:"keep_locked"`
+}
+
+// DocumentVersion - снимок документа, сохраненный при check-in
+type DocumentVersion struct {
+	ID         int       `json:"id"`
+	DocumentID int       `json:"document_id"`
+	Version    int       `json:"version"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	CategoryID *int      `json:"category_id"`
+	FilePath   string    `json:"file_path"`
+	Metadata   Metadata  `json:"metadata"`
+	Comment    string    `json:"comment"`
+	CreatedBy  int       `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
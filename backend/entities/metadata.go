@@ -0,0 +1,28 @@
+package entities
+
+// Типы пользовательских полей метаданных категории
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldDate   = "date"
+	FieldEnum   = "enum"
+	FieldUser   = "user"
+)
+
+// FieldTypes - допустимые типы полей метаданных
+var FieldTypes = []string{FieldString, FieldNumber, FieldDate, FieldEnum, FieldUser}
+
+// CategoryField - поле схемы метаданных документов категории
+type CategoryField struct {
+	ID         int      `json:"id"`
+	CategoryID int      `json:"category_id"`
+	Name       string   `json:"name"`
+	Label      string   `json:"label"`
+	Type       string   `json:"type"`
+	Required   bool     `json:"required"`
+	Options    []string `json:"options,omitempty"`
+}
+
+type UpdateCategoryFieldsRequest struct {
+	Fields []CategoryField `json:"fields"`
+}
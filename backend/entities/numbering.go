@@ -0,0 +1,41 @@
+package entities
+
+import "time"
+
+// DefaultNumberFormat - формат номера по умолчанию, например ВХ-2026/000123
+const DefaultNumberFormat = "{prefix}-{year}/{n}"
+
+type NumberingSequence struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"`
+	Format      string    `json:"format"`
+	Padding     int       `json:"padding"`
+	YearReset   bool      `json:"year_reset"`
+	PerCategory bool      `json:"per_category"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type SaveNumberingSequenceRequest struct {
+	Name        string `json:"name"`
+	Prefix      string `json:"prefix"`
+	Format      string `json:"format"`
+	Padding     int    `json:"padding"`
+	YearReset   bool   `json:"year_reset"`
+	PerCategory bool   `json:"per_category"`
+}
+
+type RegisterDocumentRequest struct {
+	SequenceID int `json:"sequence_id"`
+}
+
+// Registration - запись журнала регистрации. Сохраняется и после удаления документа.
+type Registration struct {
+	Number        string    `json:"number"`
+	SequenceID    int       `json:"sequence_id"`
+	DocumentID    *int      `json:"document_id"`
+	DocumentTitle string    `json:"document_title"`
+	CategoryID    *int      `json:"category_id"`
+	RegisteredBy  int       `json:"registered_by"`
+	RegisteredAt  time.Time `json:"registered_at"`
+}
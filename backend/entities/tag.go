@@ -0,0 +1,22 @@
+package entities
+
+// MaxTagLength - максимальная длина названия тега
+const MaxTagLength = 64
+
+type Tag struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type SetTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type RenameTagRequest struct {
+	Name string `json:"name"`
+}
+
+type MergeTagRequest struct {
+	Into int `json:"into"`
+}
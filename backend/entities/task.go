@@ -0,0 +1,53 @@
+package entities
+
+import "time"
+
+// Статусы поручения
+const (
+	TaskOpen       = "open"
+	TaskInProgress = "in_progress"
+	TaskDone       = "done"
+	TaskCancelled  = "cancelled"
+)
+
+// TaskStatuses - допустимые статусы поручения
+var TaskStatuses = []string{TaskOpen, TaskInProgress, TaskDone, TaskCancelled}
+
+// TaskPriorities - допустимые приоритеты поручения
+var TaskPriorities = []string{"low", "normal", "high", "urgent"}
+
+type Task struct {
+	ID          int        `json:"id"`
+	DocumentID  int        `json:"document_id"`
+	ParentID    *int       `json:"parent_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	AssigneeID  int        `json:"assignee_id"`
+	AuthorID    int        `json:"author_id"`
+	DueAt       *time.Time `json:"due_at"`
+	Priority    string     `json:"priority"`
+	Status      string     `json:"status"`
+	Overdue     bool       `json:"overdue"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Subtasks    []Task     `json:"subtasks,omitempty"`
+}
+
+type CreateTaskRequest struct {
+	ParentID    *int       `json:"parent_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	AssigneeID  int        `json:"assignee_id"`
+	DueAt       *time.Time `json:"due_at"`
+	Priority    string     `json:"priority"`
+}
+
+type UpdateTaskRequest struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	AssigneeID  int        `json:"assignee_id"`
+	DueAt       *time.Time `json:"due_at"`
+	Priority    string     `json:"priority"`
+	Status      string     `json:"status"`
+}
@@ -0,0 +1,36 @@
+package entities
+
+import "time"
+
+// Template - шаблон документа. Название, текст и строковые значения метаданных
+// могут содержать подстановки вида {{name}}.
+type Template struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Title       string   `json:"title"`
+	Body        string   `json:"body"`
+	CategoryID  *int     `json:"category_id"`
+	Metadata    Metadata `json:"metadata"`
+	// Placeholders - переменные, которые нужно передать при создании документа
+	Placeholders []string  `json:"placeholders"`
+	CreatedBy    int       `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type SaveTemplateRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Title       string   `json:"title"`
+	Body        string   `json:"body"`
+	CategoryID  *int     `json:"category_id"`
+	Metadata    Metadata `json:"metadata"`
+}
+
+// CreateFromTemplateRequest - значения подстановок и метаданные,
+// переопределяющие значения шаблона
+type CreateFromTemplateRequest struct {
+	Values   map[string]any `json:"values"`
+	Metadata Metadata       `json:"metadata"`
+}
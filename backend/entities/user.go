@@ -2,13 +2,28 @@ package entities
 
 import "time"
 
+// Роли пользователей
+const (
+	RoleUser     = "user"
+	RoleReviewer = "reviewer"
+	RoleAdmin    = "admin"
+)
+
+// UserRoles - роли, которые можно назначить пользователю и указать в переходах жизненного цикла
+var UserRoles = []string{RoleUser, RoleReviewer, RoleAdmin}
+
 type User struct {
 	ID        int       `json:"id"`
 	Login     string    `json:"login"`
 	Password  string    `json:"-"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
 type RegisterRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
@@ -0,0 +1,27 @@
+package entities
+
+type WorkflowTransition struct {
+	ID           int      `json:"id"`
+	CategoryID   *int     `json:"category_id"`
+	Name         string   `json:"name"`
+	FromStatus   string   `json:"from_status"`
+	ToStatus     string   `json:"to_status"`
+	AllowedRoles []string `json:"allowed_roles"`
+	AllowAuthor  bool     `json:"allow_author"`
+}
+
+type UpdateWorkflowRequest struct {
+	Transitions []WorkflowTransition `json:"transitions"`
+}
+
+type TransitionRequest struct {
+	Comment string `json:"comment"`
+}
+
+type TransitionResult struct {
+	Document   Document `json:"document"`
+	Transition string   `json:"transition"`
+	FromStatus string   `json:"from_status"`
+	ToStatus   string   `json:"to_status"`
+	Comment    string   `json:"comment,omitempty"`
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// claimLease - на это время событие резервируется за обработчиком
+	claimLease  = time.Minute
+	batchSize   = 50
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// retention - сколько хранить обработанные события
+	retention = 7 * 24 * time.Hour
+)
+
+// Handler обрабатывает событие. Ошибка приводит к повторной доставке,
+// поэтому обработчики должны быть идемпотентными.
+type Handler func(Event) error
+
+type subscription struct {
+	name    string
+	pattern string
+	handler Handler
+}
+
+// Bus раздает события из event_outbox подписчикам с гарантией at-least-once
+type Bus struct {
+	db            *sql.DB
+	subscriptions []subscription
+	interval      time.Duration
+}
+
+func NewBus(db *sql.DB) *Bus {
+	return &Bus{db: db, interval: time.Second}
+}
+
+// Subscribe регистрирует обработчик. Имя должно быть уникальным и стабильным:
+// по нему отмечается, каким подписчикам событие уже доставлено.
+func (b *Bus) Subscribe(name, pattern string, handler Handler) {
+	b.subscriptions = append(b.subscriptions, subscription{name: name, pattern: pattern, handler: handler})
+}
+
+// Run обрабатывает outbox до закрытия stop
+func (b *Bus) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.processBatch(); err != nil {
+				log.Printf("events: %v", err)
+			}
+			if time.Since(lastPurge) > time.Hour {
+				b.purge()
+				lastPurge = time.Now()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+type claimedEvent struct {
+	Event
+	attempts int
+	done     []string
+}
+
+func (b *Bus) processBatch() error {
+	rows, err := b.db.Query(`
+	UPDATE event_outbox
+	SET next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+	WHERE id IN (
+		SELECT id FROM event_outbox
+		WHERE processed_at IS NULL AND next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, event_type, payload, created_at, attempts, done_subscribers`,
+		int(claimLease.Seconds()), batchSize)
+	if err != nil {
+		return err
+	}
+
+	var batch []claimedEvent
+	for rows.Next() {
+		var (
+			e       claimedEvent
+			payload []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.OccurredAt, &e.attempts, pq.Array(&e.done)); err != nil {
+			rows.Close()
+			return err
+		}
+		e.Data = payload
+		batch = append(batch, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// UPDATE ... RETURNING не гарантирует порядок
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+	for _, e := range batch {
+		b.dispatch(e)
+	}
+	return nil
+}
+
+// dispatch вызывает подписчиков, которым событие еще не доставлено
+func (b *Bus) dispatch(e claimedEvent) {
+	done := make(map[string]bool, len(e.done))
+	for _, name := range e.done {
+		done[name] = true
+	}
+
+	var failed error
+	for _, sub := range b.subscriptions {
+		if done[sub.name] || !Matches(sub.pattern, e.Type) {
+			continue
+		}
+		if err := callHandler(sub.handler, e.Event); err != nil {
+			failed = fmt.Errorf("%s: %w", sub.name, err)
+			continue
+		}
+		e.done = append(e.done, sub.name)
+	}
+
+	var err error
+	if failed == nil {
+		_, err = b.db.Exec(`
+		UPDATE event_outbox SET processed_at = NOW(), done_subscribers = $1, last_error = NULL
+		WHERE id = $2`, pq.Array(e.done), e.ID)
+	} else {
+		attempts := e.attempts + 1
+		log.Printf("events: event %d (%s) attempt %d failed: %v", e.ID, e.Type, attempts, failed)
+		_, err = b.db.Exec(`
+		UPDATE event_outbox
+		SET attempts = $1, done_subscribers = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 second'
+		WHERE id = $5`, attempts, pq.Array(e.done), failed.Error(), int(backoff(attempts).Seconds()), e.ID)
+	}
+	if err != nil {
+		log.Printf("events: failed to update event %d: %v", e.ID, err)
+	}
+}
+
+// callHandler изолирует панику подписчика, чтобы она не остановила шину
+func callHandler(h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(e)
+}
+
+func (b *Bus) purge() {
+	_, err := b.db.Exec(`DELETE FROM event_outbox WHERE processed_at < NOW() - $1 * INTERVAL '1 second'`, int(retention.Seconds()))
+	if err != nil {
+		log.Printf("events: failed to purge outbox: %v", err)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Типы событий жизненного цикла документов и категорий
+const (
+	DocumentCreated = "document.created"
+	DocumentUpdated = "document.updated"
+	DocumentDeleted = "document.deleted"
+	// DocumentStatusChanged публикуется при переходе по жизненному циклу
+	DocumentStatusChanged = "document.status_changed"
+	// DocumentRegistered публикуется при присвоении регистрационного номера
+	DocumentRegistered = "document.registered"
+	// События блокировки документа на редактирование
+	DocumentCheckedOut = "document.checked_out"
+	DocumentCheckedIn  = "document.checked_in"
+	DocumentUnlocked   = "document.unlocked"
+	FileUploaded       = "file.uploaded"
+	// FilePreviewReady публикуется, когда для загруженного файла построены превью
+	FilePreviewReady = "file.preview_ready"
+	// FileScanned публикуется, когда файл проверен антивирусом и доступен для скачивания
+	FileScanned = "file.scanned"
+	// FileInfected публикуется, когда в файле найдена угроза и он перенесен в карантин
+	FileInfected    = "file.infected"
+	CategoryCreated = "category.created"
+	CategoryUpdated = "category.updated"
+	CategoryDeleted = "category.deleted"
+)
+
+// Типы событий поручений
+const (
+	TaskCreated = "task.created"
+	TaskUpdated = "task.updated"
+	TaskDeleted = "task.deleted"
+	// TaskOverdue публикуется планировщиком, когда срок поручения истек
+	TaskOverdue = "task.overdue"
+)
+
+// Типы событий комментариев
+const (
+	CommentCreated  = "comment.created"
+	CommentUpdated  = "comment.updated"
+	CommentDeleted  = "comment.deleted"
+	CommentResolved = "comment.resolved"
+	// CommentMentioned публикуется для каждого нового упоминания пользователя
+	CommentMentioned = "comment.mentioned"
+)
+
+// Типы событий публичных ссылок на файлы
+const (
+	LinkCreated = "link.created"
+	LinkRevoked = "link.revoked"
+	// LinkDownloaded публикуется при каждом засчитанном скачивании по ссылке
+	LinkDownloaded = "link.downloaded"
+)
+
+// Типы событий фоновых выгрузок
+const (
+	ExportCompleted = "export.completed"
+	ExportFailed    = "export.failed"
+)
+
+// Types - все публикуемые типы событий
+var Types = []string{
+	DocumentCreated,
+	DocumentUpdated,
+	DocumentDeleted,
+	DocumentStatusChanged,
+	DocumentRegistered,
+	DocumentCheckedOut,
+	DocumentCheckedIn,
+	DocumentUnlocked,
+	FileUploaded,
+	FilePreviewReady,
+	FileScanned,
+	FileInfected,
+	CategoryCreated,
+	CategoryUpdated,
+	CategoryDeleted,
+	TaskCreated,
+	TaskUpdated,
+	TaskDeleted,
+	TaskOverdue,
+	CommentCreated,
+	CommentUpdated,
+	CommentDeleted,
+	CommentResolved,
+	CommentMentioned,
+	LinkCreated,
+	LinkRevoked,
+	LinkDownloaded,
+	ExportCompleted,
+	ExportFailed,
+}
+
+// Event - событие из outbox-таблицы
+type Event struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Publish сохраняет событие в event_outbox в транзакции изменения.
+// Событие будет разослано подписчикам только после коммита.
+func Publish(tx *sql.Tx, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO event_outbox (event_type, payload, next_attempt_at)
+	VALUES ($1, $2, NOW())`, eventType, string(payload))
+	return err
+}
+
+// Matches сообщает, подходит ли тип события под шаблон: точное имя, "group.*" или "*"
+func Matches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return strings.HasPrefix(eventType, prefix+".")
+	}
+	return false
+}
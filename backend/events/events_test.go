@@ -0,0 +1,49 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	cases := []struct {
+		pattern, eventType string
+		want               bool
+	}{
+		{"*", DocumentCreated, true},
+		{DocumentCreated, DocumentCreated, true},
+		{DocumentCreated, DocumentUpdated, false},
+		{"category.*", CategoryDeleted, true},
+		{"category.*", DocumentDeleted, false},
+		{"doc.*", DocumentCreated, false},
+	}
+	for _, c := range cases {
+		if got := Matches(c.pattern, c.eventType); got != c.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", c.pattern, c.eventType, got, c.want)
+		}
+	}
+}
+
+func TestCallHandlerRecoversPanic(t *testing.T) {
+	err := callHandler(func(Event) error { panic("boom") }, Event{})
+	if err == nil {
+		t.Fatal("expected error from panicking handler")
+	}
+
+	want := errors.New("failed")
+	if err := callHandler(func(Event) error { return want }, Event{}); err != want {
+		t.Errorf("callHandler() = %v, want %v", err, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if got := backoff(1); got != baseBackoff {
+		t.Errorf("backoff(1) = %v, want %v", got, baseBackoff)
+	}
+	if got := backoff(100); got != maxBackoff {
+		t.Errorf("backoff(100) = %v, want %v", got, maxBackoff)
+	}
+	if backoff(3) <= backoff(2) {
+		t.Error("backoff must grow")
+	}
+}
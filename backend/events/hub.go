@@ -0,0 +1,139 @@
+package events
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// hubPollInterval - период опроса event_outbox
+	hubPollInterval = time.Second
+	// LateCommitWindow - сколько ждать событий, чей id выдан раньше, а коммит случился позже
+	LateCommitWindow = 10 * time.Second
+	// subscriberBuffer - сколько событий может накопиться у медленного клиента
+	subscriberBuffer = 64
+	// replayLimit - размер страницы Since; длинную историю поток дочитывает несколькими страницами
+	replayLimit = 1000
+)
+
+// Hub читает event_outbox и раздает новые события подключенным клиентам.
+// В отличие от Bus, каждый экземпляр приложения видит все события,
+// поэтому клиенты получают изменения независимо от того, какой узел их обработал.
+type Hub struct {
+	db          *sql.DB
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	startOnce   sync.Once
+}
+
+func NewHub(db *sql.DB) *Hub {
+	return &Hub{db: db, subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe регистрирует клиента. Канал закрывается хабом, если клиент не успевает
+// читать события; тогда клиент должен переподключиться с Last-Event-ID.
+func (h *Hub) Subscribe() chan Event {
+	h.startOnce.Do(func() { go h.run() })
+
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe отключает клиента
+func (h *Hub) Unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// Since возвращает события с id больше lastID для возобновления потока
+func (h *Hub) Since(lastID int64) ([]Event, error) {
+	rows, err := h.db.Query(`
+	SELECT id, event_type, payload, created_at FROM event_outbox
+	WHERE id > $1 ORDER BY id LIMIT $2`, lastID, replayLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Event
+	for rows.Next() {
+		var (
+			e       Event
+			payload []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		e.Data = payload
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// Head возвращает наибольший id в outbox - позицию, с которой начинается новый поток
+func (h *Hub) Head() (int64, error) {
+	var id int64
+	err := h.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM event_outbox").Scan(&id)
+	return id, err
+}
+
+func (h *Hub) run() {
+	floor, err := h.Head()
+	if err != nil {
+		log.Printf("events: hub failed to read outbox position: %v", err)
+	}
+	seen := make(map[int64]time.Time)
+
+	ticker := time.NewTicker(hubPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		batch, err := h.Since(floor)
+		if err != nil {
+			log.Printf("events: hub poll failed: %v", err)
+			continue
+		}
+		now := time.Now()
+		for _, e := range batch {
+			if _, ok := seen[e.ID]; ok {
+				continue
+			}
+			seen[e.ID] = now
+			h.broadcast(e)
+		}
+
+		// Пропуски в id могут заполниться позже закоммиченными событиями,
+		// поэтому нижняя граница сдвигается только за пределы окна ожидания
+		cutoff := now.Add(-LateCommitWindow)
+		for id, at := range seen {
+			if at.Before(cutoff) {
+				if id > floor {
+					floor = id
+				}
+				delete(seen, id)
+			}
+		}
+	}
+}
+
+func (h *Hub) broadcast(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Клиент не успевает: отключаем его, чтобы не блокировать остальных
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
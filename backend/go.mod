@@ -8,3 +8,5 @@ require (
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.26.0
 )
+
+require github.com/go-pdf/fpdf v0.9.0
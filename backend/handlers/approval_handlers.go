@@ -0,0 +1,667 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+)
+
+type ApprovalHandler struct {
+	db *sql.DB
+}
+
+func NewApprovalHandler(db *sql.DB) *ApprovalHandler {
+	return &ApprovalHandler{db: db}
+}
+
+// GetApprovalRoutes возвращает маршруты согласования документа с шагами
+func (h *ApprovalHandler) GetApprovalRoutes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.db.Query("SELECT id FROM approval_routes WHERE document_id = $1 ORDER BY id", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var routeIDs []int
+	for rows.Next() {
+		var routeID int
+		if err := rows.Scan(&routeID); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		routeIDs = append(routeIDs, routeID)
+	}
+	rows.Close()
+
+	routes := []entities.ApprovalRoute{}
+	for _, routeID := range routeIDs {
+		route, err := loadApprovalRoute(h.db, id, routeID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		routes = append(routes, route)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routes)
+}
+
+// GetApprovalRoute возвращает один маршрут согласования
+func (h *ApprovalHandler) GetApprovalRoute(w http.ResponseWriter, r *http.Request) {
+	docID, routeID, ok := approvalRouteIDs(w, r)
+	if !ok {
+		return
+	}
+
+	route, err := loadApprovalRoute(h.db, docID, routeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Approval route not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+// CreateApprovalRoute отправляет документ на согласование
+func (h *ApprovalHandler) CreateApprovalRoute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.CreateApprovalRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = entities.ApprovalSequential
+	}
+	if req.Mode != entities.ApprovalSequential && req.Mode != entities.ApprovalParallel {
+		http.Error(w, "mode must be sequential or parallel", http.StatusBadRequest)
+		return
+	}
+	if len(req.Steps) == 0 {
+		http.Error(w, "at least one step is required", http.StatusBadRequest)
+		return
+	}
+	for _, step := range req.Steps {
+		if (step.UserID == nil) == (step.GroupID == nil) {
+			http.Error(w, "each step needs exactly one of user_id or group_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	doc, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if doc.UserID != userID && role != "admin" {
+		http.Error(w, "only the author can send a document for approval", http.StatusForbidden)
+		return
+	}
+	if doc.Status != entities.StatusDraft && doc.Status != entities.StatusReview {
+		http.Error(w, "only draft or review documents can be sent for approval", http.StatusConflict)
+		return
+	}
+
+	active, err := approvalInProgress(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if active {
+		http.Error(w, "document already has an approval route in progress", http.StatusConflict)
+		return
+	}
+
+	var routeID int
+	err = tx.QueryRow(`
+	INSERT INTO approval_routes (document_id, mode, status, created_by)
+	VALUES ($1, $2, $3, $4) RETURNING id`, id, req.Mode, entities.RouteInProgress, userID).Scan(&routeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i, step := range req.Steps {
+		stage := 1
+		if req.Mode == entities.ApprovalSequential {
+			stage = i + 1
+		}
+		required := step.Required == nil || *step.Required
+		_, err := tx.Exec(`
+		INSERT INTO approval_steps (route_id, stage, approver_user_id, approver_group_id, required, deadline, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			routeID, stage, step.UserID, step.GroupID, required, step.Deadline, entities.StepWaiting)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	routeStatus, err := advanceApprovalRoute(tx, routeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Документ на согласовании находится в статусе review
+	target := entities.StatusReview
+	if routeStatus == entities.RouteApproved {
+		target = entities.StatusApproved
+	}
+	var evs []outboxEvent
+	if doc.Status != target {
+		ev, err := setDocumentStatus(tx, doc, target, "approval", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		evs = append(evs, ev)
+	}
+
+	route, err := loadApprovalRoute(tx, id, routeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.approval_start", TargetType: "document", TargetID: intPtr(id), After: route}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(route)
+}
+
+// ApproveStep согласует шаг маршрута
+func (h *ApprovalHandler) ApproveStep(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, entities.StepApproved)
+}
+
+// RejectStep отклоняет шаг маршрута; комментарий обязателен
+func (h *ApprovalHandler) RejectStep(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, entities.StepRejected)
+}
+
+// DelegateStep передает шаг другому пользователю
+func (h *ApprovalHandler) DelegateStep(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, entities.StepDelegated)
+}
+
+var errNotApprover = errors.New("you are not an approver of this step")
+
+// decide выполняет решение по шагу и продвигает маршрут
+func (h *ApprovalHandler) decide(w http.ResponseWriter, r *http.Request, decision string) {
+	docID, routeID, ok := approvalRouteIDs(w, r)
+	if !ok {
+		return
+	}
+	stepID, err := strconv.Atoi(mux.Vars(r)["step_id"])
+	if err != nil {
+		http.Error(w, "Invalid step ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.ApprovalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if decision == entities.StepRejected && req.Comment == "" {
+		http.Error(w, "comment is required to reject", http.StatusBadRequest)
+		return
+	}
+	userID := *currentUserID(r)
+	if decision == entities.StepDelegated {
+		if req.UserID == 0 || req.UserID == userID {
+			http.Error(w, "user_id of another user is required to delegate", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", req.UserID).Scan(&exists); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "delegate user not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var routeStatus string
+	err = tx.QueryRow("SELECT status FROM approval_routes WHERE id = $1 AND document_id = $2 FOR UPDATE", routeID, docID).Scan(&routeStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Approval route not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if routeStatus != entities.RouteInProgress {
+		http.Error(w, "approval route is already "+routeStatus, http.StatusConflict)
+		return
+	}
+
+	step, err := scanApprovalStep(tx.QueryRow("SELECT "+approvalStepColumns+" FROM approval_steps WHERE id = $1 AND route_id = $2 FOR UPDATE", stepID, routeID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Approval step not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if step.Status != entities.StepPending {
+		http.Error(w, "step is "+step.Status+", not pending", http.StatusConflict)
+		return
+	}
+	if err := checkApprover(tx, step, userID); err != nil {
+		if err == errNotApprover {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	_, err = tx.Exec(`
+	UPDATE approval_steps SET status = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP, comment = $3
+	WHERE id = $4`, decision, userID, req.Comment, stepID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case decision == entities.StepDelegated:
+		_, err = tx.Exec(`
+		INSERT INTO approval_steps (route_id, stage, approver_user_id, required, deadline, status, delegated_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			routeID, step.Stage, req.UserID, step.Required, step.Deadline, entities.StepPending, stepID)
+		routeStatus = entities.RouteInProgress
+	case decision == entities.StepRejected && step.Required:
+		routeStatus = entities.RouteRejected
+		err = finishApprovalRoute(tx, routeID, routeStatus)
+	default:
+		routeStatus, err = advanceApprovalRoute(tx, routeID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Итог маршрута переводит документ: согласован - approved, отклонен - обратно в draft.
+	// Документ, уже выведенный из review, остается в своем статусе.
+	var evs []outboxEvent
+	if routeStatus != entities.RouteInProgress {
+		doc, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", docID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if doc.Status == entities.StatusReview {
+			ev, err := setDocumentStatus(tx, doc, approvalOutcome(routeStatus), "approval", req.Comment)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			evs = append(evs, ev)
+		}
+	}
+
+	route, err := loadApprovalRoute(tx, docID, routeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.approval_" + decision, TargetType: "document", TargetID: intPtr(docID), Before: step, After: route}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+// CancelApprovalRoute отзывает документ с согласования и возвращает его в черновики
+func (h *ApprovalHandler) CancelApprovalRoute(w http.ResponseWriter, r *http.Request) {
+	docID, routeID, ok := approvalRouteIDs(w, r)
+	if !ok {
+		return
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		status    string
+		createdBy int
+	)
+	err = tx.QueryRow("SELECT status, created_by FROM approval_routes WHERE id = $1 AND document_id = $2 FOR UPDATE", routeID, docID).
+		Scan(&status, &createdBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Approval route not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if createdBy != userID && role != "admin" {
+		http.Error(w, "only the initiator can cancel the approval route", http.StatusForbidden)
+		return
+	}
+	if status != entities.RouteInProgress {
+		http.Error(w, "approval route is already "+status, http.StatusConflict)
+		return
+	}
+
+	if err := finishApprovalRoute(tx, routeID, entities.RouteCancelled); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	doc, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", docID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var evs []outboxEvent
+	if doc.Status == entities.StatusReview {
+		ev, err := setDocumentStatus(tx, doc, entities.StatusDraft, "approval_cancel", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		evs = append(evs, ev)
+	}
+	route, err := loadApprovalRoute(tx, docID, routeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.approval_cancel", TargetType: "document", TargetID: intPtr(docID), After: route}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+func approvalRouteIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	docID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	routeID, err := strconv.Atoi(vars["route_id"])
+	if err != nil {
+		http.Error(w, "Invalid route ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return docID, routeID, true
+}
+
+// checkApprover проверяет, что пользователь - согласующий шага лично или через группу
+func checkApprover(tx *sql.Tx, step entities.ApprovalStep, userID int) error {
+	if step.ApproverUserID != nil {
+		if *step.ApproverUserID == userID {
+			return nil
+		}
+		return errNotApprover
+	}
+	var member bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM user_group_members WHERE group_id = $1 AND user_id = $2)",
+		*step.ApproverGroupID, userID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errNotApprover
+	}
+	return nil
+}
+
+// advanceApprovalRoute активирует следующий этап, когда текущий пройден,
+// и завершает маршрут после последнего этапа
+func advanceApprovalRoute(tx *sql.Tx, routeID int) (string, error) {
+	steps, err := loadApprovalSteps(tx, routeID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, stage := range groupStepsByStage(steps) {
+		activated := false
+		for i := range stage {
+			if stage[i].Status == entities.StepWaiting {
+				stage[i].Status = entities.StepPending
+				activated = true
+			}
+		}
+		if activated {
+			_, err := tx.Exec("UPDATE approval_steps SET status = $1 WHERE route_id = $2 AND stage = $3 AND status = $4",
+				entities.StepPending, routeID, stage[0].Stage, entities.StepWaiting)
+			if err != nil {
+				return "", err
+			}
+		}
+		switch stageResult(stage) {
+		case entities.RouteInProgress:
+			return entities.RouteInProgress, nil
+		case entities.RouteRejected:
+			return entities.RouteRejected, finishApprovalRoute(tx, routeID, entities.RouteRejected)
+		}
+		// Необязательные шаги не задерживают маршрут после прохождения этапа
+		_, err := tx.Exec("UPDATE approval_steps SET status = $1 WHERE route_id = $2 AND stage = $3 AND status = $4",
+			entities.StepSkipped, routeID, stage[0].Stage, entities.StepPending)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return entities.RouteApproved, finishApprovalRoute(tx, routeID, entities.RouteApproved)
+}
+
+// stageResult возвращает итог этапа: RouteApproved, когда все обязательные шаги согласованы,
+// RouteRejected, когда отклонен обязательный шаг, и RouteInProgress, пока решения нет.
+// Этап без обязательных шагов ждет решения по каждому шагу и пройден, если согласован
+// хотя бы один шаг; если отклонены все - маршрут отклоняется.
+func stageResult(stage []entities.ApprovalStep) string {
+	hasRequired, requiredOpen, open, approved := false, false, false, false
+	for _, s := range stage {
+		if s.Status == entities.StepDelegated {
+			continue
+		}
+		if s.Required && s.Status == entities.StepRejected {
+			return entities.RouteRejected
+		}
+		isOpen := s.Status == entities.StepPending || s.Status == entities.StepWaiting
+		if s.Required {
+			hasRequired = true
+			requiredOpen = requiredOpen || isOpen
+		}
+		open = open || isOpen
+		approved = approved || s.Status == entities.StepApproved
+	}
+	switch {
+	case requiredOpen || (!hasRequired && open):
+		return entities.RouteInProgress
+	case hasRequired || approved:
+		return entities.RouteApproved
+	}
+	return entities.RouteRejected
+}
+
+// groupStepsByStage разбивает шаги (отсортированные по этапу) на этапы
+func groupStepsByStage(steps []entities.ApprovalStep) [][]entities.ApprovalStep {
+	var stages [][]entities.ApprovalStep
+	for _, s := range steps {
+		if len(stages) == 0 || stages[len(stages)-1][0].Stage != s.Stage {
+			stages = append(stages, nil)
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], s)
+	}
+	return stages
+}
+
+// finishApprovalRoute закрывает маршрут и пропускает оставшиеся шаги
+// approvalOutcome возвращает статус документа по итогу маршрута
+func approvalOutcome(routeStatus string) string {
+	if routeStatus == entities.RouteRejected {
+		return entities.StatusDraft
+	}
+	return entities.StatusApproved
+}
+
+// approvalInProgress сообщает, идет ли по документу согласование
+func approvalInProgress(q rowQueryer, docID int) (bool, error) {
+	var active bool
+	err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM approval_routes WHERE document_id = $1 AND status = $2)", docID, entities.RouteInProgress).Scan(&active)
+	return active, err
+}
+
+func finishApprovalRoute(tx *sql.Tx, routeID int, status string) error {
+	_, err := tx.Exec("UPDATE approval_routes SET status = $1, completed_at = CURRENT_TIMESTAMP WHERE id = $2", status, routeID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE approval_steps SET status = $1 WHERE route_id = $2 AND status IN ($3, $4)",
+		entities.StepSkipped, routeID, entities.StepPending, entities.StepWaiting)
+	return err
+}
+
+// setDocumentStatus меняет статус документа и готовит событие о смене статуса
+func setDocumentStatus(tx *sql.Tx, before entities.Document, status, reason, comment string) (outboxEvent, error) {
+	doc, err := scanDocument(tx.QueryRow(`
+	UPDATE documents SET status = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	RETURNING `+documentColumns, status, before.ID))
+	if err != nil {
+		return outboxEvent{}, err
+	}
+	return outboxEvent{events.DocumentStatusChanged, entities.TransitionResult{
+		Document:   doc,
+		Transition: reason,
+		FromStatus: before.Status,
+		ToStatus:   doc.Status,
+		Comment:    comment,
+	}}, nil
+}
+
+const approvalStepColumns = "id, route_id, stage, approver_user_id, approver_group_id, required, deadline, status, decided_by, decided_at, COALESCE(comment, ''), delegated_from"
+
+func scanApprovalStep(row rowScanner) (entities.ApprovalStep, error) {
+	var s entities.ApprovalStep
+	err := row.Scan(&s.ID, &s.RouteID, &s.Stage, &s.ApproverUserID, &s.ApproverGroupID, &s.Required, &s.Deadline,
+		&s.Status, &s.DecidedBy, &s.DecidedAt, &s.Comment, &s.DelegatedFrom)
+	s.Overdue = s.Status == entities.StepPending && s.Deadline != nil && s.Deadline.Before(time.Now())
+	return s, err
+}
+
+func loadApprovalSteps(q queryer, routeID int) ([]entities.ApprovalStep, error) {
+	rows, err := q.Query("SELECT "+approvalStepColumns+" FROM approval_steps WHERE route_id = $1 ORDER BY stage, id", routeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []entities.ApprovalStep{}
+	for rows.Next() {
+		step, err := scanApprovalStep(rows)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// approvalQueryer - *sql.DB или *sql.Tx
+type approvalQueryer interface {
+	queryer
+	rowQueryer
+}
+
+func loadApprovalRoute(db approvalQueryer, docID, routeID int) (entities.ApprovalRoute, error) {
+	var route entities.ApprovalRoute
+	err := db.QueryRow(`
+	SELECT id, document_id, mode, status, created_by, created_at, completed_at
+	FROM approval_routes WHERE id = $1 AND document_id = $2`, routeID, docID).
+		Scan(&route.ID, &route.DocumentID, &route.Mode, &route.Status, &route.CreatedBy, &route.CreatedAt, &route.CompletedAt)
+	if err != nil {
+		return route, err
+	}
+	route.Steps, err = loadApprovalSteps(db, routeID)
+	return route, err
+}
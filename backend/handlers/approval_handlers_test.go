@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/database"
+	"backend/entities"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func TestStageResult(t *testing.T) {
+	step := func(status string, required bool) entities.ApprovalStep {
+		return entities.ApprovalStep{Stage: 1, Status: status, Required: required}
+	}
+
+	cases := []struct {
+		name  string
+		stage []entities.ApprovalStep
+		want  string
+	}{
+		{"required pending", []entities.ApprovalStep{step(entities.StepPending, true)}, entities.RouteInProgress},
+		{"required approved", []entities.ApprovalStep{step(entities.StepApproved, true)}, entities.RouteApproved},
+		{"required rejected", []entities.ApprovalStep{step(entities.StepRejected, true), step(entities.StepApproved, false)}, entities.RouteRejected},
+		{"parallel one of two", []entities.ApprovalStep{step(entities.StepApproved, true), step(entities.StepPending, true)}, entities.RouteInProgress},
+		{"optional does not block", []entities.ApprovalStep{step(entities.StepApproved, true), step(entities.StepPending, false)}, entities.RouteApproved},
+		{"optional rejection ignored", []entities.ApprovalStep{step(entities.StepApproved, true), step(entities.StepRejected, false)}, entities.RouteApproved},
+		{"only optional waits", []entities.ApprovalStep{step(entities.StepPending, false)}, entities.RouteInProgress},
+		{"only optional one approved", []entities.ApprovalStep{step(entities.StepRejected, false), step(entities.StepApproved, false)}, entities.RouteApproved},
+		{"only optional all rejected", []entities.ApprovalStep{step(entities.StepRejected, false), step(entities.StepRejected, false)}, entities.RouteRejected},
+		{"delegated replaced", []entities.ApprovalStep{step(entities.StepDelegated, true), step(entities.StepPending, true)}, entities.RouteInProgress},
+		{"delegate approved", []entities.ApprovalStep{step(entities.StepDelegated, true), step(entities.StepApproved, true)}, entities.RouteApproved},
+	}
+	for _, c := range cases {
+		if got := stageResult(c.stage); got != c.want {
+			t.Errorf("%s: stageResult() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestGroupStepsByStage(t *testing.T) {
+	steps := []entities.ApprovalStep{{ID: 1, Stage: 1}, {ID: 2, Stage: 1}, {ID: 3, Stage: 2}, {ID: 4, Stage: 3}}
+	stages := groupStepsByStage(steps)
+	if len(stages) != 3 || len(stages[0]) != 2 || stages[2][0].ID != 4 {
+		t.Errorf("unexpected grouping: %+v", stages)
+	}
+}
+
+// TestApprovalRouteOwnsReviewStatus проверяет, что во время согласования переход по схеме
+// возвращает 409, а итог маршрута не трогает документ, уже выведенный из review.
+// Нужна запущенная БД, иначе тест пропускается.
+func TestApprovalRouteOwnsReviewStatus(t *testing.T) {
+	db, err := database.Connect()
+	if err != nil {
+		t.Skipf("Skipping integration test: cannot connect to database: %v", err)
+	}
+	defer db.Close()
+	if err := database.CreateTables(db); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	var userID, docID, routeID, stepID int
+	login := fmt.Sprintf("approval-test-%d", time.Now().UnixNano())
+	if err := db.QueryRow("INSERT INTO users (login, password_hash) VALUES ($1, '') RETURNING id", login).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id = $1", userID)
+	err = db.QueryRow("INSERT INTO documents (title, status, user_id) VALUES ('Approval test', $1, $2) RETURNING id",
+		entities.StatusReview, userID).Scan(&docID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM documents WHERE id = $1", docID)
+	err = db.QueryRow("INSERT INTO approval_routes (document_id, mode, status, created_by) VALUES ($1, $2, $3, $4) RETURNING id",
+		docID, entities.ApprovalSequential, entities.RouteInProgress, userID).Scan(&routeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow("INSERT INTO approval_steps (route_id, stage, approver_user_id, status) VALUES ($1, 1, $2, $3) RETURNING id",
+		routeID, userID, entities.StepPending).Scan(&stepID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(vars map[string]string) *http.Request {
+		r := httptest.NewRequest("POST", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDContextKey, userID))
+		return mux.SetURLVars(r, vars)
+	}
+	status := func() string {
+		var s string
+		if err := db.QueryRow("SELECT status FROM documents WHERE id = $1", docID).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	w := httptest.NewRecorder()
+	NewWorkflowHandler(db).ApplyTransition(w, request(map[string]string{"id": fmt.Sprint(docID), "name": "approve"}))
+	if w.Code != http.StatusConflict {
+		t.Errorf("transition during approval: status %d, want 409", w.Code)
+	}
+	if got := status(); got != entities.StatusReview {
+		t.Errorf("document status = %s, want %s", got, entities.StatusReview)
+	}
+
+	// Документ вывели из review в обход маршрута (например, до этой проверки)
+	if _, err := db.Exec("UPDATE documents SET status = $1 WHERE id = $2", entities.StatusArchived, docID); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	NewApprovalHandler(db).ApproveStep(w, request(map[string]string{
+		"id": fmt.Sprint(docID), "route_id": fmt.Sprint(routeID), "step_id": fmt.Sprint(stepID),
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve: status %d: %s", w.Code, w.Body)
+	}
+	if got := status(); got != entities.StatusArchived {
+		t.Errorf("document status = %s, approval must not move a document outside review", got)
+	}
+}
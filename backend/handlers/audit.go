@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"backend/audit"
+	"backend/middleware"
+)
+
+// auditRecord описывает одно событие журнала аудита
+type auditRecord struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int
+	Before     any
+	After      any
+}
+
+// recordAudit добавляет событие в цепочку audit_events для действий, которые ничего
+// не меняют (просмотр, скачивание, вход). Ошибка записи не прерывает обработку запроса,
+// но попадает в лог. Изменения журналируются в своей транзакции через commitAudited.
+func recordAudit(db *sql.DB, r *http.Request, rec auditRecord) {
+	e, err := auditEvent(r, rec)
+	if err == nil {
+		err = audit.Append(db, e)
+	}
+	if err != nil {
+		log.Printf("audit: failed to record %s: %v", rec.Action, err)
+	}
+}
+
+// commitAudited добавляет событие аудита и события outbox в транзакцию и фиксирует ее,
+// так что изменение не может сохраниться без записи в журнале
+func commitAudited(tx *sql.Tx, r *http.Request, rec auditRecord, evs ...outboxEvent) error {
+	e, err := auditEvent(r, rec)
+	if err != nil {
+		return err
+	}
+	if err := audit.AppendTx(tx, e); err != nil {
+		return fmt.Errorf("audit %s: %w", rec.Action, err)
+	}
+	return commitWithEvents(tx, evs...)
+}
+
+// auditEvent собирает событие журнала из записи и запроса
+func auditEvent(r *http.Request, rec auditRecord) (audit.Event, error) {
+	if rec.ActorID == nil {
+		rec.ActorID = currentUserID(r)
+	}
+	before, err := marshalAuditValue(rec.Before)
+	if err != nil {
+		return audit.Event{}, fmt.Errorf("audit %s: marshal before: %w", rec.Action, err)
+	}
+	after, err := marshalAuditValue(rec.After)
+	if err != nil {
+		return audit.Event{}, fmt.Errorf("audit %s: marshal after: %w", rec.Action, err)
+	}
+	return audit.Event{
+		ActorID:    rec.ActorID,
+		Action:     rec.Action,
+		TargetType: rec.TargetType,
+		TargetID:   rec.TargetID,
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+		Before:     before,
+		After:      after,
+	}, nil
+}
+
+// marshalAuditValue сериализует снимок объекта; nil сохраняется как SQL NULL.
+// Возвращается строка, так как lib/pq передает []byte как bytea.
+func marshalAuditValue(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// currentUserID возвращает ID пользователя из контекста запроса
+func currentUserID(r *http.Request) *int {
+	if id, ok := r.Context().Value(middleware.UserIDContextKey).(int); ok {
+		return &id
+	}
+	return nil
+}
+
+// Прокси из TRUSTED_PROXIES, от которых принимаются X-Real-IP и X-Forwarded-For
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// parseTrustedProxies разбирает список CIDR, IP или имен хостов через запятую.
+// Имена (например, nginx в compose) разрешаются в адреса; неверные записи пропускаются с ошибкой.
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var (
+		nets []*net.IPNet
+		errs []error
+	)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(item); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		ips := []net.IP{net.ParseIP(item)}
+		if ips[0] == nil {
+			var err error
+			if ips, err = net.LookupIP(item); err != nil {
+				errs = append(errs, fmt.Errorf("%q: %w", item, err))
+				continue
+			}
+		}
+		for _, ip := range ips {
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		}
+	}
+	return nets, errors.Join(errs...)
+}
+
+func ipTrusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP определяет адрес клиента с учетом заголовков доверенного прокси (TRUSTED_PROXIES)
+func clientIP(r *http.Request) string {
+	trustedProxiesOnce.Do(func() {
+		var err error
+		trustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+		if err != nil {
+			log.Printf("audit: TRUSTED_PROXIES: %v", err)
+		}
+	})
+	return forwardedClientIP(r, trustedProxies)
+}
+
+// forwardedClientIP возвращает адрес клиента. Заголовки учитываются, только если запрос пришел
+// от доверенного прокси, иначе любой клиент мог бы записать в журнал аудита произвольный адрес.
+func forwardedClientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !ipTrusted(host, proxies) {
+		return host
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	// Каждый прокси дописывает адрес справа, поэтому клиент - первый недоверенный адрес с конца
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(hops[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		if !ipTrusted(ip, proxies) {
+			return ip
+		}
+	}
+	return host
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/audit"
+	"backend/entities"
+)
+
+type AuditHandler struct {
+	db     *sql.DB
+	signer *audit.Signer
+}
+
+func NewAuditHandler(db *sql.DB) *AuditHandler {
+	// Корректность ключа проверяется при старте в main
+	signer, err := audit.NewSignerFromEnv()
+	if err != nil {
+		log.Printf("audit: %v", err)
+	}
+	return &AuditHandler{db: db, signer: signer}
+}
+
+// VerifyAudit проверяет целостность цепочки аудита и подписи контрольных точек
+func (h *AuditHandler) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if h.signer == nil {
+		http.Error(w, "audit signing key is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := audit.Verify(h.db, h.signer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.db, r, auditRecord{Action: "audit.verify", TargetType: "audit", After: map[string]any{"valid": result.Valid, "problems": len(result.Problems)}})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetAuditEvents возвращает журнал аудита с фильтрами.
+// Параметр format=csv|jsonl отдает выгрузку потоком.
+func (h *AuditHandler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	for _, name := range []string{"actor_id", "target_id"} {
+		if v := q.Get(name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			addCondition(name+" = $%d", id)
+		}
+	}
+	if v := q.Get("action"); v != "" {
+		addCondition("action = $%d", v)
+	}
+	if v := q.Get("target_type"); v != "" {
+		addCondition("target_type = $%d", v)
+	}
+	for name, op := range map[string]string{"from": ">=", "to": "<"} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid "+name+": expected RFC3339", http.StatusBadRequest)
+				return
+			}
+			addCondition("created_at "+op+" $%d", t)
+		}
+	}
+
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "jsonl" {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT id, actor_id, action, target_type, target_id, ip, user_agent, before, after, created_at FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	// Выгрузки отдаются целиком, обычный список постранично
+	if format == "json" {
+		limit := 100
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 1000 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		offset := 0
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+		args = append(args, limit, offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	action := "audit.view"
+	if format != "json" {
+		action = "audit.export"
+	}
+	recordAudit(h.db, r, auditRecord{Action: action, TargetType: "audit", After: q})
+
+	switch format {
+	case "csv":
+		h.writeCSV(w, rows)
+	case "jsonl":
+		h.writeJSONL(w, rows)
+	default:
+		events := []entities.AuditEvent{}
+		for rows.Next() {
+			event, err := scanAuditEvent(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			events = append(events, event)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+func (h *AuditHandler) writeCSV(w http.ResponseWriter, rows *sql.Rows) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "before", "after"})
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			abortExport(err)
+		}
+		cw.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.Format(time.RFC3339),
+			formatOptionalInt(event.ActorID),
+			event.Action,
+			event.TargetType,
+			formatOptionalInt(event.TargetID),
+			event.IP,
+			event.UserAgent,
+			string(event.Before),
+			string(event.After),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(err)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		abortExport(err)
+	}
+}
+
+func (h *AuditHandler) writeJSONL(w http.ResponseWriter, rows *sql.Rows) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			abortExport(err)
+		}
+		if err := enc.Encode(event); err != nil {
+			abortExport(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(err)
+	}
+}
+
+// abortExport обрывает соединение: заголовки уже отправлены, и клиент должен увидеть,
+// что выгрузка неполная, а не получить ее обрезанной как целую
+func abortExport(err error) {
+	log.Printf("audit: export failed: %v", err)
+	panic(http.ErrAbortHandler)
+}
+
+func scanAuditEvent(rows *sql.Rows) (entities.AuditEvent, error) {
+	var (
+		event         entities.AuditEvent
+		before, after []byte
+	)
+	err := rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.TargetType, &event.TargetID,
+		&event.IP, &event.UserAgent, &before, &after, &event.CreatedAt)
+	if before != nil {
+		event.Before = before
+	}
+	if after != nil {
+		event.After = after
+	}
+	return event, err
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
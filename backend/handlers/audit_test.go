@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/database"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote, realIP, forwarded, want string
+	}{
+		// Напрямую от клиента заголовки не учитываются
+		{"203.0.113.7:5000", "1.2.3.4", "1.2.3.4", "203.0.113.7"},
+		{"10.1.2.3:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"192.168.1.5:5000", "", "198.51.100.1", "198.51.100.1"},
+		// Подставленный клиентом адрес слева пропускается
+		{"10.1.2.3:5000", "", "1.2.3.4, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"10.1.2.3:5000", "", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := forwardedClientIP(r, proxies); got != tt.want {
+			t.Errorf("forwardedClientIP(%s, %q, %q) = %q, want %q", tt.remote, tt.realIP, tt.forwarded, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies("not a host name!"); err == nil {
+		t.Error("invalid proxy must be reported")
+	}
+}
+
+// TestCommitAudited проверяет, что изменение фиксируется только вместе с записью аудита.
+// Нужна запущенная БД, иначе тест пропускается.
+func TestCommitAudited(t *testing.T) {
+	db, err := database.Connect()
+	if err != nil {
+		t.Skipf("Skipping integration test: cannot connect to database: %v", err)
+	}
+	defer db.Close()
+	if err := database.CreateTables(db); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	r := httptest.NewRequest("POST", "/categories", nil)
+	createCategory := func(name string, after any) (int, error) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		var id int
+		if err := tx.QueryRow("INSERT INTO categories (name) VALUES ($1) RETURNING id", name).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id, commitAudited(tx, r, auditRecord{Action: "category.create", TargetType: "category", TargetID: intPtr(id), After: after})
+	}
+	exists := func(query string, id int) bool {
+		var ok bool
+		if err := db.QueryRow(query, id).Scan(&ok); err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	const (
+		categoryExists = "SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)"
+		auditExists    = "SELECT EXISTS (SELECT 1 FROM audit_events WHERE target_type = 'category' AND target_id = $1)"
+	)
+
+	name := fmt.Sprintf("audit-test-%d", time.Now().UnixNano())
+	id, err := createCategory(name, map[string]string{"name": name})
+	if err != nil {
+		t.Fatalf("commitAudited: %v", err)
+	}
+	defer db.Exec("DELETE FROM categories WHERE id = $1", id)
+	if !exists(categoryExists, id) || !exists(auditExists, id) {
+		t.Error("committed change must have its audit event")
+	}
+
+	// Снимок, который нельзя сериализовать, не дает записать событие, и изменение откатывается
+	id, err = createCategory(name+"-failed", make(chan int))
+	if err == nil {
+		t.Fatal("commitAudited must fail when the audit event cannot be written")
+	}
+	if exists(categoryExists, id) || exists(auditExists, id) {
+		t.Error("change without an audit event must not be committed")
+	}
+}
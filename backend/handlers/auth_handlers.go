@@ -43,13 +43,28 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	var id int
-	err = h.db.QueryRow("INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id", req.Login, string(hash)).Scan(&id)
+	err = tx.QueryRow("INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id", req.Login, string(hash)).Scan(&id)
 	if err != nil {
+		tx.Rollback()
+		recordAudit(h.db, r, auditRecord{Action: "auth.register_failed", TargetType: "user", After: map[string]string{"login": req.Login}})
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	rec := auditRecord{ActorID: intPtr(id), Action: "auth.register", TargetType: "user", TargetID: intPtr(id), After: map[string]any{"id": id, "login": req.Login}}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{"id": id, "login": req.Login})
@@ -74,6 +89,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	err := h.db.QueryRow("SELECT id, login, password_hash FROM users WHERE login = $1", req.Login).Scan(&id, &login, &passwordHash)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			recordAudit(h.db, r, auditRecord{Action: "auth.login_failed", TargetType: "user", After: map[string]string{"login": req.Login}})
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -82,6 +98,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil {
+		recordAudit(h.db, r, auditRecord{Action: "auth.login_failed", TargetType: "user", TargetID: intPtr(id), After: map[string]string{"login": req.Login}})
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -98,6 +115,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(h.db, r, auditRecord{ActorID: intPtr(id), Action: "auth.login", TargetType: "user", TargetID: intPtr(id)})
+
 	resp := entities.AuthResponse{Token: signed}
 	resp.User.ID = id
 	resp.User.Login = login
@@ -7,21 +7,25 @@ import (
 	"strconv"
 
 	"backend/entities"
+	"backend/events"
+	"backend/upload"
 
 	"github.com/gorilla/mux"
 )
 
 type CategoryHandler struct {
-	db *sql.DB
+	db      *sql.DB
+	uploads upload.Policy
 }
 
-func NewCategoryHandler(db *sql.DB) *CategoryHandler {
-	return &CategoryHandler{db: db}
+// NewCategoryHandler принимает правила приема файлов: лимит категории не превышает глобальный
+func NewCategoryHandler(db *sql.DB, uploads upload.Policy) *CategoryHandler {
+	return &CategoryHandler{db: db, uploads: uploads}
 }
 
 // GetCategories возвращает список всех категорий
 func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query("SELECT id, name, description, created_at, updated_at FROM categories ORDER BY name")
+	rows, err := h.db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY name")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -31,7 +35,7 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 	var categories []entities.Category
 	for rows.Next() {
 		var category entities.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt)
+		err := rows.Scan(categoryFields(&category)...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -39,6 +43,8 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 		categories = append(categories, category)
 	}
 
+	recordAudit(h.db, r, auditRecord{Action: "category.list", TargetType: "category"})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
 }
@@ -54,17 +60,31 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 	query := `
 	INSERT INTO categories (name, description) 
 	VALUES ($1, $2) 
-	RETURNING id, name, description, created_at, updated_at`
+	RETURNING ` + categoryColumns
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
 
 	var category entities.Category
-	err := h.db.QueryRow(query, req.Name, req.Description).
-		Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt)
+	err = tx.QueryRow(query, req.Name, req.Description).
+		Scan(categoryFields(&category)...)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	rec := auditRecord{Action: "category.create", TargetType: "category", TargetID: intPtr(category.ID), After: category}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CategoryCreated, category}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", categoryETag(category))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(category)
@@ -79,11 +99,7 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var category entities.Category
-	query := "SELECT id, name, description, created_at, updated_at FROM categories WHERE id = $1"
-	err = h.db.QueryRow(query, id).
-		Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt)
-
+	category, err := h.loadCategory(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Category not found", http.StatusNotFound)
@@ -93,6 +109,12 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(h.db, r, auditRecord{Action: "category.view", TargetType: "category", TargetID: intPtr(category.ID)})
+
+	if notModified(w, r, categoryETag(category)) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(category)
 }
@@ -112,18 +134,84 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	before, err := h.loadCategory(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.applyCategoryUpdate(w, r, before, req, expectedVersion(r, before.RowVersion))
+}
+
+// PatchCategory частично обновляет категорию по JSON Merge Patch (RFC 7396)
+func (h *CategoryHandler) PatchCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.loadCategory(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	current := entities.UpdateCategoryRequest{Name: before.Name, Description: before.Description}
+	var req entities.UpdateCategoryRequest
+	if status, err := decodeMergePatch(r, current, &req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Обновление условное, чтобы не затереть параллельные изменения неуказанных полей
+	h.applyCategoryUpdate(w, r, before, req, &before.RowVersion)
+}
+
+// applyCategoryUpdate записывает изменения категории. Если expected задан,
+// запись выполняется, только пока row_version не изменилась.
+func (h *CategoryHandler) applyCategoryUpdate(w http.ResponseWriter, r *http.Request, before entities.Category, req entities.UpdateCategoryRequest, expected *int64) {
+	if preconditionFailed(r, categoryETag(before)) {
+		http.Error(w, "category has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
 	query := `
 	UPDATE categories 
 	SET name = $1, description = $2, updated_at = CURRENT_TIMESTAMP 
-	WHERE id = $3 
-	RETURNING id, name, description, created_at, updated_at`
+	WHERE id = $3 AND ($4::bigint IS NULL OR row_version = $4)
+	RETURNING ` + categoryColumns
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
 
 	var category entities.Category
-	err = h.db.QueryRow(query, req.Name, req.Description, id).
-		Scan(&category.ID, &category.Name, &category.Description, &category.CreatedAt, &category.UpdatedAt)
+	err = tx.QueryRow(query, req.Name, req.Description, before.ID, expected).
+		Scan(categoryFields(&category)...)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == sql.ErrNoRows && r.Header.Get("If-Match") != "" {
+			http.Error(w, "category has been modified", http.StatusPreconditionFailed)
+		} else if err == sql.ErrNoRows && expected != nil {
+			http.Error(w, "category was changed concurrently", http.StatusConflict)
+		} else if err == sql.ErrNoRows {
 			http.Error(w, "Category not found", http.StatusNotFound)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -131,6 +219,13 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	rec := auditRecord{Action: "category.update", TargetType: "category", TargetID: intPtr(category.ID), Before: before, After: category}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CategoryUpdated, category}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", categoryETag(category))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(category)
 }
@@ -144,7 +239,30 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM categories WHERE id = $1", id)
+	before, err := h.loadCategory(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if preconditionFailed(r, categoryETag(before)) {
+		http.Error(w, "category has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	expected := expectedVersion(r, before.RowVersion)
+	result, err := tx.Exec("DELETE FROM categories WHERE id = $1 AND ($2::bigint IS NULL OR row_version = $2)", id, expected)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -157,9 +275,40 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		if expected != nil {
+			http.Error(w, "category has been modified", http.StatusPreconditionFailed)
+		} else {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	rec := auditRecord{Action: "category.delete", TargetType: "category", TargetID: intPtr(id), Before: before}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CategoryDeleted, before}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// categoryColumns - столбцы categories в порядке categoryFields
+const categoryColumns = "id, name, description, max_file_size, row_version, created_at, updated_at"
+
+// categoryFields возвращает адреса полей категории для Scan по categoryColumns
+func categoryFields(category *entities.Category) []any {
+	return []any{&category.ID, &category.Name, &category.Description, &category.MaxFileSize, &category.RowVersion, &category.CreatedAt, &category.UpdatedAt}
+}
+
+// categoryETag возвращает ETag текущей версии категории
+func categoryETag(category entities.Category) string {
+	return entityTag("category", category.ID, category.RowVersion)
+}
+
+// loadCategory читает категорию из базы по ID
+func (h *CategoryHandler) loadCategory(id int) (entities.Category, error) {
+	var category entities.Category
+	query := "SELECT " + categoryColumns + " FROM categories WHERE id = $1"
+	err := h.db.QueryRow(query, id).Scan(categoryFields(&category)...)
+	return category, err
+}
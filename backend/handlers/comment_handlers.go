@@ -0,0 +1,515 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type CommentHandler struct {
+	db *sql.DB
+}
+
+func NewCommentHandler(db *sql.DB) *CommentHandler {
+	return &CommentHandler{db: db}
+}
+
+// Текст удаленного комментария не возвращается, но сам комментарий
+// остается в ветке, чтобы ответы на него не потеряли контекст
+const commentColumns = `c.id, c.document_id, c.parent_id, c.author_id,
+	CASE WHEN c.deleted_at IS NULL THEN c.body ELSE '' END,
+	ARRAY(SELECT m.user_id FROM comment_mentions m WHERE m.comment_id = c.id ORDER BY m.user_id),
+	c.resolved, c.resolved_by, c.resolved_at, c.edited_at, c.deleted_at IS NOT NULL, c.created_at`
+
+func scanComment(row rowScanner) (entities.Comment, error) {
+	var c entities.Comment
+	err := row.Scan(&c.ID, &c.DocumentID, &c.ParentID, &c.AuthorID, &c.Body, pq.Array(&c.Mentions),
+		&c.Resolved, &c.ResolvedBy, &c.ResolvedAt, &c.EditedAt, &c.Deleted, &c.CreatedAt)
+	return c, err
+}
+
+// mentionPattern находит упоминания вида @login в начале текста или после пробела и знаков препинания
+var mentionPattern = regexp.MustCompile(`(?:^|[\s(\[,;:])@([\p{L}\p{N}_.\-]+)`)
+
+// parseMentions возвращает уникальные логины, упомянутые в тексте, в порядке появления
+func parseMentions(body string) []string {
+	logins := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// Точка или дефис в конце относятся к предложению, а не к логину
+		login := strings.TrimRight(match[1], ".-")
+		if login != "" && !slices.Contains(logins, login) {
+			logins = append(logins, login)
+		}
+	}
+	return logins
+}
+
+// saveMentions заменяет упоминания комментария и возвращает ID пользователей,
+// упомянутых впервые. Неизвестные логины игнорируются.
+func saveMentions(tx *sql.Tx, commentID int, body string) ([]int, error) {
+	var previous []int64
+	err := tx.QueryRow("SELECT ARRAY(SELECT user_id FROM comment_mentions WHERE comment_id = $1)", commentID).Scan(pq.Array(&previous))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM comment_mentions WHERE comment_id = $1", commentID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+	INSERT INTO comment_mentions (comment_id, user_id)
+	SELECT $1, id FROM users WHERE login = ANY($2)
+	RETURNING user_id`, commentID, pq.Array(parseMentions(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var added []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(previous, int64(id)) {
+			added = append(added, id)
+		}
+	}
+	return added, rows.Err()
+}
+
+// mentionEvents формирует события comment.mentioned для новых упоминаний
+func mentionEvents(comment entities.Comment, userIDs []int) []outboxEvent {
+	var evs []outboxEvent
+	for _, id := range userIDs {
+		// Упоминание самого себя не уведомляет
+		if id == comment.AuthorID {
+			continue
+		}
+		evs = append(evs, outboxEvent{events.CommentMentioned, entities.CommentMention{UserID: id, Comment: comment}})
+	}
+	return evs
+}
+
+// buildCommentTree собирает ветки обсуждения из плоского списка комментариев
+func buildCommentTree(comments []entities.Comment, parentID *int) []entities.Comment {
+	result := []entities.Comment{}
+	for _, c := range comments {
+		if (parentID == nil && c.ParentID == nil) || (parentID != nil && c.ParentID != nil && *c.ParentID == *parentID) {
+			c.Replies = buildCommentTree(comments, &c.ID)
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (h *CommentHandler) loadDocumentComments(docID int) ([]entities.Comment, error) {
+	rows, err := h.db.Query("SELECT "+commentColumns+" FROM comments c WHERE c.document_id = $1 ORDER BY c.created_at, c.id", docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []entities.Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// requireDocument отвечает 404, если документа нет
+func (h *CommentHandler) requireDocument(w http.ResponseWriter, docID int) bool {
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM documents WHERE id = $1)", docID).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// GetComments возвращает ветки обсуждения документа.
+// Фильтр resolved=true|false отбирает ветки по состоянию.
+func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	docID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if !h.requireDocument(w, docID) {
+		return
+	}
+
+	comments, err := h.loadDocumentComments(docID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	threads := buildCommentTree(comments, nil)
+
+	if value := r.URL.Query().Get("resolved"); value != "" {
+		resolved, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid resolved", http.StatusBadRequest)
+			return
+		}
+		threads = slices.DeleteFunc(threads, func(c entities.Comment) bool { return c.Resolved != resolved })
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(threads)
+}
+
+// CreateComment добавляет комментарий или ответ в ветку (parent_id)
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	docID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM documents WHERE id = $1)", docID).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if req.ParentID != nil {
+		var parentDocID int
+		err := tx.QueryRow("SELECT document_id FROM comments WHERE id = $1", *req.ParentID).Scan(&parentDocID)
+		if err == sql.ErrNoRows || (err == nil && parentDocID != docID) {
+			http.Error(w, "parent comment not found in this document", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var id int
+	err = tx.QueryRow("INSERT INTO comments (document_id, parent_id, author_id, body) VALUES ($1, $2, $3, $4) RETURNING id",
+		docID, req.ParentID, *currentUserID(r), req.Body).Scan(&id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mentioned, err := saveMentions(tx, id, req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment, err := scanComment(tx.QueryRow("SELECT "+commentColumns+" FROM comments c WHERE c.id = $1", id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	evs := append([]outboxEvent{{events.CommentCreated, comment}}, mentionEvents(comment, mentioned)...)
+	rec := auditRecord{Action: "comment.create", TargetType: "comment", TargetID: intPtr(comment.ID), After: comment}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// lockComment читает комментарий документа с блокировкой строки
+func lockComment(tx *sql.Tx, w http.ResponseWriter, r *http.Request) (entities.Comment, bool) {
+	vars := mux.Vars(r)
+	docID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return entities.Comment{}, false
+	}
+	commentID, err := strconv.Atoi(vars["comment_id"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return entities.Comment{}, false
+	}
+
+	comment, err := scanComment(tx.QueryRow("SELECT "+commentColumns+" FROM comments c WHERE c.id = $1 AND c.document_id = $2 FOR UPDATE", commentID, docID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return entities.Comment{}, false
+	}
+	return comment, true
+}
+
+// UpdateComment изменяет текст собственного комментария
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	var req entities.UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, ok := lockComment(tx, w, r)
+	if !ok {
+		return
+	}
+	if before.AuthorID != *currentUserID(r) {
+		http.Error(w, "only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+	if before.Deleted {
+		http.Error(w, "comment is deleted", http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE comments SET body = $1, edited_at = CURRENT_TIMESTAMP WHERE id = $2", req.Body, before.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mentioned, err := saveMentions(tx, before.ID, req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment, err := scanComment(tx.QueryRow("SELECT "+commentColumns+" FROM comments c WHERE c.id = $1", before.ID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	evs := append([]outboxEvent{{events.CommentUpdated, comment}}, mentionEvents(comment, mentioned)...)
+	rec := auditRecord{Action: "comment.update", TargetType: "comment", TargetID: intPtr(comment.ID), Before: before, After: comment}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteComment удаляет собственный комментарий (администратор - любой).
+// Ответы в ветке сохраняются.
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, ok := lockComment(tx, w, r)
+	if !ok {
+		return
+	}
+	if before.AuthorID != userID && role != "admin" {
+		http.Error(w, "only the author can delete a comment", http.StatusForbidden)
+		return
+	}
+	if before.Deleted {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE comments SET body = '', deleted_at = CURRENT_TIMESTAMP WHERE id = $1", before.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM comment_mentions WHERE comment_id = $1", before.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Текст удаленного комментария не рассылается подписчикам
+	deleted := entities.CommentDeletion{ID: before.ID, DocumentID: before.DocumentID}
+	rec := auditRecord{Action: "comment.delete", TargetType: "comment", TargetID: intPtr(before.ID), Before: before}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CommentDeleted, deleted}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCommentResolved отмечает ветку обсуждения решенной или открывает ее снова
+func (h *CommentHandler) SetCommentResolved(w http.ResponseWriter, r *http.Request) {
+	var req entities.ResolveCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, ok := lockComment(tx, w, r)
+	if !ok {
+		return
+	}
+	if before.ParentID != nil {
+		http.Error(w, "only top-level comments can be resolved", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE comments SET resolved = TRUE, resolved_by = $1, resolved_at = CURRENT_TIMESTAMP WHERE id = $2"
+	args := []any{*currentUserID(r), before.ID}
+	if !req.Resolved {
+		query = "UPDATE comments SET resolved = FALSE, resolved_by = NULL, resolved_at = NULL WHERE id = $1"
+		args = args[1:]
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment, err := scanComment(tx.QueryRow("SELECT "+commentColumns+" FROM comments c WHERE c.id = $1", before.ID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	action := "comment.resolve"
+	if !req.Resolved {
+		action = "comment.reopen"
+	}
+
+	rec := auditRecord{Action: action, TargetType: "comment", TargetID: intPtr(comment.ID), Before: before, After: comment}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CommentResolved, comment}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// activityHiddenActions - действия, которые не попадают в ленту активности
+var activityHiddenActions = []string{"document.view", "document.download", "document.render"}
+
+// GetActivity возвращает ленту активности документа: действия из журнала аудита
+// и комментарии, от новых к старым (не более limit записей, по умолчанию 100)
+func (h *CommentHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
+	docID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.requireDocument(w, docID) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+	SELECT actor_id, action, created_at FROM audit_events
+	WHERE target_type = 'document' AND target_id = $1 AND NOT action = ANY($2)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3`, docID, pq.Array(activityHiddenActions), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []entities.ActivityItem{}
+	for rows.Next() {
+		item := entities.ActivityItem{Kind: entities.ActivityEvent}
+		if err := rows.Scan(&item.ActorID, &item.Action, &item.At); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comments, err := h.loadDocumentComments(docID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, c := range comments {
+		if c.Deleted {
+			continue
+		}
+		comment := c
+		items = append(items, entities.ActivityItem{Kind: entities.ActivityComment, At: c.CreatedAt, ActorID: intPtr(c.AuthorID), Comment: &comment})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].At.After(items[j].At) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
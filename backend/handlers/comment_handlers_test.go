@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/entities"
+)
+
+func TestParseMentions(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"@ivan посмотри, пожалуйста", []string{"ivan"}},
+		{"Согласовано с @petrov.a и @ivan.", []string{"petrov.a", "ivan"}},
+		{"(@ivan), @ivan; @мария", []string{"ivan", "мария"}},
+		{"почта user@example.com не упоминание", []string{}},
+		{"одиночный @ без логина", []string{}},
+	}
+	for _, c := range cases {
+		if got := parseMentions(c.body); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseMentions(%q) = %v, want %v", c.body, got, c.want)
+		}
+	}
+}
+
+func TestBuildCommentTree(t *testing.T) {
+	comments := []entities.Comment{
+		{ID: 1, AuthorID: 1},
+		{ID: 2, ParentID: intPtr(1), AuthorID: 2},
+		{ID: 3, AuthorID: 2},
+		{ID: 4, ParentID: intPtr(2), AuthorID: 1},
+	}
+	tree := buildCommentTree(comments, nil)
+	if len(tree) != 2 || tree[0].ID != 1 || tree[1].ID != 3 {
+		t.Fatalf("roots = %+v", tree)
+	}
+	if len(tree[0].Replies) != 1 || len(tree[0].Replies[0].Replies) != 1 || tree[0].Replies[0].Replies[0].ID != 4 {
+		t.Errorf("replies = %+v", tree[0].Replies)
+	}
+}
+
+func TestMentionEventsSkipAuthor(t *testing.T) {
+	evs := mentionEvents(entities.Comment{ID: 1, AuthorID: 5}, []int{5, 7})
+	if len(evs) != 1 || evs[0].Data.(entities.CommentMention).UserID != 7 {
+		t.Errorf("mentionEvents = %+v", evs)
+	}
+}
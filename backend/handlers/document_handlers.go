@@ -3,49 +3,135 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sort"
 	"strconv"
-	"time"
+	"strings"
 
 	"backend/entities"
+	"backend/events"
 	"backend/middleware"
+	"backend/render"
+	"backend/storage"
+	"backend/upload"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 type DocumentHandler struct {
-	db *sql.DB
+	db         *sql.DB
+	renditions *render.Cache
+	blobs      *storage.Blobs
+	uploads    upload.Policy
 }
 
-func NewDocumentHandler(db *sql.DB) *DocumentHandler {
-	return &DocumentHandler{db: db}
+// NewDocumentHandler принимает хранилище и правила приема файлов, созданные в main
+func NewDocumentHandler(db *sql.DB, blobs *storage.Blobs, uploads upload.Policy) *DocumentHandler {
+	return &DocumentHandler{db: db, renditions: render.NewCacheFromEnv(), blobs: blobs, uploads: uploads}
 }
 
-// GetDocuments возвращает список всех документов
+// GetDocuments возвращает список документов с фильтрами и сортировкой
 func (h *DocumentHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
-	// Получаем параметр category_id из query string
-	categoryID := r.URL.Query().Get("category_id")
-
-	var rows *sql.Rows
-	var err error
+	q := r.URL.Query()
+
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
 
-	if categoryID != "" {
-		if categoryID == "null" {
+	// Получаем параметр category_id из query string
+	var categoryID *int
+	if value := q.Get("category_id"); value != "" {
+		if value == "null" {
 			// Если category_id=null, возвращаем документы без категории
-			rows, err = h.db.Query("SELECT id, title, content, file_path, category_id, user_id, created_at, updated_at FROM documents WHERE category_id IS NULL ORDER BY created_at DESC")
+			conditions = append(conditions, "category_id IS NULL")
 		} else {
 			// Если указан category_id, фильтруем по категории
-			rows, err = h.db.Query("SELECT id, title, content, file_path, category_id, user_id, created_at, updated_at FROM documents WHERE category_id = $1 ORDER BY created_at DESC", categoryID)
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid category_id", http.StatusBadRequest)
+				return
+			}
+			categoryID = &id
+			addCondition("category_id = $%d", id)
+		}
+	}
+	if status := q.Get("status"); status != "" {
+		addCondition("status = $%d", status)
+	}
+	// Документы с тем же файлом (SHA-256 содержимого)
+	if hash := q.Get("file_hash"); hash != "" {
+		addCondition("file_hash = $%d", strings.ToLower(hash))
+	}
+	// Фильтр по тегам: tag_mode=all (по умолчанию) - все теги, any - хотя бы один
+	if value := q.Get("tags"); value != "" {
+		tags, err := normalizeTags(strings.Split(value, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expr, err := tagCondition(q.Get("tag_mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		addCondition(expr, pq.Array(lowerTags(tags)))
+	}
+	// Поиск по регистрационному номеру (подстрока без учета регистра)
+	if number := q.Get("registration_number"); number != "" {
+		addCondition(`registration_number ILIKE '%%' || $%d || '%%' ESCAPE '\'`, likeEscape(number))
+	}
+
+	// Фильтры по метаданным: meta.<поле>=значение, meta.<поле>.gte=значение и т.д.
+	var metaKeys []string
+	for key := range q {
+		if strings.HasPrefix(key, "meta.") {
+			metaKeys = append(metaKeys, key)
+		}
+	}
+	sort.Strings(metaKeys)
+	var fieldTypes map[string][]string
+	if len(metaKeys) > 0 {
+		names := make([]string, len(metaKeys))
+		for i, key := range metaKeys {
+			names[i] = metadataFilterField(key)
+		}
+		var err error
+		fieldTypes, err = metadataFieldTypes(h.db, categoryID, names)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, key := range metaKeys {
+		expr, value, err := metadataCondition(key, q.Get(key), fieldTypes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-	} else {
-		// Иначе возвращаем все документы
-		rows, err = h.db.Query("SELECT id, title, content, file_path, category_id, user_id, created_at, updated_at FROM documents ORDER BY created_at DESC")
+		addCondition(expr, value)
+	}
+
+	order, err := documentOrder(q.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT " + documentColumns + " FROM documents"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
+	query += " ORDER BY " + order
 
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -54,8 +140,7 @@ func (h *DocumentHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
 
 	var documents []entities.Document
 	for rows.Next() {
-		var doc entities.Document
-		err := rows.Scan(&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.CategoryID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
+		doc, err := scanDocument(rows)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -63,6 +148,8 @@ func (h *DocumentHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
 		documents = append(documents, doc)
 	}
 
+	recordAudit(h.db, r, auditRecord{Action: "document.list", TargetType: "document", After: q})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(documents)
 }
@@ -71,7 +158,7 @@ func (h *DocumentHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
 func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 	// Проверяем Content-Type
 	contentType := r.Header.Get("Content-Type")
-	if contentType != "" && contentType[:19] == "multipart/form-data" {
+	if strings.HasPrefix(contentType, "multipart/form-data") {
 		h.createDocumentWithFile(w, r)
 		return
 	}
@@ -85,20 +172,26 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 
 	userID := r.Context().Value(middleware.UserIDContextKey).(int)
 
-	query := `
-	INSERT INTO documents (title, content, category_id, user_id) 
-	VALUES ($1, $2, $3, $4) 
-	RETURNING id, title, content, file_path, category_id, user_id, created_at, updated_at`
-
-	var doc entities.Document
-	err := h.db.QueryRow(query, req.Title, req.Content, req.CategoryID, userID).
-		Scan(&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.CategoryID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
 
+	doc, err := insertDocument(tx, req, documentFile{}, userID)
 	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
+
+	rec := auditRecord{Action: "document.create", TargetType: "document", TargetID: intPtr(doc.ID), After: doc}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentCreated, doc}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", documentETag(doc))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(doc)
@@ -106,8 +199,15 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 
 // createDocumentWithFile обрабатывает multipart/form-data
 func (h *DocumentHandler) createDocumentWithFile(w http.ResponseWriter, r *http.Request) {
+	// Тело ограничено глобальным пределом размера файла с запасом на остальные поля формы
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploads.MaxSize+formOverhead)
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeUploadError(w, &upload.Error{Code: upload.CodeTooLarge, Message: fmt.Sprintf("file is larger than %d bytes", h.uploads.MaxSize), MaxSize: h.uploads.MaxSize})
+			return
+		}
 		http.Error(w, "Ошибка парсинга формы: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -124,43 +224,135 @@ func (h *DocumentHandler) createDocumentWithFile(w http.ResponseWriter, r *http.
 		}
 	}
 
+	// Метаданные передаются JSON-объектом в поле формы metadata
+	var values entities.Metadata
+	if raw := r.FormValue("metadata"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			http.Error(w, "metadata: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Файл сначала пишется во временный каталог: хэш содержимого известен только после записи
+	var staged *storage.Staged
+	var fileName, fileType string
 	file, handler, err := r.FormFile("file")
-	filePath := ""
 	if err == nil && file != nil {
 		defer file.Close()
-		// Сохраняем файл в папку uploads
-		uploadDir := "uploads"
-		os.MkdirAll(uploadDir, 0755)
-		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), handler.Filename)
-		fullPath := filepath.Join(uploadDir, filename)
-		f, err := os.Create(fullPath)
+		fileName = upload.SanitizeFileName(handler.Filename)
+		fileType, err = h.checkUpload(file, fileName, handler.Size, categoryID)
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		staged, err = h.blobs.Stage(file)
 		if err != nil {
 			http.Error(w, "Ошибка сохранения файла: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer f.Close()
-		io.Copy(f, file)
-		filePath = fullPath
+		defer staged.Discard()
 	}
 
 	userID := r.Context().Value(middleware.UserIDContextKey).(int)
-	query := `
-	INSERT INTO documents (title, content, file_path, category_id, user_id) 
-	VALUES ($1, $2, $3, $4, $5) 
-	RETURNING id, title, content, file_path, category_id, user_id, created_at, updated_at`
 
-	var doc entities.Document
-	err = h.db.QueryRow(query, title, content, filePath, categoryID, userID).
-		Scan(&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.CategoryID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var stored documentFile
+	if staged != nil {
+		path, err := h.blobs.Acquire(tx, staged)
+		if err != nil {
+			http.Error(w, "Ошибка сохранения файла: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stored = documentFile{Path: path, Name: fileName, Hash: staged.Hash, Size: staged.Size, Type: fileType}
+	}
+
+	req := entities.CreateDocumentRequest{Title: title, Content: content, CategoryID: categoryID, Metadata: values}
+	doc, err := insertDocument(tx, req, stored, userID)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
 
+	duplicates, err := duplicateDocuments(tx, doc)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	evs := []outboxEvent{{events.DocumentCreated, doc}}
+	if doc.FilePath != "" {
+		evs = append(evs, outboxEvent{events.FileUploaded, map[string]any{"document_id": doc.ID, "file_path": doc.FilePath, "file_name": doc.FileName,
+			"file_hash": doc.FileHash, "duplicate": len(duplicates) > 0}})
+	}
+	rec := auditRecord{Action: "document.create", TargetType: "document", TargetID: intPtr(doc.ID), After: doc}
+	if err := commitAudited(tx, r, rec, evs...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := entities.CreatedDocument{Document: doc, Duplicates: duplicates}
+	if len(duplicates) > 0 {
+		resp.Warning = fmt.Sprintf("the same file is already attached to %d document(s)", len(duplicates))
+	}
+
+	w.Header().Set("ETag", documentETag(doc))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(doc)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// documentFile - сохраненный в хранилище файл документа
+type documentFile struct {
+	Path string
+	Name string
+	Hash string
+	Size int64
+	Type string
+}
+
+// duplicateDocuments возвращает другие документы с тем же файлом
+func duplicateDocuments(q queryer, doc entities.Document) ([]entities.DocumentLink, error) {
+	if doc.FileHash == "" {
+		return nil, nil
+	}
+	rows, err := q.Query("SELECT id, title FROM documents WHERE file_hash = $1 AND id <> $2 ORDER BY id", doc.FileHash, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []entities.DocumentLink
+	for rows.Next() {
+		var link entities.DocumentLink
+		if err := rows.Scan(&link.ID, &link.Title); err != nil {
+			return nil, err
+		}
+		link.URL = fmt.Sprintf("/dock/%d", link.ID)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// insertDocument проверяет метаданные и создает документ в транзакции tx.
+// Ошибка проверки метаданных возвращается как *metadata.ValidationError.
+func insertDocument(tx *sql.Tx, req entities.CreateDocumentRequest, file documentFile, userID int) (entities.Document, error) {
+	meta, err := documentMetadata(tx, req.CategoryID, req.Metadata)
+	if err != nil {
+		return entities.Document{}, err
+	}
+
+	query := `
+	INSERT INTO documents (title, content, file_path, file_name, file_hash, file_size, file_type, scan_status, category_id, user_id, metadata) 
+	VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, ''), CASE WHEN $3 <> '' THEN 'pending' END, $8, $9, $10) 
+	RETURNING ` + documentColumns
+
+	return scanDocument(tx.QueryRow(query, req.Title, req.Content, file.Path, file.Name, file.Hash, file.Size, file.Type, req.CategoryID, userID, meta))
 }
 
 // GetDocument возвращает документ по ID
@@ -172,11 +364,7 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var doc entities.Document
-	query := "SELECT id, title, content, file_path, category_id, user_id, created_at, updated_at FROM documents WHERE id = $1"
-	err = h.db.QueryRow(query, id).
-		Scan(&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.CategoryID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
-
+	doc, err := h.loadDocument(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Document not found", http.StatusNotFound)
@@ -186,6 +374,12 @@ func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(h.db, r, auditRecord{Action: "document.view", TargetType: "document", TargetID: intPtr(doc.ID)})
+
+	if notModified(w, r, documentETag(doc)) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
@@ -205,25 +399,125 @@ func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	before, err := h.loadDocument(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.applyDocumentUpdate(w, r, before, req, expectedVersion(r, before.RowVersion))
+}
+
+// PatchDocument частично обновляет документ по JSON Merge Patch (RFC 7396)
+func (h *DocumentHandler) PatchDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.loadDocument(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	current := entities.UpdateDocumentRequest{Title: before.Title, Content: before.Content, CategoryID: before.CategoryID, Metadata: before.Metadata}
+	if current.Metadata == nil {
+		current.Metadata = entities.Metadata{}
+	}
+	var req entities.UpdateDocumentRequest
+	if status, err := decodeMergePatch(r, current, &req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// "metadata": null очищает все поля; в PUT отсутствие metadata означает "не менять"
+	if req.Metadata == nil {
+		req.Metadata = entities.Metadata{}
+	}
+	if req.Title == "" {
+		http.Error(w, "title cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Патч наложен на прочитанную версию, поэтому обновление всегда условное:
+	// иначе параллельная запись в неуказанные поля была бы потеряна
+	h.applyDocumentUpdate(w, r, before, req, &before.RowVersion)
+}
+
+// applyDocumentUpdate записывает изменения документа. Если expected задан,
+// запись выполняется, только пока row_version не изменилась.
+func (h *DocumentHandler) applyDocumentUpdate(w http.ResponseWriter, r *http.Request, before entities.Document, req entities.UpdateDocumentRequest, expected *int64) {
+	if preconditionFailed(r, documentETag(before)) {
+		http.Error(w, "document has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Редактировать можно только черновики, не заблокированные другим пользователем
+	userID := *currentUserID(r)
+	if status, msg := editConflict(before, userID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
 	query := `
 	UPDATE documents 
-	SET title = $1, content = $2, category_id = $3, updated_at = CURRENT_TIMESTAMP 
-	WHERE id = $4 
-	RETURNING id, title, content, file_path, category_id, user_id, created_at, updated_at`
+	SET title = $1, content = $2, category_id = $3, metadata = $7, updated_at = CURRENT_TIMESTAMP 
+	WHERE id = $4 AND status = 'draft'
+		AND (locked_by IS NULL OR locked_by = $5 OR lock_expires_at <= CURRENT_TIMESTAMP)
+		AND ($6::bigint IS NULL OR row_version = $6)
+	RETURNING ` + documentColumns
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Без metadata в запросе сохраняются текущие значения, проверенные по схеме новой категории
+	if req.Metadata == nil {
+		req.Metadata = before.Metadata
+	}
+	meta, err := documentMetadata(tx, req.CategoryID, req.Metadata)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
 
 	var doc entities.Document
-	err = h.db.QueryRow(query, req.Title, req.Content, req.CategoryID, id).
-		Scan(&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.CategoryID, &doc.UserID, &doc.CreatedAt, &doc.UpdatedAt)
+	err = tx.QueryRow(query, req.Title, req.Content, req.CategoryID, before.ID, userID, expected, meta).
+		Scan(documentFields(&doc)...)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Document not found", http.StatusNotFound)
+		if err == sql.ErrNoRows && r.Header.Get("If-Match") != "" {
+			// Любое изменение строки увеличивает row_version, значит версия клиента устарела
+			http.Error(w, "document has been modified", http.StatusPreconditionFailed)
+		} else if err == sql.ErrNoRows {
+			// Документ успел сменить статус, был заблокирован или удален
+			http.Error(w, "document was changed concurrently: not a draft or checked out by another user", http.StatusConflict)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
+	rec := auditRecord{Action: "document.update", TargetType: "document", TargetID: intPtr(doc.ID), Before: before, After: doc}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentUpdated, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", documentETag(doc))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
@@ -237,7 +531,41 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM documents WHERE id = $1", id)
+	before, err := h.loadDocument(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if preconditionFailed(r, documentETag(before)) {
+		http.Error(w, "document has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Заблокированный другим пользователем документ удалить нельзя
+	userID := *currentUserID(r)
+	if lockedByOther(before, userID) {
+		status, msg := editConflict(before, userID)
+		http.Error(w, msg, status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	expected := expectedVersion(r, before.RowVersion)
+	result, err := tx.Exec(`
+	DELETE FROM documents
+	WHERE id = $1 AND (locked_by IS NULL OR locked_by = $2 OR lock_expires_at <= CURRENT_TIMESTAMP)
+		AND ($3::bigint IS NULL OR row_version = $3)`, id, userID, expected)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -250,25 +578,44 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		if expected != nil {
+			http.Error(w, "document has been modified", http.StatusPreconditionFailed)
+		} else {
+			// Документ успел удалиться или его заблокировал другой пользователь
+			http.Error(w, "document was deleted or checked out concurrently", http.StatusConflict)
+		}
+		return
+	}
+
+	if err := storage.Release(tx, before.FileHash); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.delete", TargetType: "document", TargetID: intPtr(id), Before: before}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentDeleted, before}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// DownloadDocument скачивает файл документа
+// DownloadDocument скачивает файл документа. ?disposition=inline открывает его в браузере
+// (для PDF, изображений, текста и медиа), Range и условные запросы поддерживаются.
 func (h *DocumentHandler) DownloadDocument(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	fmt.Println("DownloadDocument", vars)
-	id, err := strconv.Atoi(vars["id"])
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
+	disposition := r.URL.Query().Get("disposition")
+	if disposition != "" && disposition != "inline" && disposition != "attachment" {
+		http.Error(w, "disposition must be inline or attachment", http.StatusBadRequest)
+		return
+	}
 
-	var filePath, title string
-	err = h.db.QueryRow("SELECT file_path, title FROM documents WHERE id = $1", id).Scan(&filePath, &title)
+	doc, err := h.loadDocument(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Document not found", http.StatusNotFound)
@@ -278,12 +625,75 @@ func (h *DocumentHandler) DownloadDocument(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if filePath == "" {
-		http.Error(w, "Файл не загружен для этого документа", http.StatusNotFound)
+	file, ok := openDocumentFile(w, h.db, h.blobs, doc)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	unchanged, err := setDownloadHeaders(w, r, doc, file, disposition == "inline")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if unchanged {
 		return
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(filePath)))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	http.ServeFile(w, r, filePath)
+	after := map[string]string{"file_path": doc.FilePath}
+	if rng := r.Header.Get("Range"); rng != "" {
+		after["range"] = rng
+	}
+	recordAudit(h.db, r, auditRecord{Action: "document.download", TargetType: "document", TargetID: intPtr(id), After: after})
+
+	serveDocumentFile(w, r, file)
+}
+
+// scannedClean пропускает только файлы, проверенные антивирусом,
+// и отвечает отказом на непроверенные и зараженные
+func scannedClean(w http.ResponseWriter, scanStatus string) bool {
+	switch scanStatus {
+	case entities.ScanClean:
+		return true
+	case entities.ScanInfected:
+		http.Error(w, "file is quarantined: malware detected", http.StatusForbidden)
+	default:
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "file is being scanned for viruses, try again later", http.StatusConflict)
+	}
+	return false
+}
+
+// documentColumns - столбцы documents в порядке documentFields.
+// Истекшая блокировка возвращается как отсутствующая.
+const documentColumns = "id, title, content, COALESCE(file_path, ''), COALESCE(file_name, ''), COALESCE(file_hash, ''), COALESCE(file_size, 0), COALESCE(file_type, ''), COALESCE(scan_status, ''), category_id, user_id, status, registration_number, registered_at, " +
+	"CASE WHEN lock_expires_at > CURRENT_TIMESTAMP THEN locked_by END, CASE WHEN lock_expires_at > CURRENT_TIMESTAMP THEN lock_expires_at END, " +
+	"row_version, ARRAY(SELECT t.name FROM document_tags dt JOIN tags t ON t.id = dt.tag_id WHERE dt.document_id = documents.id ORDER BY lower(t.name)), " +
+	"metadata, created_at, updated_at"
+
+// documentFields возвращает адреса полей документа для Scan по documentColumns
+func documentFields(doc *entities.Document) []any {
+	return []any{&doc.ID, &doc.Title, &doc.Content, &doc.FilePath, &doc.FileName, &doc.FileHash, &doc.FileSize, &doc.FileType, &doc.ScanStatus, &doc.CategoryID, &doc.UserID, &doc.Status, &doc.RegistrationNumber, &doc.RegisteredAt,
+		&doc.LockedBy, &doc.LockExpiresAt, &doc.RowVersion, pq.Array(&doc.Tags), jsonColumn{&doc.Metadata}, &doc.CreatedAt, &doc.UpdatedAt}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDocument читает документ из строки результата по documentColumns
+func scanDocument(row rowScanner) (entities.Document, error) {
+	var doc entities.Document
+	err := row.Scan(documentFields(&doc)...)
+	return doc, err
+}
+
+// documentETag возвращает ETag текущей версии документа
+func documentETag(doc entities.Document) string {
+	return entityTag("document", doc.ID, doc.RowVersion)
+}
+
+// loadDocument читает документ из базы по ID
+func (h *DocumentHandler) loadDocument(id int) (entities.Document, error) {
+	return scanDocument(h.db.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1", id))
 }
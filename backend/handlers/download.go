@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"backend/entities"
+	"backend/storage"
+	"backend/upload"
+)
+
+// openDocumentFile открывает файл документа, прошедший антивирусную проверку.
+// При отказе ответ уже отправлен и возвращается false.
+func openDocumentFile(w http.ResponseWriter, db *sql.DB, blobs *storage.Blobs, doc entities.Document) (*storage.File, bool) {
+	if doc.FilePath == "" {
+		http.Error(w, "Файл не загружен для этого документа", http.StatusNotFound)
+		return nil, false
+	}
+	if !scannedClean(w, doc.ScanStatus) {
+		return nil, false
+	}
+
+	// Файлы в хранилище зашифрованы, поэтому отдаются через расшифровку, а не ServeFile
+	file, err := blobs.Open(db, doc.FilePath, doc.FileHash)
+	if os.IsNotExist(err) {
+		http.Error(w, "file is missing from storage", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return file, true
+}
+
+// downloadName возвращает исходное имя файла: в хранилище файлы названы по хэшу
+func downloadName(doc entities.Document) string {
+	if doc.FileName != "" {
+		return doc.FileName
+	}
+	return filepath.Base(doc.FilePath)
+}
+
+// downloadETag - сильный ETag содержимого: у файлов в хранилище это хэш,
+// у загруженных раньше - время изменения файла
+func downloadETag(doc entities.Document, file *storage.File) string {
+	if doc.FileHash != "" {
+		return `"file-` + doc.FileHash + `"`
+	}
+	return fmt.Sprintf(`"file-%d-%d"`, doc.ID, file.ModTime().UnixNano())
+}
+
+// fileContentType возвращает тип, определенный при загрузке. Для файлов, загруженных
+// до проверки типов, он определяется по первым байтам так же, как при загрузке.
+func fileContentType(doc entities.Document, file io.ReadSeeker) (string, error) {
+	if doc.FileType != "" {
+		return doc.FileType, nil
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return upload.ContentType(filepath.Ext(downloadName(doc)), upload.Sniff(head[:n])), nil
+}
+
+// inlineAllowed сообщает, можно ли показать файл в браузере. Типы, которые браузер
+// исполняет (HTML, SVG и т.п.), всегда отдаются вложением.
+func inlineAllowed(contentType string) bool {
+	switch contentType {
+	case "application/pdf", "text/plain", "image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp":
+		return true
+	}
+	return strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/")
+}
+
+// contentDisposition формирует заголовок по RFC 6266: filename с ASCII-заменой
+// для старых клиентов и filename* в UTF-8, если имя не ASCII
+func contentDisposition(disposition, name string) string {
+	fallback := asciiFileName(name)
+	value := disposition + `; filename="` + fallback + `"`
+	if fallback != name {
+		value += "; filename*=UTF-8''" + encodeExtValue(name)
+	}
+	return value
+}
+
+// asciiFileName заменяет символы, недопустимые в quoted-string или не ASCII, на "_"
+func asciiFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// encodeExtValue кодирует значение по RFC 8187: байты UTF-8 вне attr-char - как %XX
+func encodeExtValue(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// setDownloadHeaders выставляет тип, имя и валидаторы файла и отвечает 304,
+// если у клиента актуальная версия. Остальные условия и Range обрабатывает http.ServeContent.
+func setDownloadHeaders(w http.ResponseWriter, r *http.Request, doc entities.Document, file *storage.File, inline bool) (bool, error) {
+	contentType, err := fileContentType(doc, file)
+	if err != nil {
+		return false, err
+	}
+	disposition := "attachment"
+	if inline && inlineAllowed(contentType) {
+		disposition = "inline"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", contentDisposition(disposition, downloadName(doc)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "private, no-cache")
+	return notModified(w, r, downloadETag(doc, file)), nil
+}
+
+// serveDocumentFile отдает содержимое файла с Last-Modified, поддержкой Range (206),
+// If-Range и If-Modified-Since. Работает с любым хранилищем, дающим io.ReadSeeker.
+func serveDocumentFile(w http.ResponseWriter, r *http.Request, file *storage.File) {
+	http.ServeContent(w, r, "", file.ModTime(), file)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"mime"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, name, want string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "Договор №5.pdf", `inline; filename="_______ _5.pdf"; filename*=UTF-8''%D0%94%D0%BE%D0%B3%D0%BE%D0%B2%D0%BE%D1%80%20%E2%84%965.pdf`},
+		{"attachment", `a "quoted" name.txt`, `attachment; filename="a _quoted_ name.txt"; filename*=UTF-8''a%20%22quoted%22%20name.txt`},
+	}
+	for _, tt := range tests {
+		got := contentDisposition(tt.disposition, tt.name)
+		if got != tt.want {
+			t.Errorf("contentDisposition(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+		// Стандартный разбор предпочитает filename* и возвращает исходное имя
+		if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.name {
+			t.Errorf("parsed %q: %v, %v", got, params, err)
+		}
+	}
+}
+
+func TestInlineAllowed(t *testing.T) {
+	for _, ct := range []string{"application/pdf", "image/png", "text/plain", "video/mp4"} {
+		if !inlineAllowed(ct) {
+			t.Errorf("%s must be shown inline", ct)
+		}
+	}
+	for _, ct := range []string{"text/html", "image/svg+xml", "application/xml", "application/octet-stream"} {
+		if inlineAllowed(ct) {
+			t.Errorf("%s must always be an attachment", ct)
+		}
+	}
+}
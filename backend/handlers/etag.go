@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// entityTag строит сильный ETag из типа, ID и версии строки (row_version)
+func entityTag(kind string, id int, version int64) string {
+	return fmt.Sprintf(`"%s-%d-%d"`, kind, id, version)
+}
+
+// etagListMatches проверяет список ETag из заголовка If-Match/If-None-Match.
+// При сильном сравнении слабые теги (W/"...") не совпадают ни с чем (RFC 9110, 8.8.3.2).
+func etagListMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed сообщает, что If-Match задан и не совпадает с текущим ETag
+func preconditionFailed(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	return header != "" && !etagListMatches(header, etag, false)
+}
+
+// expectedVersion возвращает версию строки, которую должен застать UPDATE/DELETE,
+// если клиент прислал If-Match, иначе nil (условие не проверяется)
+func expectedVersion(r *http.Request, version int64) *int64 {
+	if r.Header.Get("If-Match") == "" {
+		return nil
+	}
+	return &version
+}
+
+// notModified выставляет ETag и отвечает 304, если клиент уже имеет эту версию
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListMatches(header, etag, true) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatching(t *testing.T) {
+	etag := entityTag("document", 7, 3)
+	if etag != `"document-7-3"` {
+		t.Fatalf("entityTag = %s", etag)
+	}
+
+	cases := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"document-7-3"`, false, true},
+		{`"document-7-2", "document-7-3"`, false, true},
+		{`"document-7-2"`, false, false},
+		{`*`, false, true},
+		{`W/"document-7-3"`, false, false},
+		{`W/"document-7-3"`, true, true},
+	}
+	for _, c := range cases {
+		if got := etagListMatches(c.header, etag, c.weak); got != c.want {
+			t.Errorf("etagListMatches(%q, weak=%v) = %v, want %v", c.header, c.weak, got, c.want)
+		}
+	}
+}
+
+func TestConditionalHeaders(t *testing.T) {
+	etag := entityTag("category", 1, 5)
+
+	r := httptest.NewRequest("PUT", "/categories/1", nil)
+	if preconditionFailed(r, etag) || expectedVersion(r, 5) != nil {
+		t.Error("request without If-Match must be unconditional")
+	}
+	r.Header.Set("If-Match", `"category-1-4"`)
+	if !preconditionFailed(r, etag) {
+		t.Error("stale If-Match must fail")
+	}
+	if v := expectedVersion(r, 5); v == nil || *v != 5 {
+		t.Errorf("expectedVersion = %v, want 5", v)
+	}
+
+	r = httptest.NewRequest("GET", "/categories/1", nil)
+	r.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	if !notModified(w, r, etag) || w.Code != 304 || w.Header().Get("ETag") != etag {
+		t.Errorf("notModified: code %d, etag %q", w.Code, w.Header().Get("ETag"))
+	}
+}
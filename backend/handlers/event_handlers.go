@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/events"
+)
+
+// keepAliveInterval - период комментариев-пингов, не дающих прокси закрыть соединение
+const keepAliveInterval = 15 * time.Second
+
+// eventSource - источник событий потока (events.Hub)
+type eventSource interface {
+	Subscribe() chan events.Event
+	Unsubscribe(ch chan events.Event)
+	Since(lastID int64) ([]events.Event, error)
+	Head() (int64, error)
+}
+
+type EventStreamHandler struct {
+	db  *sql.DB
+	hub eventSource
+}
+
+func NewEventStreamHandler(db *sql.DB) *EventStreamHandler {
+	return &EventStreamHandler{db: db, hub: events.NewHub(db)}
+}
+
+// streamCursor отслеживает события, прошедшие через поток. Id событий выдаются до коммита,
+// поэтому событие с меньшим id может прийти после большего: недавние id хранятся в пределах
+// окна events.LateCommitWindow, а позиция resume сдвигается только за пределы окна -
+// все события с id не больше resume уже обработаны.
+type streamCursor struct {
+	resume int64
+	recent map[int64]time.Time
+}
+
+func newStreamCursor(resume int64) *streamCursor {
+	return &streamCursor{resume: resume, recent: map[int64]time.Time{}}
+}
+
+// add отмечает событие и возвращает false, если оно уже прошло через поток.
+// at - когда событие стало известно: для новых событий - now, для истории - время создания,
+// чтобы при длинной истории позиция шла вперед, не дожидаясь окна для каждого события.
+func (c *streamCursor) add(id int64, at, now time.Time) bool {
+	if _, ok := c.recent[id]; ok {
+		return false
+	}
+	c.recent[id] = at
+	cutoff := now.Add(-events.LateCommitWindow)
+	for seen, at := range c.recent {
+		if at.Before(cutoff) {
+			if seen > c.resume {
+				c.resume = seen
+			}
+			delete(c.recent, seen)
+		}
+	}
+	return true
+}
+
+// eventVisible решает, может ли пользователь видеть событие. Документы, категории, файлы
+// и комментарии доступны всем авторизованным пользователям; поручения - автору, исполнителю
+// и администраторам; публичные ссылки - создателю и администраторам; упоминания и выгрузки -
+// только адресату. События неизвестных типов не отдаются.
+func eventVisible(userID int, admin bool, e events.Event) bool {
+	if e.Type == events.CommentMentioned {
+		var mention struct {
+			UserID int `json:"user_id"`
+		}
+		return json.Unmarshal(e.Data, &mention) == nil && mention.UserID == userID
+	}
+
+	group, _, _ := strings.Cut(e.Type, ".")
+	switch group {
+	case "document", "category", "file", "comment":
+		return true
+	case "task":
+		var task struct {
+			AssigneeID int `json:"assignee_id"`
+			AuthorID   int `json:"author_id"`
+		}
+		if json.Unmarshal(e.Data, &task) != nil {
+			return false
+		}
+		return admin || task.AssigneeID == userID || task.AuthorID == userID
+	case "link":
+		var link struct {
+			CreatedBy int `json:"created_by"`
+		}
+		return json.Unmarshal(e.Data, &link) == nil && (admin || link.CreatedBy == userID)
+	case "export":
+		var job struct {
+			CreatedBy int `json:"created_by"`
+		}
+		return json.Unmarshal(e.Data, &job) == nil && job.CreatedBy == userID
+	}
+	return false
+}
+
+// StreamEvents отдает изменения как Server-Sent Events; пользователь получает только видимые ему события.
+// Поддерживает возобновление по заголовку Last-Event-ID и фильтр ?types=document.*,category.*
+func (h *EventStreamHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	var (
+		lastID  int64
+		resumed bool
+	)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID, resumed = id, true
+	}
+
+	patterns := []string{"*"}
+	if types := r.URL.Query().Get("types"); types != "" {
+		patterns = strings.Split(types, ",")
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	admin := role == "admin"
+
+	h.stream(w, r, lastID, resumed, func(e events.Event) bool {
+		return matchesAny(patterns, e.Type) && eventVisible(userID, admin, e)
+	})
+}
+
+// stream пишет события в ответ до отключения клиента. В id события SSE передается позиция
+// возобновления, а не id самого события, поэтому после переподключения события последних
+// секунд могут прийти повторно; клиент отличает их по полю id в данных.
+func (h *EventStreamHandler) stream(w http.ResponseWriter, r *http.Request, lastID int64, resumed bool, wanted func(events.Event) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Подписываемся до чтения истории, чтобы не потерять события между ними
+	ch := h.hub.Subscribe()
+	defer h.hub.Unsubscribe(ch)
+
+	// Все, что после head, придет из хаба; историю до head клиент получает страницами
+	head, err := h.hub.Head()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !resumed {
+		lastID = head
+	}
+	cursor := newStreamCursor(lastID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	send := func(e events.Event, at time.Time) bool {
+		// Отфильтрованные события тоже отмечаются, чтобы позиция возобновления шла вперед
+		if !cursor.add(e.ID, at, time.Now()) || !wanted(e) {
+			return true
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", cursor.resume, e.Type, data)
+		return err == nil
+	}
+
+	// Since отдает ограниченную страницу, поэтому историю дочитываем до head
+	for pos := lastID; pos < head; {
+		page, err := h.hub.Since(pos)
+		if err != nil {
+			log.Printf("events: replay since %d: %v", pos, err)
+			return
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, e := range page {
+			if !send(e, e.OccurredAt) {
+				return
+			}
+		}
+		flusher.Flush()
+		pos = page[len(page)-1].ID
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// Хаб отключил медленного клиента; EventSource переподключится сам
+				return
+			}
+			if !send(e, time.Now()) {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func matchesAny(patterns []string, eventType string) bool {
+	for _, p := range patterns {
+		if events.Matches(strings.TrimSpace(p), eventType) {
+			return true
+		}
+	}
+	return false
+}
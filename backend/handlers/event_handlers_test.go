@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/events"
+)
+
+// fakeSource отдает историю из outbox страницами по limit событий (0 - без ограничения)
+// и заранее заданные новые события, после чего закрывает канал, как хаб при отключении клиента
+type fakeSource struct {
+	outbox []events.Event
+	live   []events.Event
+	limit  int
+	since  int64
+}
+
+func (s *fakeSource) Subscribe() chan events.Event {
+	ch := make(chan events.Event, len(s.live))
+	for _, e := range s.live {
+		ch <- e
+	}
+	close(ch)
+	return ch
+}
+
+func (s *fakeSource) Unsubscribe(chan events.Event) {}
+
+func (s *fakeSource) Since(lastID int64) ([]events.Event, error) {
+	s.since = lastID
+	var result []events.Event
+	for _, e := range s.outbox {
+		if e.ID > lastID && (s.limit == 0 || len(result) < s.limit) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeSource) Head() (int64, error) {
+	var head int64
+	for _, e := range s.outbox {
+		head = max(head, e.ID)
+	}
+	return head, nil
+}
+
+func event(id int64, eventType string, data any) events.Event {
+	payload, _ := json.Marshal(data)
+	return events.Event{ID: id, Type: eventType, Data: payload, OccurredAt: time.Now()}
+}
+
+var sentEvent = regexp.MustCompile(`(?m)^data: (\{.*\})$`)
+
+// streamIDs возвращает id событий, отправленных в поток, по порядку
+func streamIDs(t *testing.T, body string) []int64 {
+	t.Helper()
+	var ids []int64
+	for _, m := range sentEvent.FindAllStringSubmatch(body, -1) {
+		var e events.Event
+		if err := json.Unmarshal([]byte(m[1]), &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func runStream(source *fakeSource, lastEventID string, wanted func(events.Event) bool) string {
+	h := &EventStreamHandler{hub: source}
+	r := httptest.NewRequest("GET", "/events", nil)
+	w := httptest.NewRecorder()
+	var lastID int64
+	if lastEventID != "" {
+		fmt.Sscan(lastEventID, &lastID)
+	}
+	h.stream(w, r, lastID, lastEventID != "", wanted)
+	return w.Body.String()
+}
+
+func all(events.Event) bool { return true }
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	source := &fakeSource{
+		outbox: []events.Event{
+			event(4, events.DocumentCreated, nil),
+			event(5, events.DocumentCreated, nil),
+			event(6, events.DocumentUpdated, nil),
+		},
+		// Событие 6 пришло и из истории, и из хаба; 8 закоммичено раньше 7
+		live: []events.Event{event(6, events.DocumentUpdated, nil), event(8, events.DocumentUpdated, nil), event(7, events.DocumentDeleted, nil)},
+	}
+	body := runStream(source, "4", all)
+	if source.since != 4 {
+		t.Errorf("replayed since %d, want 4", source.since)
+	}
+	if got := fmt.Sprint(streamIDs(t, body)); got != "[5 6 8 7]" {
+		t.Errorf("sent %s, want [5 6 8 7]", got)
+	}
+	// Позиция возобновления не обгоняет события, которые еще могут прийти с меньшим id
+	if strings.Contains(body, "id: 8\n") {
+		t.Error("resume position must not jump to the largest id seen")
+	}
+}
+
+func TestStreamReplaysAllPages(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	source := &fakeSource{limit: 2}
+	for id := int64(1); id <= 5; id++ {
+		e := event(id, events.DocumentCreated, nil)
+		e.OccurredAt = old
+		source.outbox = append(source.outbox, e)
+	}
+	body := runStream(source, "0", all)
+	if got := fmt.Sprint(streamIDs(t, body)); got != "[1 2 3 4 5]" {
+		t.Errorf("sent %s, want the whole backlog", got)
+	}
+	// Старые события из истории сразу сдвигают позицию возобновления
+	if !strings.Contains(body, "id: 4\n") {
+		t.Errorf("resume position must follow the replayed history:\n%s", body)
+	}
+}
+
+func TestStreamStartsAtHead(t *testing.T) {
+	source := &fakeSource{
+		outbox: []events.Event{event(1, events.DocumentCreated, nil), event(2, events.DocumentCreated, nil)},
+		live:   []events.Event{event(3, events.DocumentCreated, nil)},
+	}
+	body := runStream(source, "", all)
+	if got := fmt.Sprint(streamIDs(t, body)); got != "[3]" {
+		t.Errorf("sent %s, want only new events", got)
+	}
+	if !strings.Contains(body, "id: 2\n") {
+		t.Errorf("resume position must start at the outbox head:\n%s", body)
+	}
+}
+
+func TestStreamFiltersEvents(t *testing.T) {
+	source := &fakeSource{live: []events.Event{
+		event(1, events.DocumentCreated, nil),
+		event(2, events.TaskCreated, map[string]int{"assignee_id": 7, "author_id": 8}),
+		event(3, events.TaskCreated, map[string]int{"assignee_id": 1, "author_id": 2}),
+	}}
+	body := runStream(source, "", func(e events.Event) bool { return eventVisible(1, false, e) })
+	if got := fmt.Sprint(streamIDs(t, body)); got != "[1 3]" {
+		t.Errorf("sent %s, want [1 3]", got)
+	}
+}
+
+func TestStreamCursorLateCommit(t *testing.T) {
+	now := time.Now()
+	c := newStreamCursor(10)
+	if !c.add(12, now, now) || !c.add(11, now, now) {
+		t.Fatal("event committed late must be delivered")
+	}
+	if c.add(12, now, now) {
+		t.Error("event must be delivered once")
+	}
+	if c.resume != 10 {
+		t.Errorf("resume = %d, must wait for the late commit window", c.resume)
+	}
+	later := now.Add(events.LateCommitWindow + time.Second)
+	c.add(13, later, later)
+	if c.resume != 12 {
+		t.Errorf("resume = %d, want 12 after the window", c.resume)
+	}
+}
+
+func TestEventVisible(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  int
+		admin bool
+		e     events.Event
+		want  bool
+	}{
+		{"document", 1, false, event(1, events.DocumentUpdated, nil), true},
+		{"comment", 1, false, event(1, events.CommentCreated, nil), true},
+		{"own mention", 1, false, event(1, events.CommentMentioned, map[string]int{"user_id": 1}), true},
+		{"other mention", 1, true, event(1, events.CommentMentioned, map[string]int{"user_id": 2}), false},
+		{"assigned task", 1, false, event(1, events.TaskOverdue, map[string]int{"assignee_id": 1, "author_id": 2}), true},
+		{"other task", 1, false, event(1, events.TaskUpdated, map[string]int{"assignee_id": 3, "author_id": 2}), false},
+		{"task for admin", 1, true, event(1, events.TaskUpdated, map[string]int{"assignee_id": 3, "author_id": 2}), true},
+		{"own link", 1, false, event(1, events.LinkDownloaded, map[string]int{"created_by": 1}), true},
+		{"other link", 1, false, event(1, events.LinkCreated, map[string]int{"created_by": 2}), false},
+		{"link for admin", 1, true, event(1, events.LinkRevoked, map[string]int{"created_by": 2}), true},
+		{"own export", 1, false, event(1, events.ExportCompleted, map[string]int{"created_by": 1}), true},
+		{"other export", 1, true, event(1, events.ExportFailed, map[string]int{"created_by": 2}), false},
+		{"unknown type", 1, true, event(1, "secret.created", nil), false},
+	}
+	for _, tt := range tests {
+		if got := eventVisible(tt.user, tt.admin, tt.e); got != tt.want {
+			t.Errorf("%s: eventVisible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"backend/events"
+)
+
+// outboxEvent - событие, публикуемое вместе с изменением
+type outboxEvent struct {
+	Type string
+	Data any
+}
+
+// commitWithEvents записывает события в outbox и фиксирует транзакцию,
+// так что событие появляется тогда и только тогда, когда сохранено изменение
+func commitWithEvents(tx *sql.Tx, evs ...outboxEvent) error {
+	for _, e := range evs {
+		if err := events.Publish(tx, e.Type, e.Data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/upload"
+
+	"github.com/lib/pq"
+)
+
+// Имена в архиве выгрузки
+const (
+	exportManifestName  = "export.json"
+	exportMetadataName  = "document.json"
+	uncategorizedFolder = "Без категории"
+)
+
+// exportManifest - оглавление архива (export.json в корне)
+type exportManifest struct {
+	CreatedAt time.Time             `json:"created_at"`
+	Filter    entities.ExportFilter `json:"filter"`
+	Documents []exportEntry         `json:"documents"`
+}
+
+// exportEntry - документ в оглавлении. Skipped - почему файл документа не попал в архив.
+type exportEntry struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Folder  string `json:"folder"`
+	File    string `json:"file,omitempty"`
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// exportOpener открывает файл документа или возвращает причину, по которой его нельзя выгрузить
+type exportOpener func(doc entities.Document) (io.ReadCloser, string, error)
+
+// errExportForbidden - выгрузка чужих документов без прав администратора
+var errExportForbidden = errors.New("only administrators can export documents of other users")
+
+// exportScope ограничивает выгрузку пользователя его документами; администратор
+// может выгрузить документы любого автора или все документы
+func exportScope(f entities.ExportFilter, userID int, admin bool) (entities.ExportFilter, error) {
+	if admin {
+		return f, nil
+	}
+	if f.UserID != nil && *f.UserID != userID {
+		return f, errExportForbidden
+	}
+	f.UserID = &userID
+	return f, nil
+}
+
+// exportConditions проверяет фильтр и возвращает условие WHERE для documents с аргументами
+func exportConditions(f entities.ExportFilter) (string, []any, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if f.CategoryID != nil {
+		switch {
+		case *f.CategoryID < 0:
+			return "", nil, fmt.Errorf("invalid category_id")
+		case *f.CategoryID == 0:
+			conditions = append(conditions, "category_id IS NULL")
+		default:
+			addCondition("category_id = $%d", *f.CategoryID)
+		}
+	}
+	expr, err := tagCondition(f.TagMode)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(f.Tags) > 0 {
+		tags, err := normalizeTags(f.Tags)
+		if err != nil {
+			return "", nil, err
+		}
+		addCondition(expr, pq.Array(lowerTags(tags)))
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return "", nil, fmt.Errorf("from must be before to")
+	}
+	if f.From != nil {
+		addCondition("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		addCondition("created_at < $%d", *f.To)
+	}
+	if len(f.IDs) > entities.ExportMaxIDs {
+		return "", nil, fmt.Errorf("at most %d ids can be exported at once", entities.ExportMaxIDs)
+	}
+	if len(f.IDs) > 0 {
+		ids := make([]int64, len(f.IDs))
+		for i, id := range f.IDs {
+			if id <= 0 {
+				return "", nil, fmt.Errorf("invalid document id %d", id)
+			}
+			ids[i] = int64(id)
+		}
+		addCondition("id = ANY($%d)", pq.Array(ids))
+	}
+	if f.UserID != nil {
+		addCondition("user_id = $%d", *f.UserID)
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", nil, nil
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// exportInBackground сообщает, собирать ли архив в фоне вместо ответа на запрос
+func exportInBackground(async bool, documents int, size int64) bool {
+	return async || documents > entities.ExportSyncDocuments || size > entities.ExportSyncBytes
+}
+
+// exportFileName - имя архива для скачивания
+func exportFileName(createdAt time.Time) string {
+	return "export-" + createdAt.UTC().Format("20060102-150405") + ".zip"
+}
+
+// exportName приводит название к имени файла или папки в архиве
+func exportName(name string) string {
+	return upload.SanitizeFileName(strings.NewReplacer("/", "_", `\`, "_").Replace(name))
+}
+
+// exportFolders возвращает папки категорий. Имена, совпадающие без учета регистра,
+// дополняются номером категории, чтобы архив распаковывался и в Windows.
+func exportFolders(categories []entities.Category) map[int]string {
+	folders := map[int]string{}
+	used := map[string]bool{strings.ToLower(uncategorizedFolder): true}
+	for _, c := range categories {
+		name := exportName(c.Name)
+		if used[strings.ToLower(name)] {
+			name = fmt.Sprintf("%s (%d)", name, c.ID)
+		}
+		used[strings.ToLower(name)] = true
+		folders[c.ID] = name
+	}
+	return folders
+}
+
+// exportFolder возвращает папку документа: <категория>/<номер> <название>
+func exportFolder(doc entities.Document, folders map[int]string) string {
+	category := uncategorizedFolder
+	if doc.CategoryID != nil {
+		if name, ok := folders[*doc.CategoryID]; ok {
+			category = name
+		}
+	}
+	return category + "/" + exportName(fmt.Sprintf("%d %s", doc.ID, doc.Title))
+}
+
+// alreadyCompressed сообщает, что формат уже сжат и повторное сжатие только тратит время
+func alreadyCompressed(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp",
+		"application/zip", "application/gzip", "application/x-7z-compressed", "application/vnd.rar":
+		return true
+	}
+	return strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/") ||
+		strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument.")
+}
+
+// writeExport пишет ZIP выгрузки: в папке каждого документа - document.json с его полями
+// и приложенный файл, в корне - export.json со списком документов и пропущенных файлов.
+// progress, если задан, вызывается после каждого документа; его ошибка прерывает запись.
+func writeExport(w io.Writer, docs []entities.Document, folders map[int]string, manifest exportManifest, open exportOpener, progress func() error) error {
+	zw := zip.NewWriter(w)
+	manifest.Documents = []exportEntry{}
+	for _, doc := range docs {
+		entry, err := writeExportDocument(zw, doc, exportFolder(doc, folders), open)
+		if err != nil {
+			return fmt.Errorf("document %d: %w", doc.ID, err)
+		}
+		manifest.Documents = append(manifest.Documents, entry)
+		if progress != nil {
+			if err := progress(); err != nil {
+				return err
+			}
+		}
+	}
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: exportManifestName, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeExportDocument(zw *zip.Writer, doc entities.Document, folder string, open exportOpener) (exportEntry, error) {
+	entry := exportEntry{ID: doc.ID, Title: doc.Title, Folder: folder}
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: folder + "/" + exportMetadataName, Method: zip.Deflate, Modified: doc.UpdatedAt})
+	if err != nil {
+		return entry, err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return entry, err
+	}
+	if doc.FilePath == "" {
+		return entry, nil
+	}
+
+	file, skipped, err := open(doc)
+	if err != nil {
+		return entry, err
+	}
+	if skipped != "" {
+		entry.Skipped = skipped
+		return entry, nil
+	}
+	defer file.Close()
+
+	name := exportName(downloadName(doc))
+	if strings.EqualFold(name, exportMetadataName) {
+		name = "_" + name
+	}
+	method := zip.Deflate
+	if alreadyCompressed(doc.FileType) {
+		method = zip.Store
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: folder + "/" + name, Method: method, Modified: doc.UpdatedAt})
+	if err != nil {
+		return entry, err
+	}
+	if _, err := io.Copy(fw, file); err != nil {
+		return entry, err
+	}
+	entry.File = folder + "/" + name
+	return entry, nil
+}
@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+	"backend/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// exportLease - на это время фоновая выгрузка резервируется за обработчиком; продлевается по ходу записи
+	exportLease = 10 * time.Minute
+	// exportRetryDelay - пауза перед повтором выгрузки после ошибки
+	exportRetryDelay  = time.Minute
+	exportMaxAttempts = 3
+)
+
+// ExportHandler выгружает документы с файлами в ZIP. Небольшие наборы отдаются в ответе,
+// большие собираются в фоне (RunJobs) и скачиваются по ссылке.
+type ExportHandler struct {
+	db    *sql.DB
+	blobs *storage.Blobs
+	dir   string
+}
+
+// NewExportHandler хранит готовые архивы в каталоге EXPORT_DIR (по умолчанию exports)
+func NewExportHandler(db *sql.DB, blobs *storage.Blobs) *ExportHandler {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = "exports"
+	}
+	return &ExportHandler{db: db, blobs: blobs, dir: dir}
+}
+
+const exportJobColumns = "id, status, filter, document_count, size, error, created_by, created_at, finished_at, expires_at"
+
+func exportJobFields(j *entities.ExportJob) []any {
+	return []any{&j.ID, &j.Status, jsonColumn{&j.Filter}, &j.DocumentCount, &j.Size, &j.Error, &j.CreatedBy, &j.CreatedAt, &j.FinishedAt, &j.ExpiresAt}
+}
+
+// withExportURL добавляет ссылку на скачивание готового архива
+func withExportURL(j entities.ExportJob) entities.ExportJob {
+	if j.Status == entities.ExportDone {
+		j.URL = fmt.Sprintf("/exports/%d/download", j.ID)
+	}
+	return j
+}
+
+// CreateExport выгружает документы по фильтру. Если набор небольшой, ZIP отдается сразу,
+// иначе создается фоновая выгрузка и возвращается 202 со ссылкой на ее состояние.
+func (h *ExportHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	var req entities.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.ExportFilter, err = exportScope(req.ExportFilter, userID, role == "admin")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	where, args, err := exportConditions(req.ExportFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		count int
+		size  int64
+	)
+	err = h.db.QueryRow("SELECT count(*), COALESCE(sum(file_size), 0) FROM documents WHERE "+where, args...).Scan(&count, &size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		http.Error(w, "no documents match the filter", http.StatusNotFound)
+		return
+	}
+
+	if !exportInBackground(req.Async, count, size) {
+		h.streamExport(w, r, req.ExportFilter, where, args)
+		return
+	}
+
+	filter, err := json.Marshal(req.ExportFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var job entities.ExportJob
+	err = tx.QueryRow(`
+	INSERT INTO export_jobs (created_by, filter, document_count) VALUES ($1, $2, $3)
+	RETURNING `+exportJobColumns, userID, filter, count).Scan(exportJobFields(&job)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "document.export", TargetType: "export", TargetID: intPtr(job.ID), After: job}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// streamExport пишет архив прямо в ответ, не сохраняя его на диск
+func (h *ExportHandler) streamExport(w http.ResponseWriter, r *http.Request, filter entities.ExportFilter, where string, args []any) {
+	docs, err := h.exportDocuments(where, args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	folders, err := h.loadExportFolders()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(h.db, r, auditRecord{Action: "document.export", TargetType: "document", After: map[string]any{"filter": filter, "documents": len(docs)}})
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", exportFileName(now)))
+	w.Header().Set("Cache-Control", "no-store")
+	manifest := exportManifest{CreatedAt: now, Filter: filter}
+	if err := writeExport(w, docs, folders, manifest, h.openExportFile, nil); err != nil {
+		// Заголовки уже отправлены: обрываем соединение, чтобы неполный архив не приняли за целый
+		log.Printf("export: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportDocuments загружает документы по условию exportConditions
+func (h *ExportHandler) exportDocuments(where string, args []any) ([]entities.Document, error) {
+	rows, err := h.db.Query("SELECT "+documentColumns+" FROM documents WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []entities.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// loadExportFolders возвращает папки архива для всех категорий
+func (h *ExportHandler) loadExportFolders() (map[int]string, error) {
+	rows, err := h.db.Query("SELECT id, name FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []entities.Category
+	for rows.Next() {
+		var c entities.Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return exportFolders(categories), nil
+}
+
+// openExportFile открывает файл документа. Непроверенные, зараженные и потерянные файлы
+// пропускаются с причиной в оглавлении архива.
+func (h *ExportHandler) openExportFile(doc entities.Document) (io.ReadCloser, string, error) {
+	switch doc.ScanStatus {
+	case entities.ScanClean:
+	case entities.ScanInfected:
+		return nil, "file is quarantined: malware detected", nil
+	default:
+		return nil, "file is being scanned for viruses", nil
+	}
+	file, err := h.blobs.Open(h.db, doc.FilePath, doc.FileHash)
+	if os.IsNotExist(err) {
+		return nil, "file is missing from storage", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return file, "", nil
+}
+
+// GetExports возвращает фоновые выгрузки текущего пользователя, начиная с новых
+func (h *ExportHandler) GetExports(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT "+exportJobColumns+" FROM export_jobs WHERE created_by = $1 ORDER BY id DESC LIMIT 50", *currentUserID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	jobs := []entities.ExportJob{}
+	for rows.Next() {
+		var job entities.ExportJob
+		if err := rows.Scan(exportJobFields(&job)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jobs = append(jobs, withExportURL(job))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// ownExport загружает выгрузку текущего пользователя. Чужие выгрузки не видны.
+// При отказе ответ уже отправлен.
+func (h *ExportHandler) ownExport(w http.ResponseWriter, r *http.Request) (entities.ExportJob, bool) {
+	var job entities.ExportJob
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return job, false
+	}
+	err = h.db.QueryRow("SELECT "+exportJobColumns+" FROM export_jobs WHERE id = $1 AND created_by = $2", id, *currentUserID(r)).
+		Scan(exportJobFields(&job)...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return job, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return job, false
+	}
+	return job, true
+}
+
+// GetExport возвращает состояние фоновой выгрузки
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownExport(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withExportURL(job))
+}
+
+// DownloadExport отдает готовый архив фоновой выгрузки с поддержкой докачки
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownExport(w, r)
+	if !ok {
+		return
+	}
+	switch job.Status {
+	case entities.ExportDone:
+	case entities.ExportPending, entities.ExportRunning:
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "export is not ready yet", http.StatusConflict)
+		return
+	case entities.ExportFailed:
+		http.Error(w, "export failed, create a new one", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "export has expired", http.StatusGone)
+		return
+	}
+	if job.ExpiresAt != nil && !time.Now().Before(*job.ExpiresAt) {
+		http.Error(w, "export has expired", http.StatusGone)
+		return
+	}
+
+	var (
+		path, keyID string
+		wrapped     []byte
+	)
+	err := h.db.QueryRow("SELECT file_path, key_id, wrapped_key FROM export_jobs WHERE id = $1", job.ID).Scan(&path, &keyID, &wrapped)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	file, err := h.blobs.OpenSealed(path, keyID, wrapped)
+	if os.IsNotExist(err) {
+		http.Error(w, "export has expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", exportFileName(job.CreatedAt)))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if notModified(w, r, fmt.Sprintf(`"export-%d"`, job.ID)) {
+		return
+	}
+	var after any
+	if rng := r.Header.Get("Range"); rng != "" {
+		after = map[string]any{"range": rng}
+	}
+	recordAudit(h.db, r, auditRecord{Action: "export.download", TargetType: "export", TargetID: intPtr(job.ID), After: after})
+	serveDocumentFile(w, r, file)
+}
+
+// RunJobs выполняет фоновые выгрузки и удаляет архивы с истекшим сроком до закрытия stop
+func (h *ExportHandler) RunJobs(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for {
+				ran, err := h.runNextJob()
+				if err != nil {
+					log.Printf("export: %v", err)
+				}
+				if !ran || err != nil {
+					break
+				}
+			}
+			if err := h.removeExpired(); err != nil {
+				log.Printf("export: cleanup failed: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runNextJob резервирует и выполняет одну выгрузку: новую или брошенную обработчиком,
+// чья аренда истекла. Возвращает false, если выполнять нечего.
+func (h *ExportHandler) runNextJob() (bool, error) {
+	var (
+		job      entities.ExportJob
+		attempts int
+	)
+	err := h.db.QueryRow(`
+	UPDATE export_jobs SET status = 'running', attempts = attempts + 1, lease_until = NOW() + $1 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM export_jobs
+		WHERE status = 'pending' OR status = 'running' AND lease_until < NOW()
+		ORDER BY id LIMIT 1
+		FOR UPDATE SKIP LOCKED)
+	RETURNING attempts, `+exportJobColumns, exportLease.Seconds()).Scan(append([]any{&attempts}, exportJobFields(&job)...)...)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if attempts > exportMaxAttempts {
+		return true, h.failJob(job.ID, attempts, "export was interrupted too many times")
+	}
+
+	tmp, documents, err := h.buildArchive(job, attempts)
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+	if err == nil {
+		err = h.finishJob(job.ID, attempts, tmp, documents)
+	}
+	if err != nil {
+		log.Printf("export %d (attempt %d): %v", job.ID, attempts, err)
+		if attempts >= exportMaxAttempts {
+			return true, h.failJob(job.ID, attempts, err.Error())
+		}
+		// Повтор - после паузы, когда истечет аренда
+		_, err := h.db.Exec("UPDATE export_jobs SET lease_until = NOW() + $3 * INTERVAL '1 second' WHERE id = $1 AND attempts = $2",
+			job.ID, attempts, exportRetryDelay.Seconds())
+		return true, err
+	}
+	return true, nil
+}
+
+// countingWriter считает записанные байты
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// buildArchive записывает зашифрованный архив во временный файл и возвращает его путь
+// и число документов. Ключ архива сохраняется в export_jobs сразу, а файл переносится в finishJob.
+func (h *ExportHandler) buildArchive(job entities.ExportJob, attempts int) (string, int, error) {
+	// Права автора проверяются заново: его могли лишить роли администратора
+	role, err := userRole(h.db, job.CreatedBy)
+	if err != nil {
+		return "", 0, err
+	}
+	filter, err := exportScope(job.Filter, job.CreatedBy, role == "admin")
+	if err != nil {
+		return "", 0, err
+	}
+	where, args, err := exportConditions(filter)
+	if err != nil {
+		return "", 0, err
+	}
+	docs, err := h.exportDocuments(where, args)
+	if err != nil {
+		return "", 0, err
+	}
+	folders, err := h.loadExportFolders()
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(h.dir, "export-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer tmp.Close()
+
+	enc, keyID, wrapped, err := h.blobs.Seal(tmp)
+	if err != nil {
+		return tmp.Name(), 0, err
+	}
+	counter := &countingWriter{w: enc}
+	extended := time.Now()
+	progress := func() error {
+		if time.Since(extended) < exportLease/4 {
+			return nil
+		}
+		extended = time.Now()
+		return h.extendLease(job.ID, attempts)
+	}
+	manifest := exportManifest{CreatedAt: time.Now().UTC(), Filter: filter}
+	if err := writeExport(counter, docs, folders, manifest, h.openExportFile, progress); err != nil {
+		return tmp.Name(), 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return tmp.Name(), 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return tmp.Name(), 0, err
+	}
+
+	_, err = h.db.Exec("UPDATE export_jobs SET key_id = $3, wrapped_key = $4, size = $5 WHERE id = $1 AND attempts = $2",
+		job.ID, attempts, keyID, wrapped, counter.n)
+	return tmp.Name(), len(docs), err
+}
+
+// extendLease продлевает аренду выгрузки. Ошибка означает, что выгрузку забрал другой обработчик.
+func (h *ExportHandler) extendLease(id, attempts int) error {
+	res, err := h.db.Exec("UPDATE export_jobs SET lease_until = NOW() + $3 * INTERVAL '1 second' WHERE id = $1 AND attempts = $2 AND status = 'running'",
+		id, attempts, exportLease.Seconds())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("export %d was taken over by another worker", id)
+	}
+	return nil
+}
+
+// finishJob переносит архив на место и отмечает выгрузку готовой. Строка заблокирована
+// до фиксации, поэтому другой обработчик не подменит файл.
+func (h *ExportHandler) finishJob(id, attempts int, tmp string, documents int) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	path := filepath.Join(h.dir, fmt.Sprintf("export-%d.zip", id))
+	var job entities.ExportJob
+	err = tx.QueryRow(`
+	UPDATE export_jobs
+	SET status = 'done', file_path = $3, document_count = $4, finished_at = NOW(),
+		expires_at = NOW() + $5 * INTERVAL '1 hour', lease_until = NULL
+	WHERE id = $1 AND attempts = $2 AND status = 'running'
+	RETURNING `+exportJobColumns, id, attempts, path, documents, entities.ExportKeepHours).Scan(exportJobFields(&job)...)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("export %d was taken over by another worker", id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return commitWithEvents(tx, outboxEvent{events.ExportCompleted, withExportURL(job)})
+}
+
+// failJob отмечает выгрузку неудачной
+func (h *ExportHandler) failJob(id, attempts int, reason string) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var job entities.ExportJob
+	err = tx.QueryRow(`
+	UPDATE export_jobs SET status = 'failed', error = $3, finished_at = NOW(), lease_until = NULL
+	WHERE id = $1 AND attempts = $2
+	RETURNING `+exportJobColumns, id, attempts, reason).Scan(exportJobFields(&job)...)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return commitWithEvents(tx, outboxEvent{events.ExportFailed, job})
+}
+
+// removeExpired удаляет архивы с истекшим сроком и временные файлы прерванных выгрузок
+func (h *ExportHandler) removeExpired() error {
+	rows, err := h.db.Query("SELECT id, file_path FROM export_jobs WHERE status = 'done' AND expires_at < NOW() ORDER BY id LIMIT 100")
+	if err != nil {
+		return err
+	}
+	type expired struct {
+		id   int
+		path string
+	}
+	var jobs []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.path); err != nil {
+			rows.Close()
+			return err
+		}
+		jobs = append(jobs, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range jobs {
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		_, err := h.db.Exec("UPDATE export_jobs SET status = 'expired', file_path = NULL, key_id = NULL, wrapped_key = NULL WHERE id = $1", e.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Временные файлы пишутся постоянно, пока выгрузка идет, так что старые брошены
+	tmps, _ := filepath.Glob(filepath.Join(h.dir, "export-*.tmp"))
+	for _, tmp := range tmps {
+		if info, err := os.Stat(tmp); err == nil && time.Since(info.ModTime()) > exportLease {
+			os.Remove(tmp)
+		}
+	}
+	return nil
+}
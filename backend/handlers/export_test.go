@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/entities"
+)
+
+func TestExportConditions(t *testing.T) {
+	ptr := func(v int) *int { return &v }
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	where, args, err := exportConditions(entities.ExportFilter{})
+	if err != nil || where != "TRUE" || len(args) != 0 {
+		t.Errorf("empty filter = %q, %v, %v", where, args, err)
+	}
+	where, _, err = exportConditions(entities.ExportFilter{CategoryID: ptr(0)})
+	if err != nil || where != "category_id IS NULL" {
+		t.Errorf("uncategorized = %q, %v", where, err)
+	}
+	where, args, err = exportConditions(entities.ExportFilter{CategoryID: ptr(3), Tags: []string{"Договор"}, TagMode: "any", From: &from, To: &to, IDs: []int{1, 2}, UserID: ptr(7)})
+	if err != nil || len(args) != 6 {
+		t.Fatalf("full filter = %q, %v, %v", where, args, err)
+	}
+	for _, part := range []string{"category_id = $1", "EXISTS", "created_at >= $3", "created_at < $4", "id = ANY($5)", "user_id = $6"} {
+		if !strings.Contains(where, part) {
+			t.Errorf("condition %q has no %q", where, part)
+		}
+	}
+
+	bad := []entities.ExportFilter{
+		{CategoryID: ptr(-1)},
+		{TagMode: "none"},
+		{From: &to, To: &from},
+		{IDs: []int{1, 0}},
+		{IDs: make([]int, entities.ExportMaxIDs+1)},
+	}
+	for _, f := range bad {
+		if _, _, err := exportConditions(f); err == nil {
+			t.Errorf("exportConditions(%+v) must fail", f)
+		}
+	}
+}
+
+func TestExportScope(t *testing.T) {
+	ptr := func(v int) *int { return &v }
+
+	f, err := exportScope(entities.ExportFilter{}, 5, false)
+	if err != nil || f.UserID == nil || *f.UserID != 5 {
+		t.Errorf("user export must be limited to own documents: %+v, %v", f.UserID, err)
+	}
+	if _, err := exportScope(entities.ExportFilter{UserID: ptr(6)}, 5, false); err != errExportForbidden {
+		t.Errorf("export of another user's documents: err = %v", err)
+	}
+	if f, err := exportScope(entities.ExportFilter{}, 1, true); err != nil || f.UserID != nil {
+		t.Errorf("admin export must stay unrestricted: %+v, %v", f.UserID, err)
+	}
+	if f, err := exportScope(entities.ExportFilter{UserID: ptr(6)}, 1, true); err != nil || *f.UserID != 6 {
+		t.Errorf("admin export by author: %+v, %v", f.UserID, err)
+	}
+}
+
+func TestExportInBackground(t *testing.T) {
+	if exportInBackground(false, 10, 1<<20) {
+		t.Error("small export must be streamed")
+	}
+	if !exportInBackground(true, 1, 0) {
+		t.Error("async export must run in background")
+	}
+	if !exportInBackground(false, entities.ExportSyncDocuments+1, 0) || !exportInBackground(false, 1, entities.ExportSyncBytes+1) {
+		t.Error("large export must run in background")
+	}
+}
+
+func TestExportFolders(t *testing.T) {
+	folders := exportFolders([]entities.Category{
+		{ID: 1, Name: "Договоры"},
+		{ID: 2, Name: "договоры"},
+		{ID: 3, Name: "Кадры/Отпуска"},
+		{ID: 4, Name: uncategorizedFolder},
+	})
+	want := map[int]string{1: "Договоры", 2: "договоры (2)", 3: "Кадры_Отпуска", 4: uncategorizedFolder + " (4)"}
+	for id, name := range want {
+		if folders[id] != name {
+			t.Errorf("folder of category %d = %q, want %q", id, folders[id], name)
+		}
+	}
+
+	category := 3
+	if got := exportFolder(entities.Document{ID: 7, Title: "Заявление: отпуск", CategoryID: &category}, folders); got != "Кадры_Отпуска/7 Заявление_ отпуск" {
+		t.Errorf("exportFolder = %q", got)
+	}
+	if got := exportFolder(entities.Document{ID: 8, Title: "Записка"}, folders); got != uncategorizedFolder+"/8 Записка" {
+		t.Errorf("exportFolder without category = %q", got)
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	category := 1
+	docs := []entities.Document{
+		{ID: 1, Title: "Договор", CategoryID: &category, FilePath: "uploads/a", FileName: "договор.pdf", FileType: "application/pdf", ScanStatus: entities.ScanClean},
+		{ID: 2, Title: "Без файла"},
+		{ID: 3, Title: "Вирус", FilePath: "uploads/b", FileName: "virus.exe", ScanStatus: entities.ScanInfected},
+	}
+	open := func(doc entities.Document) (io.ReadCloser, string, error) {
+		if doc.ScanStatus != entities.ScanClean {
+			return nil, "file is quarantined: malware detected", nil
+		}
+		return io.NopCloser(strings.NewReader("содержимое " + doc.FileName)), "", nil
+	}
+	progress := 0
+	var buf bytes.Buffer
+	err := writeExport(&buf, docs, map[int]string{1: "Договоры"}, exportManifest{CreatedAt: time.Now()}, open, func() error {
+		progress++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != len(docs) {
+		t.Errorf("progress called %d times", progress)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	if files["Договоры/1 Договор/договор.pdf"] != "содержимое договор.pdf" {
+		t.Errorf("file content = %q", files["Договоры/1 Договор/договор.pdf"])
+	}
+	var doc entities.Document
+	if err := json.Unmarshal([]byte(files["Договоры/1 Договор/document.json"]), &doc); err != nil || doc.ID != 1 {
+		t.Errorf("metadata = %+v, %v", doc, err)
+	}
+	if _, ok := files[uncategorizedFolder+"/2 Без файла/document.json"]; !ok {
+		t.Error("document without file must have metadata")
+	}
+	if _, ok := files[uncategorizedFolder+"/3 Вирус/virus.exe"]; ok {
+		t.Error("infected file must not be exported")
+	}
+
+	var manifest exportManifest
+	if err := json.Unmarshal([]byte(files[exportManifestName]), &manifest); err != nil || len(manifest.Documents) != 3 {
+		t.Fatalf("manifest = %+v, %v", manifest, err)
+	}
+	if manifest.Documents[0].File != "Договоры/1 Договор/договор.pdf" || manifest.Documents[2].Skipped == "" {
+		t.Errorf("manifest documents = %+v", manifest.Documents)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backend/entities"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type GroupHandler struct {
+	db *sql.DB
+}
+
+func NewGroupHandler(db *sql.DB) *GroupHandler {
+	return &GroupHandler{db: db}
+}
+
+// GetGroups возвращает список групп пользователей с участниками
+func (h *GroupHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+	SELECT g.id, g.name, COALESCE(array_agg(m.user_id ORDER BY m.user_id) FILTER (WHERE m.user_id IS NOT NULL), '{}'), g.created_at
+	FROM user_groups g
+	LEFT JOIN user_group_members m ON m.group_id = g.id
+	GROUP BY g.id
+	ORDER BY g.name`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	groups := []entities.Group{}
+	for rows.Next() {
+		var group entities.Group
+		if err := rows.Scan(&group.ID, &group.Name, pq.Array(&group.MemberIDs), &group.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		groups = append(groups, group)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// CreateGroup создает группу пользователей
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req entities.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	group := entities.Group{MemberIDs: []int64{}}
+	err = tx.QueryRow("INSERT INTO user_groups (name) VALUES ($1) RETURNING id, name, created_at", req.Name).
+		Scan(&group.ID, &group.Name, &group.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec := auditRecord{Action: "group.create", TargetType: "group", TargetID: intPtr(group.ID), After: group}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+// SetGroupMembers заменяет состав группы
+func (h *GroupHandler) SetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.SetGroupMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserIDs == nil {
+		req.UserIDs = []int64{}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	group := entities.Group{ID: id}
+	err = tx.QueryRow("SELECT name, created_at FROM user_groups WHERE id = $1 FOR UPDATE", id).Scan(&group.Name, &group.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Group not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_group_members WHERE group_id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+	INSERT INTO user_group_members (group_id, user_id)
+	SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING`, id, pq.Array(req.UserIDs))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.MemberIDs = req.UserIDs
+
+	rec := auditRecord{Action: "group.set_members", TargetType: "group", TargetID: intPtr(id), After: group}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
@@ -0,0 +1,11 @@
+package handlers
+
+import "strings"
+
+// likeEscaper экранирует спецсимволы шаблона LIKE; в запросе нужен ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeEscape превращает ввод пользователя в литерал для LIKE/ILIKE, чтобы % и _ не работали как подстановки
+func likeEscape(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import "testing"
+
+func TestLikeEscape(t *testing.T) {
+	cases := map[string]string{
+		"ДОГ-2024":  "ДОГ-2024",
+		"100%":      `100\%`,
+		"a_b":       `a\_b`,
+		`C:\docs\_`: `C:\\docs\\\_`,
+	}
+	for in, want := range cases {
+		if got := likeEscape(in); got != want {
+			t.Errorf("likeEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
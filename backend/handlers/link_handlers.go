@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+	"backend/storage"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LinkHandler - публичные ссылки на файлы документов для получателей без учетной записи
+type LinkHandler struct {
+	db    *sql.DB
+	blobs *storage.Blobs
+}
+
+func NewLinkHandler(db *sql.DB, blobs *storage.Blobs) *LinkHandler {
+	return &LinkHandler{db: db, blobs: blobs}
+}
+
+const linkColumns = "id, document_id, mode, password_hash IS NOT NULL, expires_at, max_downloads, download_count, created_by, created_at, revoked_at, last_accessed_at"
+
+func linkFields(l *entities.ShareLink) []any {
+	return []any{&l.ID, &l.DocumentID, &l.Mode, &l.HasPassword, &l.ExpiresAt, &l.MaxDownloads, &l.DownloadCount, &l.CreatedBy, &l.CreatedAt, &l.RevokedAt, &l.LastAccessedAt}
+}
+
+// hashToken возвращает хэш токена ссылки, по которому она ищется в базе
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newLinkToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// linkExpiry проверяет параметры новой ссылки и возвращает срок ее действия
+func linkExpiry(req entities.CreateShareLinkRequest, now time.Time) (time.Time, error) {
+	if req.Mode != entities.LinkDownload && req.Mode != entities.LinkView {
+		return time.Time{}, fmt.Errorf("mode must be %s or %s", entities.LinkDownload, entities.LinkView)
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return time.Time{}, fmt.Errorf("max_downloads must be positive")
+	}
+	if req.ExpiresAt == nil {
+		return now.AddDate(0, 0, entities.DefaultLinkDays), nil
+	}
+	if !req.ExpiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("expires_at must be in the future")
+	}
+	if req.ExpiresAt.After(now.AddDate(0, 0, entities.MaxLinkDays)) {
+		return time.Time{}, fmt.Errorf("links can be valid for at most %d days", entities.MaxLinkDays)
+	}
+	return *req.ExpiresAt, nil
+}
+
+// linkUnavailable возвращает причину, по которой ссылка не действует, или пустую строку
+func linkUnavailable(l entities.ShareLink, now time.Time) string {
+	switch {
+	case l.RevokedAt != nil:
+		return "link has been revoked"
+	case !now.Before(l.ExpiresAt):
+		return "link has expired"
+	case l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads:
+		return "download limit reached"
+	}
+	return ""
+}
+
+// sharedDocument загружает документ и проверяет, что текущий пользователь - автор или администратор.
+// При отказе ответ уже отправлен.
+func (h *LinkHandler) sharedDocument(w http.ResponseWriter, r *http.Request) (entities.Document, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return entities.Document{}, false
+	}
+	doc, err := scanDocument(h.db.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return doc, false
+	}
+
+	userID := *currentUserID(r)
+	if doc.UserID != userID {
+		role, err := userRole(h.db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return doc, false
+		}
+		if role != "admin" {
+			http.Error(w, "only the author or an administrator can manage links to the document", http.StatusForbidden)
+			return doc, false
+		}
+	}
+	return doc, true
+}
+
+// CreateLink создает публичную ссылку на файл документа. Токен возвращается только в этом ответе.
+func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	var req entities.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = entities.LinkDownload
+	}
+	expiresAt, err := linkExpiry(req, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, ok := h.sharedDocument(w, r)
+	if !ok {
+		return
+	}
+	if doc.FilePath == "" {
+		http.Error(w, "document has no file to share", http.StatusBadRequest)
+		return
+	}
+	if doc.ScanStatus == entities.ScanInfected {
+		http.Error(w, "file is quarantined: malware detected", http.StatusForbidden)
+		return
+	}
+
+	var passwordHash *string
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "failed to hash password", http.StatusInternalServerError)
+			return
+		}
+		s := string(hash)
+		passwordHash = &s
+	}
+	token, err := newLinkToken()
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var link entities.ShareLink
+	err = tx.QueryRow(`
+	INSERT INTO share_links (document_id, token_hash, mode, password_hash, expires_at, max_downloads, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING `+linkColumns, doc.ID, hashToken(token), req.Mode, passwordHash, expiresAt.UTC(), req.MaxDownloads, *currentUserID(r)).
+		Scan(linkFields(&link)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// В событие и аудит токен не попадает
+	rec := auditRecord{Action: "link.create", TargetType: "document", TargetID: intPtr(doc.ID), After: link}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.LinkCreated, link}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	link.Token = token
+	link.URL = "/s/" + token
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// GetLinks возвращает ссылки документа, начиная с новых
+func (h *LinkHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.sharedDocument(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT "+linkColumns+" FROM share_links WHERE document_id = $1 ORDER BY id DESC", doc.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	links := []entities.ShareLink{}
+	for rows.Next() {
+		var link entities.ShareLink
+		if err := rows.Scan(linkFields(&link)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		links = append(links, link)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeLink отзывает ссылку; повторный отзыв возвращает ссылку без изменений
+func (h *LinkHandler) RevokeLink(w http.ResponseWriter, r *http.Request) {
+	linkID, err := strconv.Atoi(mux.Vars(r)["link_id"])
+	if err != nil {
+		http.Error(w, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+	doc, ok := h.sharedDocument(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var before entities.ShareLink
+	err = tx.QueryRow("SELECT "+linkColumns+" FROM share_links WHERE id = $1 AND document_id = $2 FOR UPDATE", linkID, doc.ID).
+		Scan(linkFields(&before)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if before.RevokedAt != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(before)
+		return
+	}
+
+	var link entities.ShareLink
+	err = tx.QueryRow("UPDATE share_links SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+linkColumns, linkID).
+		Scan(linkFields(&link)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "link.revoke", TargetType: "document", TargetID: intPtr(doc.ID), Before: before, After: link}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.LinkRevoked, link}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// passwordForm - страница ввода пароля для браузера; форма отправляется POST на тот же адрес
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>DocFlow</title></head>
+<body>
+<form method="post">
+<p>{{.}}</p>
+<input type="password" name="password" autofocus required>
+<button type="submit">Открыть</button>
+</form>
+</body>
+</html>
+`))
+
+// askPassword отвечает 401: браузеру - формой ввода пароля, остальным клиентам - текстом
+func askPassword(w http.ResponseWriter, r *http.Request, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		passwordForm.Execute(w, message)
+		return
+	}
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// linkPassword возвращает пароль из формы (POST) или заголовка X-Link-Password
+func linkPassword(w http.ResponseWriter, r *http.Request) string {
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		if password := r.PostFormValue("password"); password != "" {
+			return password
+		}
+	}
+	return r.Header.Get("X-Link-Password")
+}
+
+// AccessLink отдает файл по публичной ссылке (GET /s/{token}, вне авторизации).
+// Защищенная паролем ссылка принимает его формой (POST) или в заголовке X-Link-Password.
+func (h *LinkHandler) AccessLink(w http.ResponseWriter, r *http.Request) {
+	// Токен не должен уходить третьим сайтам и в поисковые индексы
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	var link entities.ShareLink
+	var passwordHash sql.NullString
+	err := h.db.QueryRow("SELECT "+linkColumns+", password_hash FROM share_links WHERE token_hash = $1", hashToken(mux.Vars(r)["token"])).
+		Scan(append(linkFields(&link), &passwordHash)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if reason := linkUnavailable(link, time.Now()); reason != "" {
+		http.Error(w, reason, http.StatusGone)
+		return
+	}
+
+	if passwordHash.Valid {
+		password := linkPassword(w, r)
+		if password == "" {
+			askPassword(w, r, "Файл защищен паролем")
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+			h.failedPassword(r, link)
+			askPassword(w, r, "Неверный пароль")
+			return
+		}
+	}
+
+	doc, err := scanDocument(h.db.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1", link.DocumentID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	file, ok := openDocumentFile(w, h.db, h.blobs, doc)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	unchanged, err := setDownloadHeaders(w, r, doc, file, link.Mode == entities.LinkView)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if unchanged {
+		return
+	}
+
+	// Каждый ответ с содержимым, в том числе на запрос Range, засчитывается в лимит:
+	// иначе файл можно скачать частями без ограничений
+	if !h.countDownload(w, r, link, doc.ID) {
+		return
+	}
+	serveDocumentFile(w, r, file)
+}
+
+// countDownload засчитывает скачивание, если ссылка еще действует: условие в UPDATE
+// не дает одновременным запросам превысить лимит
+func (h *LinkHandler) countDownload(w http.ResponseWriter, r *http.Request, link entities.ShareLink, documentID int) bool {
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	defer tx.Rollback()
+
+	var counted entities.ShareLink
+	err = tx.QueryRow(`
+	UPDATE share_links SET download_count = download_count + 1, last_accessed_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		AND (max_downloads IS NULL OR download_count < max_downloads)
+	RETURNING `+linkColumns, link.ID).Scan(linkFields(&counted)...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "download limit reached", http.StatusGone)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	after := map[string]any{"link_id": link.ID, "download_count": counted.DownloadCount}
+	if rng := r.Header.Get("Range"); rng != "" {
+		after["range"] = rng
+	}
+
+	rec := auditRecord{Action: "link.download", TargetType: "document", TargetID: intPtr(documentID), After: after}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.LinkDownloaded, counted}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// failedPassword считает неверные пароли и отзывает ссылку после MaxLinkPasswordAttempts попыток
+func (h *LinkHandler) failedPassword(r *http.Request, link entities.ShareLink) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("share link %d: failed to count password attempt: %v", link.ID, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var attempts int
+	err = tx.QueryRow(`
+	UPDATE share_links SET failed_attempts = failed_attempts + 1,
+		revoked_at = CASE WHEN failed_attempts + 1 >= $2 THEN CURRENT_TIMESTAMP ELSE revoked_at END
+	WHERE id = $1
+	RETURNING failed_attempts`, link.ID, entities.MaxLinkPasswordAttempts).Scan(&attempts)
+	if err != nil {
+		log.Printf("share link %d: failed to count password attempt: %v", link.ID, err)
+		return
+	}
+	if attempts < entities.MaxLinkPasswordAttempts {
+		err = tx.Commit()
+	} else {
+		err = commitAudited(tx, r, auditRecord{Action: "link.locked", TargetType: "document", TargetID: intPtr(link.DocumentID),
+			After: map[string]any{"link_id": link.ID, "failed_attempts": attempts}})
+	}
+	if err != nil {
+		log.Printf("share link %d: failed to count password attempt: %v", link.ID, err)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/database"
+	"backend/entities"
+	"backend/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLinkExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	ptr := func(v int) *int { return &v }
+	at := func(d time.Duration) *time.Time { v := now.Add(d); return &v }
+
+	got, err := linkExpiry(entities.CreateShareLinkRequest{Mode: entities.LinkDownload}, now)
+	if err != nil || !got.Equal(now.AddDate(0, 0, entities.DefaultLinkDays)) {
+		t.Errorf("default expiry = %v, %v", got, err)
+	}
+	if got, err := linkExpiry(entities.CreateShareLinkRequest{Mode: entities.LinkView, ExpiresAt: at(time.Hour)}, now); err != nil || !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("explicit expiry = %v, %v", got, err)
+	}
+
+	bad := []entities.CreateShareLinkRequest{
+		{Mode: "edit"},
+		{Mode: entities.LinkDownload, MaxDownloads: ptr(0)},
+		{Mode: entities.LinkDownload, ExpiresAt: at(-time.Minute)},
+		{Mode: entities.LinkDownload, ExpiresAt: at((entities.MaxLinkDays + 1) * 24 * time.Hour)},
+	}
+	for _, req := range bad {
+		if _, err := linkExpiry(req, now); err == nil {
+			t.Errorf("linkExpiry(%+v) must fail", req)
+		}
+	}
+}
+
+func TestLinkUnavailable(t *testing.T) {
+	now := time.Now()
+	limit := 2
+	active := entities.ShareLink{ExpiresAt: now.Add(time.Hour), MaxDownloads: &limit, DownloadCount: 1}
+	if reason := linkUnavailable(active, now); reason != "" {
+		t.Errorf("active link: %s", reason)
+	}
+
+	revoked := active
+	revoked.RevokedAt = &now
+	expired := active
+	expired.ExpiresAt = now
+	exhausted := active
+	exhausted.DownloadCount = 2
+	for name, l := range map[string]entities.ShareLink{"revoked": revoked, "expired": expired, "exhausted": exhausted} {
+		if linkUnavailable(l, now) == "" {
+			t.Errorf("%s link must be unavailable", name)
+		}
+	}
+}
+
+func TestLinkToken(t *testing.T) {
+	a, _ := newLinkToken()
+	b, _ := newLinkToken()
+	if a == b || len(a) != 43 {
+		t.Errorf("tokens %q and %q", a, b)
+	}
+	if hashToken(a) == a || hashToken(a) != hashToken(a) || len(hashToken(a)) != 64 {
+		t.Error("hashToken must be a stable SHA-256 hex digest")
+	}
+}
+
+// TestAccessLinkCountsRanges проверяет, что запросы Range расходуют лимит скачиваний:
+// ни суффиксный диапазон, ни продолжение после bytes=0-0 не обходят max_downloads=1.
+// Нужна запущенная БД, иначе тест пропускается.
+func TestAccessLinkCountsRanges(t *testing.T) {
+	db, err := database.Connect()
+	if err != nil {
+		t.Skipf("Skipping integration test: cannot connect to database: %v", err)
+	}
+	defer db.Close()
+	if err := database.CreateTables(db); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	keys, err := storage.NewLocalKeys("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	h := &LinkHandler{db: db, blobs: storage.NewBlobs(dir, keys)}
+	// Файл без хэша читается как есть, как загруженный до хранения по содержимому
+	path := filepath.Join(dir, "contract.txt")
+	if err := os.WriteFile(path, []byte("договор поставки"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var userID, docID int
+	login := fmt.Sprintf("link-test-%d", time.Now().UnixNano())
+	if err := db.QueryRow("INSERT INTO users (login, password_hash) VALUES ($1, '') RETURNING id", login).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id = $1", userID)
+	err = db.QueryRow(`
+	INSERT INTO documents (title, file_path, file_name, file_type, scan_status, user_id)
+	VALUES ('Link test', $1, 'contract.txt', 'text/plain', $2, $3) RETURNING id`, path, entities.ScanClean, userID).Scan(&docID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM documents WHERE id = $1", docID)
+
+	access := func(token, rng string) int {
+		r := mux.SetURLVars(httptest.NewRequest("GET", "/s/"+token, nil), map[string]string{"token": token})
+		r.Header.Set("Range", rng)
+		w := httptest.NewRecorder()
+		h.AccessLink(w, r)
+		return w.Code
+	}
+	for name, ranges := range map[string][]string{
+		"suffix":       {"bytes=-5", "bytes=-5"},
+		"continuation": {"bytes=0-0", "bytes=1-"},
+	} {
+		token, err := newLinkToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`
+		INSERT INTO share_links (document_id, token_hash, mode, expires_at, max_downloads, created_by)
+		VALUES ($1, $2, $3, $4, 1, $5)`, docID, hashToken(token), entities.LinkDownload, time.Now().Add(time.Hour).UTC(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := access(token, ranges[0]); code != http.StatusPartialContent {
+			t.Fatalf("%s: first request = %d, want 206", name, code)
+		}
+		if code := access(token, ranges[1]); code != http.StatusGone {
+			t.Errorf("%s: second request = %d, want 410 after the limit", name, code)
+		}
+	}
+}
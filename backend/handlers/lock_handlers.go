@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+)
+
+// lockedByOther сообщает, заблокирован ли документ другим пользователем.
+// documentColumns уже скрывает истекшие блокировки.
+func lockedByOther(doc entities.Document, userID int) bool {
+	return doc.LockedBy != nil && *doc.LockedBy != userID
+}
+
+// editConflict проверяет, может ли пользователь изменять документ,
+// и возвращает HTTP-статус и сообщение отказа
+func editConflict(doc entities.Document, userID int) (int, string) {
+	if lockedByOther(doc, userID) {
+		return http.StatusLocked, fmt.Sprintf("document is checked out by user %d until %s",
+			*doc.LockedBy, doc.LockExpiresAt.Format(time.RFC3339))
+	}
+	// Редактировать можно только черновики
+	if doc.Status != entities.StatusDraft {
+		return http.StatusConflict, "only draft documents can be edited"
+	}
+	return 0, ""
+}
+
+// lockDuration возвращает срок блокировки по запросу
+func lockDuration(minutes int) (time.Duration, error) {
+	if minutes == 0 {
+		minutes = entities.DefaultLockMinutes
+	}
+	if minutes < 0 || minutes > entities.MaxLockMinutes {
+		return 0, fmt.Errorf("minutes must be between 1 and %d", entities.MaxLockMinutes)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// lockedDocumentTx открывает транзакцию и блокирует строку документа
+func lockedDocumentTx(db *sql.DB, w http.ResponseWriter, id int) (*sql.Tx, entities.Document, bool) {
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, entities.Document{}, false
+	}
+
+	doc, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, entities.Document{}, false
+	}
+	return tx, doc, true
+}
+
+// CheckoutDocument блокирует документ за текущим пользователем.
+// Повторный check-out владельцем продлевает блокировку.
+func (h *DocumentHandler) CheckoutDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration, err := lockDuration(req.Minutes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := *currentUserID(r)
+	tx, before, ok := lockedDocumentTx(h.db, w, id)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := editConflict(before, userID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	doc, err := scanDocument(tx.QueryRow(`
+	UPDATE documents SET locked_by = $1, locked_at = CURRENT_TIMESTAMP, lock_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+	WHERE id = $3
+	RETURNING `+documentColumns, userID, duration.Seconds(), id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.checkout", TargetType: "document", TargetID: intPtr(id), Before: before, After: doc}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentCheckedOut, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// decodeCheckin читает запрос check-in поверх текущего документа: поля, которых нет
+// в теле, сохраняют прежние значения. "category_id": null снимает категорию.
+func decodeCheckin(body io.Reader, before entities.Document) (entities.CheckinRequest, error) {
+	req := entities.CheckinRequest{Title: before.Title, Content: before.Content}
+	// Декодер пишет в уже выделенные значения, поэтому категория копируется, а metadata
+	// подставляется после: иначе изменились бы поля before, а ключи карты объединились бы
+	if before.CategoryID != nil {
+		categoryID := *before.CategoryID
+		req.CategoryID = &categoryID
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return req, err
+	}
+	if req.Title == "" {
+		return req, fmt.Errorf("title cannot be empty")
+	}
+	if req.Metadata == nil {
+		req.Metadata = before.Metadata
+	}
+	return req, nil
+}
+
+// CheckinDocument сохраняет изменения владельца блокировки, создает версию
+// и снимает блокировку (если не указано keep_locked)
+func (h *DocumentHandler) CheckinDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := *currentUserID(r)
+	tx, before, ok := lockedDocumentTx(h.db, w, id)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	req, err := decodeCheckin(r.Body, before)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if before.LockedBy == nil {
+		http.Error(w, "document is not checked out", http.StatusConflict)
+		return
+	}
+	if status, msg := editConflict(before, userID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	meta, err := documentMetadata(tx, req.CategoryID, req.Metadata)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
+
+	query := `
+	UPDATE documents
+	SET title = $1, content = $2, category_id = $3, metadata = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $4
+	RETURNING ` + documentColumns
+	if !req.KeepLocked {
+		query = `
+	UPDATE documents
+	SET title = $1, content = $2, category_id = $3, metadata = $5, updated_at = CURRENT_TIMESTAMP,
+		locked_by = NULL, locked_at = NULL, lock_expires_at = NULL
+	WHERE id = $4
+	RETURNING ` + documentColumns
+	}
+	doc, err := scanDocument(tx.QueryRow(query, req.Title, req.Content, req.CategoryID, id, meta))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Строка документа заблокирована FOR UPDATE, поэтому номер версии не гоняется
+	var version entities.DocumentVersion
+	err = tx.QueryRow(`
+	INSERT INTO document_versions (document_id, version, title, content, category_id, file_path, metadata, comment, created_by)
+	SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $8, $6, $7 FROM document_versions WHERE document_id = $1
+	RETURNING `+versionColumns, id, doc.Title, doc.Content, doc.CategoryID, doc.FilePath, req.Comment, userID, meta).
+		Scan(versionFields(&version)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.checkin", TargetType: "document", TargetID: intPtr(id), Before: before, After: version}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentUpdated, doc}, outboxEvent{events.DocumentCheckedIn, version}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// UnlockDocument снимает блокировку без сохранения изменений.
+// Владелец отменяет свой check-out, администратор может снять чужую блокировку.
+func (h *DocumentHandler) UnlockDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, before, ok := lockedDocumentTx(h.db, w, id)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if before.LockedBy == nil {
+		http.Error(w, "document is not checked out", http.StatusConflict)
+		return
+	}
+	forced := lockedByOther(before, userID)
+	if forced && role != "admin" {
+		http.Error(w, "only the lock holder or an administrator can unlock the document", http.StatusForbidden)
+		return
+	}
+
+	doc, err := scanDocument(tx.QueryRow(`
+	UPDATE documents SET locked_by = NULL, locked_at = NULL, lock_expires_at = NULL
+	WHERE id = $1
+	RETURNING `+documentColumns, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	action := "document.unlock"
+	if forced {
+		action = "document.force_unlock"
+	}
+
+	rec := auditRecord{Action: action, TargetType: "document", TargetID: intPtr(id), Before: before, After: doc}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentUnlocked, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+const versionColumns = "id, document_id, version, title, COALESCE(content, ''), category_id, COALESCE(file_path, ''), metadata, comment, created_by, created_at"
+
+func versionFields(v *entities.DocumentVersion) []any {
+	return []any{&v.ID, &v.DocumentID, &v.Version, &v.Title, &v.Content, &v.CategoryID, &v.FilePath, jsonColumn{&v.Metadata}, &v.Comment, &v.CreatedBy, &v.CreatedAt}
+}
+
+// GetDocumentVersions возвращает версии документа, начиная с последней
+func (h *DocumentHandler) GetDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.loadDocument(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rows, err := h.db.Query("SELECT "+versionColumns+" FROM document_versions WHERE document_id = $1 ORDER BY version DESC", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	versions := []entities.DocumentVersion{}
+	for rows.Next() {
+		var v entities.DocumentVersion
+		if err := rows.Scan(versionFields(&v)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		versions = append(versions, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetDocumentVersion возвращает версию документа по номеру
+func (h *DocumentHandler) GetDocumentVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	number, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	var v entities.DocumentVersion
+	err = h.db.QueryRow("SELECT "+versionColumns+" FROM document_versions WHERE document_id = $1 AND version = $2", id, number).
+		Scan(versionFields(&v)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Version not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/entities"
+)
+
+func TestEditConflict(t *testing.T) {
+	holder, other := 1, 2
+	expires := time.Now().Add(time.Hour)
+
+	free := entities.Document{Status: entities.StatusDraft}
+	locked := entities.Document{Status: entities.StatusDraft, LockedBy: &holder, LockExpiresAt: &expires}
+	published := entities.Document{Status: entities.StatusPublished}
+
+	cases := []struct {
+		name   string
+		doc    entities.Document
+		userID int
+		want   int
+	}{
+		{"unlocked draft", free, other, 0},
+		{"holder edits", locked, holder, 0},
+		{"other user blocked", locked, other, http.StatusLocked},
+		{"not a draft", published, holder, http.StatusConflict},
+	}
+	for _, c := range cases {
+		if got, _ := editConflict(c.doc, c.userID); got != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestLockDuration(t *testing.T) {
+	if d, err := lockDuration(0); err != nil || d != entities.DefaultLockMinutes*time.Minute {
+		t.Errorf("lockDuration(0) = %v, %v", d, err)
+	}
+	if d, err := lockDuration(90); err != nil || d != 90*time.Minute {
+		t.Errorf("lockDuration(90) = %v, %v", d, err)
+	}
+	for _, minutes := range []int{-1, entities.MaxLockMinutes + 1} {
+		if _, err := lockDuration(minutes); err == nil {
+			t.Errorf("lockDuration(%d) must fail", minutes)
+		}
+	}
+}
+
+func TestDecodeCheckinKeepsOmittedFields(t *testing.T) {
+	categoryID := 3
+	before := entities.Document{
+		Title:      "Договор",
+		Content:    "Текст договора",
+		CategoryID: &categoryID,
+		Metadata:   entities.Metadata{"counterparty": "ООО Ромашка", "amount": 1000},
+	}
+
+	req, err := decodeCheckin(strings.NewReader(`{"comment": "правки", "content": "Новый текст"}`), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Title != before.Title || req.Content != "Новый текст" || req.CategoryID == nil || *req.CategoryID != 3 {
+		t.Errorf("omitted fields must keep current values: %+v", req)
+	}
+	if fmt.Sprint(req.Metadata) != fmt.Sprint(before.Metadata) {
+		t.Errorf("metadata = %v, want %v", req.Metadata, before.Metadata)
+	}
+
+	req, err = decodeCheckin(strings.NewReader(`{"category_id": 5, "metadata": {"amount": 2000}}`), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *req.CategoryID != 5 || *before.CategoryID != 3 {
+		t.Errorf("category_id = %d, before = %d", *req.CategoryID, *before.CategoryID)
+	}
+	// metadata заменяется целиком, как в PUT, а не объединяется с текущей
+	if _, ok := req.Metadata["counterparty"]; ok || len(before.Metadata) != 2 {
+		t.Errorf("metadata = %v, before = %v", req.Metadata, before.Metadata)
+	}
+
+	req, err = decodeCheckin(strings.NewReader(`{"category_id": null}`), before)
+	if err != nil || req.CategoryID != nil {
+		t.Errorf("category_id: null must clear the category: %+v, %v", req.CategoryID, err)
+	}
+
+	if _, err := decodeCheckin(strings.NewReader(`{"title": ""}`), before); err == nil {
+		t.Error("empty title must be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+)
+
+// mergePatch применяет JSON Merge Patch (RFC 7396) к target.
+// null в патче удаляет поле, вложенные объекты объединяются рекурсивно,
+// любые другие значения заменяют поле целиком.
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// decodeMergePatch накладывает тело запроса на current и декодирует результат в dst.
+// Допустимы только поля, присутствующие в JSON-представлении current.
+// Возвращает HTTP-статус ошибки.
+func decodeMergePatch(r *http.Request, current any, dst any) (int, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/merge-patch+json")
+	}
+
+	var patch any
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&patch); err != nil {
+		return http.StatusBadRequest, err
+	}
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return http.StatusBadRequest, fmt.Errorf("merge patch must be a JSON object")
+	}
+
+	target, err := toJSONObject(current)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var unknown []string
+	for key := range patchObject {
+		if _, ok := target[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return http.StatusBadRequest, fmt.Errorf("unknown fields: %v", unknown)
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patchObject))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	decoder = json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// toJSONObject возвращает JSON-представление значения в виде объекта
+func toJSONObject(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&object)
+	return object, err
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"backend/entities"
+)
+
+// Примеры из приложения A RFC 7396
+func TestMergePatchRFCExamples(t *testing.T) {
+	cases := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, c := range cases {
+		var target, patch, want any
+		json.Unmarshal([]byte(c.target), &target)
+		json.Unmarshal([]byte(c.patch), &patch)
+		json.Unmarshal([]byte(c.want), &want)
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", c.target, c.patch, got, c.want)
+		}
+	}
+}
+
+func TestDecodeMergePatch(t *testing.T) {
+	category := 3
+	current := entities.UpdateDocumentRequest{Title: "Договор", Content: "текст", CategoryID: &category}
+
+	patch := func(body, contentType string) (entities.UpdateDocumentRequest, int, error) {
+		r := httptest.NewRequest("PATCH", "/dock/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		var req entities.UpdateDocumentRequest
+		status, err := decodeMergePatch(r, current, &req)
+		return req, status, err
+	}
+
+	req, _, err := patch(`{"title": "Договор поставки"}`, "application/merge-patch+json")
+	if err != nil || req.Title != "Договор поставки" || req.Content != "текст" || req.CategoryID == nil || *req.CategoryID != 3 {
+		t.Errorf("title patch: %+v, %v", req, err)
+	}
+
+	req, _, err = patch(`{"category_id": null}`, "application/merge-patch+json")
+	if err != nil || req.CategoryID != nil || req.Content != "текст" {
+		t.Errorf("null patch: %+v, %v", req, err)
+	}
+
+	if _, status, err := patch(`{"owner": 5}`, "application/merge-patch+json"); err == nil || status != http.StatusBadRequest {
+		t.Errorf("unknown field: status %d, err %v", status, err)
+	}
+	if _, status, err := patch(`{"owner": null}`, "application/merge-patch+json"); err == nil || status != http.StatusBadRequest {
+		t.Errorf("unknown null field: status %d, err %v", status, err)
+	}
+	if _, status, err := patch(`{"title": 5}`, "application/merge-patch+json"); err == nil || status != http.StatusBadRequest {
+		t.Errorf("wrong type: status %d, err %v", status, err)
+	}
+	if _, status, err := patch(`[]`, "application/merge-patch+json"); err == nil || status != http.StatusBadRequest {
+		t.Errorf("array patch: status %d, err %v", status, err)
+	}
+	if _, status, err := patch(`{}`, "text/plain"); err == nil || status != http.StatusUnsupportedMediaType {
+		t.Errorf("content type: status %d, err %v", status, err)
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/metadata"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// jsonColumn читает JSONB-столбец в значение Go
+type jsonColumn struct {
+	dest any
+}
+
+func (c jsonColumn) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c.dest)
+	case string:
+		return json.Unmarshal([]byte(v), c.dest)
+	}
+	return fmt.Errorf("unsupported JSON column type %T", src)
+}
+
+// loadCategoryFields возвращает схему метаданных категории в порядке полей
+func loadCategoryFields(q queryer, categoryID int) ([]entities.CategoryField, error) {
+	rows, err := q.Query(`
+	SELECT id, category_id, name, label, type, required, options
+	FROM category_fields WHERE category_id = $1 ORDER BY position, id`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []entities.CategoryField{}
+	for rows.Next() {
+		var f entities.CategoryField
+		if err := rows.Scan(&f.ID, &f.CategoryID, &f.Name, &f.Label, &f.Type, &f.Required, pq.Array(&f.Options)); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// documentMetadata проверяет метаданные документа по схеме категории
+// и возвращает их в виде JSON для записи в столбец metadata
+func documentMetadata(tx *sql.Tx, categoryID *int, values entities.Metadata) (string, error) {
+	var fields []entities.CategoryField
+	if categoryID != nil {
+		var err error
+		if fields, err = loadCategoryFields(tx, *categoryID); err != nil {
+			return "", err
+		}
+	}
+
+	normalized, userIDs, err := metadata.Validate(fields, values)
+	if err != nil {
+		return "", err
+	}
+	if len(userIDs) > 0 {
+		var found int
+		if err := tx.QueryRow("SELECT count(*) FROM users WHERE id = ANY($1)", pq.Array(userIDs)).Scan(&found); err != nil {
+			return "", err
+		}
+		if found != len(uniqueInts(userIDs)) {
+			return "", &metadata.ValidationError{Problems: []string{"user reference points to an unknown user"}}
+		}
+	}
+
+	data, err := json.Marshal(normalized)
+	return string(data), err
+}
+
+func uniqueInts(values []int) map[int]bool {
+	set := map[int]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// writeMetadataError отвечает 400 на ошибки проверки метаданных и 500 на остальные
+func writeMetadataError(w http.ResponseWriter, err error) {
+	var verr *metadata.ValidationError
+	if errors.As(err, &verr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// GetCategoryFields возвращает схему метаданных категории
+func (h *CategoryHandler) GetCategoryFields(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := loadCategoryFields(h.db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
+
+// UpdateCategoryFields заменяет схему метаданных категории.
+// Уже сохраненные значения документов не пересчитываются и проверяются при следующем изменении.
+func (h *CategoryHandler) UpdateCategoryFields(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.UpdateCategoryFieldsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := metadata.ValidateSchema(req.Fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)", id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	before, err := loadCategoryFields(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM category_fields WHERE category_id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i, f := range req.Fields {
+		if f.Options == nil {
+			f.Options = []string{}
+		}
+		_, err := tx.Exec(`
+		INSERT INTO category_fields (category_id, name, label, type, required, options, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, id, f.Name, f.Label, f.Type, f.Required, pq.Array(f.Options), i)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	fields, err := loadCategoryFields(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "category.fields_update", TargetType: "category", TargetID: intPtr(id), Before: before, After: fields}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
+
+// metadataOperators - операторы сравнения в фильтрах meta.<поле>.<оператор>
+var metadataOperators = map[string]string{"": "=", "eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// metadataFieldTypes возвращает типы полей метаданных по схемам категорий: для категории
+// categoryID, если она задана, иначе по всем категориям. У поля может быть несколько типов,
+// если в разных категориях оно описано по-разному.
+func metadataFieldTypes(q queryer, categoryID *int, names []string) (map[string][]string, error) {
+	query := "SELECT name, array_agg(DISTINCT type) FROM category_fields WHERE name = ANY($1)"
+	args := []any{pq.Array(names)}
+	if categoryID != nil {
+		query += " AND category_id = $2"
+		args = append(args, *categoryID)
+	}
+	rows, err := q.Query(query+" GROUP BY name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := map[string][]string{}
+	for rows.Next() {
+		var (
+			name      string
+			nameTypes []string
+		)
+		if err := rows.Scan(&name, pq.Array(&nameTypes)); err != nil {
+			return nil, err
+		}
+		types[name] = nameTypes
+	}
+	return types, rows.Err()
+}
+
+// metadataFilterField возвращает имя поля из ключа фильтра meta.<поле>[.<оператор>]
+func metadataFilterField(key string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(key, "meta."), ".")
+	return name
+}
+
+// metadataCondition строит условие WHERE для фильтра по полю метаданных.
+// Способ сравнения выбирается по типу поля в схеме категорий (types, см. metadataFieldTypes):
+// числа и пользователи сравниваются как числа, даты и остальные поля - как строки
+// (даты хранятся в формате YYYY-MM-DD и сравниваются корректно). Поле без схемы
+// сравнивается как строка. Имя поля проверено по шаблону, поэтому подставляется в SQL напрямую.
+func metadataCondition(key, value string, types map[string][]string) (string, any, error) {
+	name, op, _ := strings.Cut(strings.TrimPrefix(key, "meta."), ".")
+	if !metadata.ValidName(name) {
+		return "", nil, fmt.Errorf("invalid metadata field %q", name)
+	}
+	sqlOp, ok := metadataOperators[op]
+	if !ok {
+		return "", nil, fmt.Errorf("invalid metadata operator %q", op)
+	}
+
+	fieldType := entities.FieldString
+	switch len(types[name]) {
+	case 0:
+	case 1:
+		fieldType = types[name][0]
+	default:
+		return "", nil, fmt.Errorf("metadata field %q has different types in categories, filter by category_id", name)
+	}
+
+	switch fieldType {
+	case entities.FieldNumber, entities.FieldUser:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("metadata field %q: %q is not a number", name, value)
+		}
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(metadata->'%[1]s') = 'number' THEN (metadata->>'%[1]s')::numeric END %[2]s $%%d", name, sqlOp), n, nil
+	case entities.FieldDate:
+		if _, err := time.Parse(metadata.DateLayout, value); err != nil {
+			return "", nil, fmt.Errorf("metadata field %q: %q is not a date in YYYY-MM-DD format", name, value)
+		}
+	}
+	return fmt.Sprintf("metadata->>'%s' %s $%%d", name, sqlOp), value, nil
+}
+
+// documentSortColumns - столбцы, по которым можно сортировать список документов
+var documentSortColumns = []string{"title", "created_at", "updated_at", "registered_at"}
+
+// documentOrder возвращает ORDER BY для параметра sort: столбец или meta.<поле>,
+// с префиксом "-" - по убыванию. По умолчанию - новые документы первыми.
+func documentOrder(value string) (string, error) {
+	if value == "" {
+		return "created_at DESC", nil
+	}
+	direction := "ASC"
+	if strings.HasPrefix(value, "-") {
+		direction = "DESC"
+		value = value[1:]
+	}
+
+	if name, ok := strings.CutPrefix(value, "meta."); ok {
+		if !metadata.ValidName(name) {
+			return "", fmt.Errorf("invalid metadata field %q", name)
+		}
+		// jsonb сравнивает числа как числа, строки - как строки
+		return fmt.Sprintf("metadata->'%s' %s NULLS LAST, created_at DESC", name, direction), nil
+	}
+	if !slices.Contains(documentSortColumns, value) {
+		return "", fmt.Errorf("cannot sort by %q", value)
+	}
+	return fmt.Sprintf("%s %s NULLS LAST, id DESC", value, direction), nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+
+	"backend/entities"
+)
+
+func TestMetadataCondition(t *testing.T) {
+	types := map[string][]string{
+		"amount":     {entities.FieldNumber},
+		"expires_at": {entities.FieldDate},
+		"contract":   {entities.FieldString},
+		"code":       {entities.FieldNumber, entities.FieldString},
+	}
+	cases := []struct {
+		key, value string
+		wantExpr   string
+		wantArg    any
+	}{
+		{"meta.counterparty", "ООО Ромашка", "metadata->>'counterparty' = $%d", "ООО Ромашка"},
+		{"meta.amount.gte", "1000", "CASE WHEN jsonb_typeof(metadata->'amount') = 'number' THEN (metadata->>'amount')::numeric END >= $%d", 1000.0},
+		{"meta.expires_at.lt", "2027-01-01", "metadata->>'expires_at' < $%d", "2027-01-01"},
+		// Строковое поле с похожим на число значением сравнивается как строка
+		{"meta.contract", "0042", "metadata->>'contract' = $%d", "0042"},
+	}
+	for _, c := range cases {
+		expr, arg, err := metadataCondition(c.key, c.value, types)
+		if err != nil || expr != c.wantExpr || arg != c.wantArg {
+			t.Errorf("metadataCondition(%q) = %q, %v, %v", c.key, expr, arg, err)
+		}
+	}
+
+	bad := map[string]string{
+		"meta.amount'--":     "1",
+		"meta.amount.like":   "1",
+		"meta.":              "1",
+		"meta.amount":        "много",
+		"meta.expires_at.gt": "01.01.2027",
+		"meta.code":          "1",
+	}
+	for key, value := range bad {
+		if _, _, err := metadataCondition(key, value, types); err == nil {
+			t.Errorf("metadataCondition(%q, %q) must fail", key, value)
+		}
+	}
+}
+
+func TestDocumentOrder(t *testing.T) {
+	cases := map[string]string{
+		"":             "created_at DESC",
+		"title":        "title ASC NULLS LAST, id DESC",
+		"-updated_at":  "updated_at DESC NULLS LAST, id DESC",
+		"-meta.amount": "metadata->'amount' DESC NULLS LAST, created_at DESC",
+	}
+	for value, want := range cases {
+		if got, err := documentOrder(value); err != nil || got != want {
+			t.Errorf("documentOrder(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"password", "meta.Bad Name", "-"} {
+		if _, err := documentOrder(value); err == nil {
+			t.Errorf("documentOrder(%q) must fail", value)
+		}
+	}
+}
+
+func TestJSONColumn(t *testing.T) {
+	var m entities.Metadata
+	if err := (jsonColumn{&m}).Scan([]byte(`{"amount": 10}`)); err != nil || m["amount"] != 10.0 {
+		t.Errorf("Scan = %v, %v", m, err)
+	}
+	if err := (jsonColumn{&m}).Scan(42); err == nil {
+		t.Error("Scan of unsupported type must fail")
+	}
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+	"backend/numbering"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type NumberingHandler struct {
+	db *sql.DB
+}
+
+func NewNumberingHandler(db *sql.DB) *NumberingHandler {
+	return &NumberingHandler{db: db}
+}
+
+const numberingColumns = "id, name, prefix, format, padding, year_reset, per_category, created_at"
+
+// maxRegistrationAttempts ограничивает число занятых номеров, пропускаемых при регистрации
+const maxRegistrationAttempts = 1000
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func scanNumberingSequence(row rowScanner) (entities.NumberingSequence, error) {
+	var seq entities.NumberingSequence
+	err := row.Scan(&seq.ID, &seq.Name, &seq.Prefix, &seq.Format, &seq.Padding, &seq.YearReset, &seq.PerCategory, &seq.CreatedAt)
+	return seq, err
+}
+
+// GetSequences возвращает настроенные последовательности нумерации
+func (h *NumberingHandler) GetSequences(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT " + numberingColumns + " FROM numbering_sequences ORDER BY name")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sequences := []entities.NumberingSequence{}
+	for rows.Next() {
+		seq, err := scanNumberingSequence(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sequences = append(sequences, seq)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sequences)
+}
+
+func decodeSequence(r *http.Request) (entities.NumberingSequence, error) {
+	var req entities.SaveNumberingSequenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return entities.NumberingSequence{}, err
+	}
+	seq := entities.NumberingSequence{
+		Name:        strings.TrimSpace(req.Name),
+		Prefix:      req.Prefix,
+		Format:      req.Format,
+		Padding:     req.Padding,
+		YearReset:   req.YearReset,
+		PerCategory: req.PerCategory,
+	}
+	if seq.Name == "" {
+		return seq, fmt.Errorf("name is required")
+	}
+	if seq.Format == "" {
+		seq.Format = entities.DefaultNumberFormat
+	}
+	if seq.Padding < 0 || seq.Padding > 18 {
+		return seq, fmt.Errorf("padding must be between 0 and 18")
+	}
+	return seq, numbering.ValidateFormat(seq)
+}
+
+// CreateSequence создает последовательность нумерации
+func (h *NumberingHandler) CreateSequence(w http.ResponseWriter, r *http.Request) {
+	seq, err := decodeSequence(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	seq, err = scanNumberingSequence(tx.QueryRow(`
+	INSERT INTO numbering_sequences (name, prefix, format, padding, year_reset, per_category)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING `+numberingColumns, seq.Name, seq.Prefix, seq.Format, seq.Padding, seq.YearReset, seq.PerCategory))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec := auditRecord{Action: "numbering.create", TargetType: "numbering_sequence", TargetID: intPtr(seq.ID), After: seq}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(seq)
+}
+
+// UpdateSequence изменяет последовательность. Счетчики сохраняются,
+// поэтому уже выданные номера не повторяются. year_reset и per_category входят
+// в ключ счетчика, поэтому после выдачи первого номера их менять нельзя.
+func (h *NumberingHandler) UpdateSequence(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	seq, err := decodeSequence(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокировка не дает выдать номер по старым настройкам, пока они меняются
+	before, err := scanNumberingSequence(tx.QueryRow("SELECT "+numberingColumns+" FROM numbering_sequences WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Sequence not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if seq.YearReset != before.YearReset || seq.PerCategory != before.PerCategory {
+		var issued bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM numbering_counters WHERE sequence_id = $1)", id).Scan(&issued); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if issued {
+			http.Error(w, "year_reset and per_category cannot be changed after numbers have been issued", http.StatusConflict)
+			return
+		}
+	}
+
+	seq, err = scanNumberingSequence(tx.QueryRow(`
+	UPDATE numbering_sequences SET name = $1, prefix = $2, format = $3, padding = $4, year_reset = $5, per_category = $6
+	WHERE id = $7
+	RETURNING `+numberingColumns, seq.Name, seq.Prefix, seq.Format, seq.Padding, seq.YearReset, seq.PerCategory, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rec := auditRecord{Action: "numbering.update", TargetType: "numbering_sequence", TargetID: intPtr(id), Before: before, After: seq}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seq)
+}
+
+// RegisterDocument присваивает документу регистрационный номер.
+// Счетчик, документ и журнал обновляются в одной транзакции.
+func (h *NumberingHandler) RegisterDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.RegisterDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if before.RegistrationNumber != nil {
+		http.Error(w, "Document is already registered as "+*before.RegistrationNumber, http.StatusConflict)
+		return
+	}
+
+	seq, err := scanNumberingSequence(tx.QueryRow("SELECT "+numberingColumns+" FROM numbering_sequences WHERE id = $1 FOR SHARE", req.SequenceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Sequence not found", http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	now := time.Now()
+	userID := *currentUserID(r)
+	var number string
+	// Первичный ключ журнала не дает выдать номер повторно, даже если документ удален.
+	// Номер может оказаться занят другой последовательностью с тем же форматом -
+	// тогда счетчик продвигается дальше, пока не найдется свободный.
+	for attempt := 1; ; attempt++ {
+		n, err := numbering.Next(tx, seq, now.Year(), before.CategoryID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		number = numbering.Format(seq, now.Year(), before.CategoryID, n)
+
+		if _, err := tx.Exec("SAVEPOINT registration"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec(`
+		INSERT INTO document_registrations (number, sequence_id, document_id, document_title, category_id, registered_by, registered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, number, seq.ID, id, before.Title, before.CategoryID, userID, now)
+		if err == nil {
+			break
+		}
+		if !isUniqueViolation(err) || attempt == maxRegistrationAttempts {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT registration"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	doc, err := scanDocument(tx.QueryRow(`
+	UPDATE documents SET registration_number = $1, registered_at = $2
+	WHERE id = $3
+	RETURNING `+documentColumns, number, now, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.register", TargetType: "document", TargetID: intPtr(id), Before: before, After: doc}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentRegistered, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// GetRegistrations возвращает журнал регистрации с фильтрами
+// sequence_id, number (подстрока), from и to (RFC 3339)
+func (h *NumberingHandler) GetRegistrations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if sequenceID := q.Get("sequence_id"); sequenceID != "" {
+		addCondition("sequence_id = $%d", sequenceID)
+	}
+	if number := q.Get("number"); number != "" {
+		addCondition(`number ILIKE '%%' || $%d || '%%' ESCAPE '\'`, likeEscape(number))
+	}
+	for _, bound := range []struct{ param, expr string }{{"from", "registered_at >= $%d"}, {"to", "registered_at < $%d"}} {
+		value := q.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid "+bound.param+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		addCondition(bound.expr, t)
+	}
+
+	query := "SELECT number, sequence_id, document_id, document_title, category_id, registered_by, registered_at FROM document_registrations"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY registered_at DESC, number DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	registrations := []entities.Registration{}
+	for rows.Next() {
+		var reg entities.Registration
+		if err := rows.Scan(&reg.Number, &reg.SequenceID, &reg.DocumentID, &reg.DocumentTitle, &reg.CategoryID, &reg.RegisteredBy, &reg.RegisteredAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		registrations = append(registrations, reg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registrations)
+}
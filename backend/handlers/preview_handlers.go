@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"backend/preview"
+
+	"github.com/gorilla/mux"
+)
+
+// GetPreview возвращает превью файла документа: миниатюру размера size
+// (small, medium, large) для изображений или первую страницу текстового файла.
+// Превью строятся в фоне после загрузки, до этого возвращается 404.
+func (h *DocumentHandler) GetPreview(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = preview.DefaultSize
+	}
+	if _, ok := preview.Sizes[size]; !ok && size != preview.TextSize {
+		http.Error(w, "size must be small, medium, large or text", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.loadDocument(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	// Превью показывает содержимое файла, поэтому доступно только после проверки
+	if doc.FilePath != "" && !scannedClean(w, doc.ScanStatus) {
+		return
+	}
+
+	// У текстовых файлов одно превью, поэтому для них размер не важен
+	var (
+		contentType, path, actualSize string
+		keyID                         sql.NullString
+		wrapped                       []byte
+		createdAt                     time.Time
+	)
+	err = h.db.QueryRow(`
+	SELECT size, content_type, path, key_id, wrapped_key, created_at FROM document_previews
+	WHERE document_id = $1 AND size IN ($2, $3)
+	ORDER BY size = $2 DESC LIMIT 1`, id, size, preview.TextSize).Scan(&actualSize, &contentType, &path, &keyID, &wrapped, &createdAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "preview is not available", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Превью пересоздается только вместе с файлом, поэтому время создания однозначно его определяет
+	etag := fmt.Sprintf(`"preview-%d-%s-%d"`, id, actualSize, createdAt.UnixNano())
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if notModified(w, r, etag) {
+		return
+	}
+
+	f, err := h.openPreview(path, keyID, wrapped)
+	if os.IsNotExist(err) {
+		http.Error(w, "preview is not available", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", createdAt, f)
+}
+
+// openPreview открывает файл превью. Превью, построенные до шифрования, хранятся без ключа.
+func (h *DocumentHandler) openPreview(path string, keyID sql.NullString, wrapped []byte) (io.ReadSeekCloser, error) {
+	if !keyID.Valid {
+		return os.Open(path)
+	}
+	return h.blobs.OpenSealed(path, keyID.String, wrapped)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/entities"
+	"backend/render"
+
+	"github.com/gorilla/mux"
+)
+
+// statusLabels - названия статусов в печатной форме
+var statusLabels = map[string]string{
+	entities.StatusDraft:     "Черновик",
+	entities.StatusReview:    "На согласовании",
+	entities.StatusApproved:  "Согласован",
+	entities.StatusPublished: "Опубликован",
+	entities.StatusArchived:  "В архиве",
+}
+
+// RenderDocument возвращает печатную форму документа (format=pdf): название,
+// реквизиты, метаданные и текст в Markdown. Построенный файл кэшируется до изменения документа.
+func (h *DocumentHandler) RenderDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "pdf" {
+		http.Error(w, fmt.Sprintf("unsupported format %q, only pdf is available", format), http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.loadDocument(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	in, err := h.renderInput(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := render.Key(in)
+	etag := `"render-` + key[:32] + `"`
+	if notModified(w, r, etag) {
+		return
+	}
+
+	path, ok := h.renditions.Path(id, key)
+	if !ok {
+		if path, err = h.renditions.Build(id, key, in); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.db, r, auditRecord{Action: "document.render", TargetType: "document", TargetID: intPtr(id), After: map[string]string{"format": "pdf"}})
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"document-%d.pdf\"", id))
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// renderInput собирает данные печатной формы: реквизиты документа
+// и метаданные с подписями полей из схемы категории
+func (h *DocumentHandler) renderInput(doc entities.Document) (render.Input, error) {
+	var fields []render.Field
+	if doc.RegistrationNumber != nil {
+		value := *doc.RegistrationNumber
+		if doc.RegisteredAt != nil {
+			value += " от " + doc.RegisteredAt.Format("02.01.2006")
+		}
+		fields = append(fields, render.Field{Label: "Регистрационный номер", Value: value})
+	}
+
+	var schema []entities.CategoryField
+	if doc.CategoryID != nil {
+		var name string
+		err := h.db.QueryRow("SELECT name FROM categories WHERE id = $1", *doc.CategoryID).Scan(&name)
+		if err != nil && err != sql.ErrNoRows {
+			return render.Input{}, err
+		}
+		if name != "" {
+			fields = append(fields, render.Field{Label: "Категория", Value: name})
+		}
+		if schema, err = loadCategoryFields(h.db, *doc.CategoryID); err != nil {
+			return render.Input{}, err
+		}
+	}
+
+	status := statusLabels[doc.Status]
+	if status == "" {
+		status = doc.Status
+	}
+	fields = append(fields, render.Field{Label: "Статус", Value: status})
+	if len(doc.Tags) > 0 {
+		fields = append(fields, render.Field{Label: "Теги", Value: strings.Join(doc.Tags, ", ")})
+	}
+
+	metaFields, err := h.metadataFields(schema, doc.Metadata)
+	if err != nil {
+		return render.Input{}, err
+	}
+
+	return render.Input{
+		Title:   doc.Title,
+		Fields:  append(fields, metaFields...),
+		Content: doc.Content,
+		Footer:  fmt.Sprintf("Документ %d, изменен %s", doc.ID, doc.UpdatedAt.Format("02.01.2006 15:04")),
+	}, nil
+}
+
+// metadataFields выводит значения метаданных в порядке схемы. Поля, которых
+// уже нет в схеме, идут в конце по алфавиту; пользователи выводятся по логину.
+func (h *DocumentHandler) metadataFields(schema []entities.CategoryField, values entities.Metadata) ([]render.Field, error) {
+	var fields []render.Field
+	known := map[string]bool{}
+	for _, f := range schema {
+		known[f.Name] = true
+		value, ok := values[f.Name]
+		if !ok {
+			continue
+		}
+		label := f.Label
+		if label == "" {
+			label = f.Name
+		}
+		text := formatMetadataValue(value)
+		if id, isNumber := value.(float64); isNumber && f.Type == entities.FieldUser {
+			var login string
+			err := h.db.QueryRow("SELECT login FROM users WHERE id = $1", int(id)).Scan(&login)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			if login != "" {
+				text = login
+			}
+		}
+		fields = append(fields, render.Field{Label: label, Value: text})
+	}
+
+	var extra []string
+	for name := range values {
+		if !known[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		fields = append(fields, render.Field{Label: name, Value: formatMetadataValue(values[name])})
+	}
+	return fields, nil
+}
+
+func formatMetadataValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
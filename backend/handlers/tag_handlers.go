@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type TagHandler struct {
+	db *sql.DB
+}
+
+func NewTagHandler(db *sql.DB) *TagHandler {
+	return &TagHandler{db: db}
+}
+
+// normalizeTag убирает лишние пробелы в названии тега
+func normalizeTag(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if utf8.RuneCountInString(name) > entities.MaxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", name, entities.MaxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags нормализует список тегов, пропуская пустые
+// и повторы без учета регистра (сохраняется первое написание)
+func normalizeTags(names []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name, err := normalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// lowerTags приводит названия к нижнему регистру для сравнения с lower(tags.name)
+func lowerTags(names []string) []string {
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = strings.ToLower(name)
+	}
+	return result
+}
+
+// tagCondition возвращает условие отбора документов по тегам (массив тегов в нижнем регистре -
+// параметр $%d): mode all (по умолчанию) - все теги, any - хотя бы один
+func tagCondition(mode string) (string, error) {
+	switch mode {
+	case "", "all":
+		return `(SELECT count(*) FROM document_tags dt JOIN tags t ON t.id = dt.tag_id
+			WHERE dt.document_id = documents.id AND lower(t.name) = ANY($%[1]d)) = cardinality($%[1]d::text[])`, nil
+	case "any":
+		return `EXISTS (SELECT 1 FROM document_tags dt JOIN tags t ON t.id = dt.tag_id
+			WHERE dt.document_id = documents.id AND lower(t.name) = ANY($%d))`, nil
+	}
+	return "", fmt.Errorf("tag_mode must be all or any")
+}
+
+// GetTags возвращает теги с числом документов. Фильтр q - по началу названия.
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+	SELECT t.id, t.name, count(dt.document_id)
+	FROM tags t
+	LEFT JOIN document_tags dt ON dt.tag_id = t.id
+	WHERE lower(t.name) LIKE lower($1) || '%' ESCAPE '\'
+	GROUP BY t.id
+	ORDER BY lower(t.name)`, likeEscape(r.URL.Query().Get("q")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []entities.Tag{}
+	for rows.Next() {
+		var tag entities.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Count); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// SetDocumentTags заменяет теги документа; отсутствующие теги создаются
+func (h *TagHandler) SetDocumentTags(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.SetTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, before, ok := lockedDocumentTx(h.db, w, id)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if preconditionFailed(r, documentETag(before)) {
+		http.Error(w, "document has been modified", http.StatusPreconditionFailed)
+		return
+	}
+	// Теги можно менять в любом статусе, но не в чужой блокировке
+	if userID := *currentUserID(r); lockedByOther(before, userID) {
+		status, msg := editConflict(before, userID)
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Конфликт по уникальному индексу означает, что тег уже есть (возможно, в другом регистре)
+	_, err = tx.Exec(`
+	INSERT INTO tags (name) SELECT unnest($1::text[])
+	ON CONFLICT (lower(name)) DO NOTHING`, pq.Array(tags))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM document_tags WHERE document_id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+	INSERT INTO document_tags (document_id, tag_id)
+	SELECT $1, id FROM tags WHERE lower(name) = ANY($2)`, id, pq.Array(lowerTags(tags)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Обновление строки увеличивает row_version, так что ETag документа меняется
+	doc, err := scanDocument(tx.QueryRow("UPDATE documents SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+documentColumns, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "document.tags", TargetType: "document", TargetID: intPtr(id),
+		Before: map[string]any{"tags": before.Tags}, After: map[string]any{"tags": doc.Tags}}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentUpdated, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", documentETag(doc))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// touchTaggedDocuments обновляет row_version документов с тегом,
+// чтобы после переименования или слияния их ETag сменился
+func touchTaggedDocuments(tx *sql.Tx, tagID int) error {
+	_, err := tx.Exec("UPDATE documents SET row_version = row_version WHERE id IN (SELECT document_id FROM document_tags WHERE tag_id = $1)", tagID)
+	return err
+}
+
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func loadTag(q rowQueryer, id int) (entities.Tag, error) {
+	var tag entities.Tag
+	err := q.QueryRow(`
+	SELECT t.id, t.name, (SELECT count(*) FROM document_tags WHERE tag_id = t.id)
+	FROM tags t WHERE t.id = $1`, id).Scan(&tag.ID, &tag.Name, &tag.Count)
+	return tag, err
+}
+
+// RenameTag переименовывает тег. Если название занято другим тегом, возвращает 409 -
+// в этом случае теги нужно объединить.
+func (h *TagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.RenameTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := normalizeTag(req.Name)
+	if err != nil || name == "" {
+		http.Error(w, "invalid tag name", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadTag(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var otherID int
+	err = tx.QueryRow("SELECT id FROM tags WHERE lower(name) = lower($1) AND id <> $2", name, id).Scan(&otherID)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("tag %q already exists (id %d), merge the tags instead", name, otherID), http.StatusConflict)
+		return
+	}
+	if err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE tags SET name = $1 WHERE id = $2", name, id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := touchTaggedDocuments(tx, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tag, err := loadTag(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "tag.rename", TargetType: "tag", TargetID: intPtr(id), Before: before, After: tag}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// MergeTag переносит документы тега в тег into и удаляет исходный тег
+func (h *TagHandler) MergeTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.MergeTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Into == id {
+		http.Error(w, "cannot merge a tag into itself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	source, err := loadTag(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if _, err := loadTag(tx, req.Into); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "target tag not found", http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := touchTaggedDocuments(tx, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+	INSERT INTO document_tags (document_id, tag_id)
+	SELECT document_id, $2 FROM document_tags WHERE tag_id = $1
+	ON CONFLICT DO NOTHING`, id, req.Into)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target, err := loadTag(tx, req.Into)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "tag.merge", TargetType: "tag", TargetID: intPtr(id), Before: source, After: target}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(target)
+}
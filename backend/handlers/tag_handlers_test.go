@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := normalizeTags([]string{" Q3   audit ", "urgent", "", "URGENT", "q3 audit", "Срочно"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Q3 audit", "urgent", "Срочно"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeTags = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(lowerTags(got), []string{"q3 audit", "urgent", "срочно"}) {
+		t.Errorf("lowerTags = %v", lowerTags(got))
+	}
+
+	if _, err := normalizeTags([]string{strings.Repeat("я", 65)}); err == nil {
+		t.Error("too long tag must be rejected")
+	}
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+)
+
+type TaskHandler struct {
+	db *sql.DB
+}
+
+func NewTaskHandler(db *sql.DB) *TaskHandler {
+	return &TaskHandler{db: db}
+}
+
+const taskColumns = "id, document_id, parent_id, title, description, assignee_id, author_id, due_at, priority, status, overdue, created_at, updated_at, completed_at"
+
+func scanTask(row rowScanner) (entities.Task, error) {
+	var t entities.Task
+	err := row.Scan(&t.ID, &t.DocumentID, &t.ParentID, &t.Title, &t.Description, &t.AssigneeID, &t.AuthorID,
+		&t.DueAt, &t.Priority, &t.Status, &t.Overdue, &t.CreatedAt, &t.UpdatedAt, &t.CompletedAt)
+	return t, err
+}
+
+// GetTasks возвращает поручения с фильтрами. assignee=me - входящие текущего пользователя.
+func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	userID := *currentUserID(r)
+
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	for _, name := range []string{"assignee", "author"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		id := userID
+		if v != "me" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			id = n
+		}
+		addCondition(name+"_id = $%d", id)
+	}
+	if v := q.Get("document_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid document_id", http.StatusBadRequest)
+			return
+		}
+		addCondition("document_id = $%d", id)
+	}
+	if v := q.Get("status"); v != "" {
+		addCondition("status = $%d", v)
+	} else if q.Get("all") != "true" {
+		// По умолчанию показываем только незавершенные поручения
+		conditions = append(conditions, "status IN ('open', 'in_progress')")
+	}
+	if v := q.Get("priority"); v != "" {
+		addCondition("priority = $%d", v)
+	}
+	if q.Get("overdue") == "true" {
+		conditions = append(conditions, "overdue")
+	}
+
+	query := "SELECT " + taskColumns + " FROM tasks"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY overdue DESC, due_at NULLS LAST,
+		CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END, id`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tasks := []entities.Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tasks = append(tasks, task)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// GetDocumentTasks возвращает дерево поручений документа
+func (h *TaskHandler) GetDocumentTasks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := h.loadDocumentTasks(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildTaskTree(tasks, nil))
+}
+
+// GetTask возвращает поручение с подзадачами
+func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	task, err := scanTask(h.db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	all, err := h.loadDocumentTasks(task.DocumentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	task.Subtasks = buildTaskTree(all, &task.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// CreateTask создает поручение (или подзадачу) по документу
+func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	docID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.CreateTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Priority == "" {
+		req.Priority = "normal"
+	}
+	if msg := validateTask(req.Title, req.AssigneeID, req.Priority, entities.TaskOpen); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM documents WHERE id = $1)", docID).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if req.ParentID != nil {
+		var parentDocID int
+		err := tx.QueryRow("SELECT document_id FROM tasks WHERE id = $1", *req.ParentID).Scan(&parentDocID)
+		if err == sql.ErrNoRows || (err == nil && parentDocID != docID) {
+			http.Error(w, "parent task not found in this document", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	task, err := scanTask(tx.QueryRow(`
+	INSERT INTO tasks (document_id, parent_id, title, description, assignee_id, author_id, due_at, priority, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING `+taskColumns,
+		docID, req.ParentID, req.Title, req.Description, req.AssigneeID, *currentUserID(r), req.DueAt, req.Priority, entities.TaskOpen))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec := auditRecord{Action: "task.create", TargetType: "task", TargetID: intPtr(task.ID), After: task}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.TaskCreated, task}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
+}
+
+// UpdateTask обновляет поручение (автор или администратор)
+func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	var req entities.UpdateTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateTask(req.Title, req.AssigneeID, req.Priority, req.Status); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	h.applyUpdate(w, r, false, func(task *entities.Task) {
+		task.Title = req.Title
+		task.Description = req.Description
+		task.AssigneeID = req.AssigneeID
+		task.DueAt = req.DueAt
+		task.Priority = req.Priority
+		task.Status = req.Status
+	})
+}
+
+// UpdateTaskStatus меняет статус поручения; доступно также исполнителю
+func (h *TaskHandler) UpdateTaskStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(entities.TaskStatuses, req.Status) {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	h.applyUpdate(w, r, true, func(task *entities.Task) {
+		task.Status = req.Status
+	})
+}
+
+// applyUpdate загружает поручение, проверяет права, применяет изменения и сохраняет
+func (h *TaskHandler) applyUpdate(w http.ResponseWriter, r *http.Request, assigneeAllowed bool, change func(*entities.Task)) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	allowed := before.AuthorID == userID || role == "admin" || (assigneeAllowed && before.AssigneeID == userID)
+	if !allowed {
+		http.Error(w, "you are not allowed to change this task", http.StatusForbidden)
+		return
+	}
+
+	task := before
+	change(&task)
+
+	if task.Status == entities.TaskDone {
+		var openSubtasks int
+		err := tx.QueryRow("SELECT COUNT(*) FROM tasks WHERE parent_id = $1 AND status IN ('open', 'in_progress')", id).Scan(&openSubtasks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if openSubtasks > 0 {
+			http.Error(w, "task has unfinished subtasks", http.StatusConflict)
+			return
+		}
+	}
+
+	// Флаг просрочки сохраняется, только пока срок по-прежнему истек
+	active := task.Status == entities.TaskOpen || task.Status == entities.TaskInProgress
+	overdue := before.Overdue && active && task.DueAt != nil && task.DueAt.Before(time.Now())
+
+	task, err = scanTask(tx.QueryRow(`
+	UPDATE tasks
+	SET title = $1, description = $2, assignee_id = $3, due_at = $4, priority = $5, status = $6, overdue = $7,
+		completed_at = CASE WHEN $8 THEN NULL ELSE COALESCE(completed_at, CURRENT_TIMESTAMP) END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $9
+	RETURNING `+taskColumns,
+		task.Title, task.Description, task.AssigneeID, task.DueAt, task.Priority, task.Status, overdue, active, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec := auditRecord{Action: "task.update", TargetType: "task", TargetID: intPtr(id), Before: before, After: task}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.TaskUpdated, task}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// DeleteTask удаляет поручение вместе с подзадачами (автор или администратор)
+func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if before.AuthorID != userID && role != "admin" {
+		http.Error(w, "you are not allowed to delete this task", http.StatusForbidden)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM tasks WHERE id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec := auditRecord{Action: "task.delete", TargetType: "task", TargetID: intPtr(id), Before: before}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.TaskDeleted, before}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TaskHandler) loadDocumentTasks(docID int) ([]entities.Task, error) {
+	rows, err := h.db.Query("SELECT "+taskColumns+" FROM tasks WHERE document_id = $1 ORDER BY id", docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []entities.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// buildTaskTree собирает подзадачи parentID рекурсивно; nil - корневые поручения
+func buildTaskTree(tasks []entities.Task, parentID *int) []entities.Task {
+	result := []entities.Task{}
+	for _, t := range tasks {
+		if (parentID == nil && t.ParentID == nil) || (parentID != nil && t.ParentID != nil && *t.ParentID == *parentID) {
+			t.Subtasks = buildTaskTree(tasks, &t.ID)
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func validateTask(title string, assigneeID int, priority, status string) string {
+	switch {
+	case title == "":
+		return "title is required"
+	case assigneeID == 0:
+		return "assignee_id is required"
+	case !slices.Contains(entities.TaskPriorities, priority):
+		return "invalid priority"
+	case !slices.Contains(entities.TaskStatuses, status):
+		return "invalid status"
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"testing"
+
+	"backend/entities"
+)
+
+func TestBuildTaskTree(t *testing.T) {
+	one, two := 1, 2
+	tasks := []entities.Task{
+		{ID: 1},
+		{ID: 2, ParentID: &one},
+		{ID: 3, ParentID: &two},
+		{ID: 4},
+		{ID: 5, ParentID: &one},
+	}
+
+	roots := buildTaskTree(tasks, nil)
+	if len(roots) != 2 || roots[0].ID != 1 || roots[1].ID != 4 {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if len(roots[0].Subtasks) != 2 || roots[0].Subtasks[0].ID != 2 || roots[0].Subtasks[1].ID != 5 {
+		t.Fatalf("unexpected subtasks of 1: %+v", roots[0].Subtasks)
+	}
+	if len(roots[0].Subtasks[0].Subtasks) != 1 || roots[0].Subtasks[0].Subtasks[0].ID != 3 {
+		t.Errorf("unexpected subtasks of 2: %+v", roots[0].Subtasks[0].Subtasks)
+	}
+}
+
+func TestValidateTask(t *testing.T) {
+	if msg := validateTask("Подготовить ответ", 3, "high", entities.TaskOpen); msg != "" {
+		t.Errorf("valid task rejected: %s", msg)
+	}
+	if validateTask("", 3, "high", entities.TaskOpen) == "" {
+		t.Error("empty title accepted")
+	}
+	if validateTask("x", 0, "high", entities.TaskOpen) == "" {
+		t.Error("missing assignee accepted")
+	}
+	if validateTask("x", 3, "critical", entities.TaskOpen) == "" {
+		t.Error("unknown priority accepted")
+	}
+}
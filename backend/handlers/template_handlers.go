@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/entities"
+	"backend/events"
+	"backend/templates"
+
+	"github.com/gorilla/mux"
+)
+
+type TemplateHandler struct {
+	db *sql.DB
+}
+
+func NewTemplateHandler(db *sql.DB) *TemplateHandler {
+	return &TemplateHandler{db: db}
+}
+
+// builtinPlaceholders - подстановки, которые заполняет сервер
+var builtinPlaceholders = []string{"today", "author"}
+
+// metaPrefix - подстановки {{meta.<поле>}} берутся из метаданных создаваемого документа
+const metaPrefix = "meta."
+
+const templateColumns = "id, name, description, title, body, category_id, metadata, created_by, created_at, updated_at"
+
+func scanTemplate(row rowScanner) (entities.Template, error) {
+	var t entities.Template
+	err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Title, &t.Body, &t.CategoryID, jsonColumn{&t.Metadata}, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, err
+	}
+	t.Placeholders = templateVariables(t)
+	return t, nil
+}
+
+// templateTexts возвращает все тексты шаблона, в которых допускаются подстановки
+func templateTexts(t entities.Template) []string {
+	texts := []string{t.Title, t.Body}
+	for _, value := range t.Metadata {
+		if s, ok := value.(string); ok {
+			texts = append(texts, s)
+		}
+	}
+	return texts
+}
+
+// templateVariables возвращает подстановки, значения которых передает пользователь
+func templateVariables(t entities.Template) []string {
+	names := []string{}
+	for _, name := range templates.Placeholders(templateTexts(t)...) {
+		if strings.HasPrefix(name, metaPrefix) || slices.Contains(builtinPlaceholders, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// renderTemplate подставляет значения в шаблон. Сначала заполняются метаданные
+// шаблона (переопределяемые метаданными запроса), затем название и текст, в которых
+// доступны и значения метаданных через {{meta.<поле>}}. Возвращает имена
+// подстановок без значений.
+func renderTemplate(t entities.Template, values map[string]any, overrides entities.Metadata, builtins map[string]string) (title, body string, meta entities.Metadata, missing []string) {
+	flat := templates.Flatten(values)
+	for name, value := range builtins {
+		flat[name] = value
+	}
+
+	missingSet := map[string]bool{}
+	render := func(text string) string {
+		result, absent := templates.Render(text, flat)
+		for _, name := range absent {
+			missingSet[name] = true
+		}
+		return result
+	}
+
+	meta = entities.Metadata{}
+	for key, value := range t.Metadata {
+		if s, ok := value.(string); ok {
+			value = render(s)
+		}
+		meta[key] = value
+	}
+	for key, value := range overrides {
+		meta[key] = value
+	}
+
+	for name, value := range templates.Flatten(meta) {
+		flat[metaPrefix+name] = value
+	}
+	title = render(t.Title)
+	body = render(t.Body)
+
+	for name := range missingSet {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return title, body, meta, missing
+}
+
+// GetTemplates возвращает шаблоны по названию. Фильтр category_id - по категории по умолчанию.
+func (h *TemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT " + templateColumns + " FROM templates"
+	var args []any
+	if v := r.URL.Query().Get("category_id"); v != "" {
+		categoryID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid category_id", http.StatusBadRequest)
+			return
+		}
+		query += " WHERE category_id = $1"
+		args = append(args, categoryID)
+	}
+	query += " ORDER BY name, id"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []entities.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetTemplate возвращает шаблон по ID
+func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow("SELECT "+templateColumns+" FROM templates WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// decodeTemplate читает и проверяет шаблон из тела запроса
+func (h *TemplateHandler) decodeTemplate(r *http.Request) (entities.SaveTemplateRequest, string, int, error) {
+	var req entities.SaveTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, "", http.StatusBadRequest, err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return req, "", http.StatusBadRequest, fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		return req, "", http.StatusBadRequest, fmt.Errorf("title is required")
+	}
+	if req.Metadata == nil {
+		req.Metadata = entities.Metadata{}
+	}
+	if req.CategoryID != nil {
+		var exists bool
+		if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)", *req.CategoryID).Scan(&exists); err != nil {
+			return req, "", http.StatusInternalServerError, err
+		}
+		if !exists {
+			return req, "", http.StatusBadRequest, fmt.Errorf("category %d not found", *req.CategoryID)
+		}
+	}
+	meta, err := json.Marshal(req.Metadata)
+	if err != nil {
+		return req, "", http.StatusBadRequest, err
+	}
+	return req, string(meta), 0, nil
+}
+
+// CreateTemplate создает шаблон документа
+func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	req, meta, status, err := h.decodeTemplate(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	t, err := scanTemplate(tx.QueryRow(`
+	INSERT INTO templates (name, description, title, body, category_id, metadata, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING `+templateColumns, req.Name, req.Description, req.Title, req.Body, req.CategoryID, meta, *currentUserID(r)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "template.create", TargetType: "template", TargetID: intPtr(t.ID), After: t}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// editableTemplate загружает шаблон и проверяет, что его может менять
+// текущий пользователь: автор или администратор
+func (h *TemplateHandler) editableTemplate(w http.ResponseWriter, r *http.Request) (entities.Template, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return entities.Template{}, false
+	}
+
+	t, err := scanTemplate(h.db.QueryRow("SELECT "+templateColumns+" FROM templates WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return t, false
+	}
+
+	userID := *currentUserID(r)
+	if t.CreatedBy != userID {
+		role, err := userRole(h.db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return t, false
+		}
+		if role != "admin" {
+			http.Error(w, "only the author or an administrator can change the template", http.StatusForbidden)
+			return t, false
+		}
+	}
+	return t, true
+}
+
+// UpdateTemplate заменяет шаблон
+func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.editableTemplate(w, r)
+	if !ok {
+		return
+	}
+	req, meta, status, err := h.decodeTemplate(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	t, err := scanTemplate(tx.QueryRow(`
+	UPDATE templates
+	SET name = $1, description = $2, title = $3, body = $4, category_id = $5, metadata = $6, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $7
+	RETURNING `+templateColumns, req.Name, req.Description, req.Title, req.Body, req.CategoryID, meta, before.ID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rec := auditRecord{Action: "template.update", TargetType: "template", TargetID: intPtr(t.ID), Before: before, After: t}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// DeleteTemplate удаляет шаблон. Созданные по нему документы не затрагиваются.
+func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.editableTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM templates WHERE id = $1", before.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "template.delete", TargetType: "template", TargetID: intPtr(before.ID), Before: before}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateFromTemplate создает документ в категории шаблона, подставляя переданные значения.
+// Если для каких-то подстановок значений нет, возвращает 400 со списком имен.
+func (h *TemplateHandler) CreateFromTemplate(w http.ResponseWriter, r *http.Request) {
+	tid, err := strconv.Atoi(mux.Vars(r)["tid"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.CreateFromTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow("SELECT "+templateColumns+" FROM templates WHERE id = $1", tid))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	userID := *currentUserID(r)
+	var author string
+	if err := h.db.QueryRow("SELECT login FROM users WHERE id = $1", userID).Scan(&author); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	builtins := map[string]string{
+		"today":  time.Now().Format("2006-01-02"),
+		"author": author,
+	}
+
+	title, body, meta, missing := renderTemplate(t, req.Values, req.Metadata, builtins)
+	if len(missing) > 0 {
+		http.Error(w, "missing values for placeholders: "+strings.Join(missing, ", "), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	doc, err := insertDocument(tx, entities.CreateDocumentRequest{
+		Title:      title,
+		Content:    body,
+		CategoryID: t.CategoryID,
+		Metadata:   meta,
+	}, documentFile{}, userID)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
+
+	rec := auditRecord{Action: "document.create", TargetType: "document", TargetID: intPtr(doc.ID),
+		After: map[string]any{"document": doc, "template_id": t.ID}}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentCreated, doc}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", documentETag(doc))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
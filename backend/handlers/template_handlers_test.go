@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/entities"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tmpl := entities.Template{
+		Title: "Договор с {{client.name}} от {{today}}",
+		Body:  "Сумма: {{meta.amount}}. Подготовил {{author}}. Срок: {{due}}",
+		Metadata: entities.Metadata{
+			"counterparty": "{{client.name}}",
+			"amount":       1000.0,
+		},
+	}
+	if got := templateVariables(tmpl); !reflect.DeepEqual(got, []string{"client.name", "due"}) {
+		t.Errorf("templateVariables = %v", got)
+	}
+
+	values := map[string]any{"client": map[string]any{"name": "ООО Ромашка"}}
+	builtins := map[string]string{"today": "2026-01-15", "author": "ivanov"}
+	title, body, meta, missing := renderTemplate(tmpl, values, entities.Metadata{"amount": 2500.0}, builtins)
+
+	if title != "Договор с ООО Ромашка от 2026-01-15" {
+		t.Errorf("title = %q", title)
+	}
+	if body != "Сумма: 2500. Подготовил ivanov. Срок: {{due}}" {
+		t.Errorf("body = %q", body)
+	}
+	wantMeta := entities.Metadata{"counterparty": "ООО Ромашка", "amount": 2500.0}
+	if !reflect.DeepEqual(meta, wantMeta) {
+		t.Errorf("meta = %v, want %v", meta, wantMeta)
+	}
+	if !reflect.DeepEqual(missing, []string{"due"}) {
+		t.Errorf("missing = %v", missing)
+	}
+	if tmpl.Metadata["counterparty"] != "{{client.name}}" {
+		t.Error("template metadata must not be modified")
+	}
+}
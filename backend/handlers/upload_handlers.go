@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"backend/entities"
+	"backend/events"
+	"backend/upload"
+
+	"github.com/gorilla/mux"
+)
+
+// formOverhead - запас размера multipart-тела на поля формы помимо файла
+const formOverhead = 1 << 20
+
+// checkUpload проверяет размер и тип загружаемого файла по правилам загрузки и ограничению
+// категории и возвращает тип файла. Позиция чтения file возвращается в начало.
+func (h *DocumentHandler) checkUpload(file multipart.File, name string, size int64, categoryID *int) (string, error) {
+	var categoryMax *int64
+	if categoryID != nil {
+		err := h.db.QueryRow("SELECT max_file_size FROM categories WHERE id = $1", *categoryID).Scan(&categoryMax)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	if err := h.uploads.CheckSize(name, size, categoryMax); err != nil {
+		return "", err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType, uerr := h.uploads.CheckType(name, head[:n])
+	if uerr != nil {
+		return "", uerr
+	}
+	return contentType, nil
+}
+
+// writeUploadError отвечает на отказ в загрузке JSON-описанием причины
+func writeUploadError(w http.ResponseWriter, err error) {
+	var uerr *upload.Error
+	if !errors.As(err, &uerr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusUnsupportedMediaType
+	if uerr.Code == upload.CodeTooLarge {
+		status = http.StatusRequestEntityTooLarge
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(uerr)
+}
+
+// UpdateCategoryLimits задает ограничение размера файлов категории (только для администраторов).
+// Ограничение категории не может превышать глобальное; null снимает его.
+func (h *CategoryHandler) UpdateCategoryLimits(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.UpdateCategoryLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize <= 0 || *req.MaxFileSize > h.uploads.MaxSize {
+			http.Error(w, fmt.Sprintf("max_file_size must be between 1 and %d", h.uploads.MaxSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	before, err := h.loadCategory(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var category entities.Category
+	err = tx.QueryRow("UPDATE categories SET max_file_size = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING "+categoryColumns,
+		req.MaxFileSize, id).Scan(categoryFields(&category)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "category.limits", TargetType: "category", TargetID: intPtr(id), Before: before, After: category}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.CategoryUpdated, category}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", categoryETag(category))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
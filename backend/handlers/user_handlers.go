@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"backend/entities"
+
+	"github.com/gorilla/mux"
+)
+
+type UserHandler struct {
+	db *sql.DB
+}
+
+func NewUserHandler(db *sql.DB) *UserHandler {
+	return &UserHandler{db: db}
+}
+
+// SetUserRole назначает пользователю роль из entities.UserRoles
+func (h *UserHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var req entities.SetUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(entities.UserRoles, req.Role) {
+		http.Error(w, "unknown role "+req.Role, http.StatusBadRequest)
+		return
+	}
+	// Иначе последний администратор может случайно лишить себя доступа
+	if id == *currentUserID(r) {
+		http.Error(w, "you cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var user entities.User
+	err = tx.QueryRow("SELECT id, login, role, created_at FROM users WHERE id = $1 FOR UPDATE", id).
+		Scan(&user.ID, &user.Login, &user.Role, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	before := user
+	if _, err := tx.Exec("UPDATE users SET role = $2 WHERE id = $1", id, req.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user.Role = req.Role
+
+	rec := auditRecord{Action: "user.role", TargetType: "user", TargetID: intPtr(id), Before: before, After: user}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
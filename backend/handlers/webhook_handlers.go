@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"backend/entities"
+	"backend/middleware"
+	"backend/webhooks"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type WebhookHandler struct {
+	db *sql.DB
+}
+
+func NewWebhookHandler(db *sql.DB) *WebhookHandler {
+	return &WebhookHandler{db: db}
+}
+
+// GetWebhooks возвращает список зарегистрированных вебхуков
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT id, url, events, active, user_id, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []entities.Webhook{}
+	for rows.Next() {
+		var hook entities.Webhook
+		err := rows.Scan(&hook.ID, &hook.URL, pq.Array(&hook.Events), &hook.Active, &hook.UserID, &hook.CreatedAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hooks = append(hooks, hook)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// CreateWebhook регистрирует вебхук. Секрет возвращается только в этом ответе.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req entities.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		http.Error(w, "events are required", http.StatusBadRequest)
+		return
+	}
+	for _, event := range req.Events {
+		if !webhooks.ValidPattern(event) {
+			http.Error(w, "unknown event: "+event, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			http.Error(w, "failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = hex.EncodeToString(buf)
+	}
+
+	userID := r.Context().Value(middleware.UserIDContextKey).(int)
+
+	query := `
+	INSERT INTO webhooks (url, events, secret, user_id) 
+	VALUES ($1, $2, $3, $4) 
+	RETURNING id, url, events, secret, active, user_id, created_at`
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var hook entities.Webhook
+	err = tx.QueryRow(query, req.URL, pq.Array(req.Events), req.Secret, userID).
+		Scan(&hook.ID, &hook.URL, pq.Array(&hook.Events), &hook.Secret, &hook.Active, &hook.UserID, &hook.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "webhook.create", TargetType: "webhook", TargetID: intPtr(hook.ID), After: map[string]any{"url": hook.URL, "events": hook.Events}}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом доставок
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	rec := auditRecord{Action: "webhook.delete", TargetType: "webhook", TargetID: intPtr(id)}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries возвращает журнал доставок вебхука
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+	SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code,
+		COALESCE(last_error, ''), created_at, delivered_at
+	FROM webhook_deliveries WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+	ORDER BY id DESC LIMIT 100`
+
+	rows, err := h.db.Query(query, id, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []entities.WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d       entities.WebhookDelivery
+			payload []byte
+		)
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Redeliver повторно ставит доставку в очередь
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(vars["delivery_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	newID, err := webhooks.Redeliver(tx, id, deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rec := auditRecord{Action: "webhook.redeliver", TargetType: "webhook", TargetID: intPtr(id), After: map[string]int64{"delivery_id": deliveryID, "new_delivery_id": newID}}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"id": newID, "status": webhooks.StatusPending})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"backend/entities"
+	"backend/events"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type WorkflowHandler struct {
+	db *sql.DB
+}
+
+func NewWorkflowHandler(db *sql.DB) *WorkflowHandler {
+	return &WorkflowHandler{db: db}
+}
+
+// GetWorkflow возвращает переходы категории или схему по умолчанию
+func (h *WorkflowHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	transitions, err := loadWorkflow(h.db, &id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transitions)
+}
+
+// UpdateWorkflow заменяет переходы категории. Пустой список возвращает схему по умолчанию.
+func (h *WorkflowHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req entities.UpdateWorkflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, t := range req.Transitions {
+		if t.Name == "" {
+			http.Error(w, "transition name is required", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(entities.DocumentStatuses, t.FromStatus) || !slices.Contains(entities.DocumentStatuses, t.ToStatus) {
+			http.Error(w, "unknown status in transition "+t.Name, http.StatusBadRequest)
+			return
+		}
+		for _, role := range t.AllowedRoles {
+			if !slices.Contains(entities.UserRoles, role) {
+				http.Error(w, "unknown role "+role+" in transition "+t.Name, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	before, err := loadWorkflow(h.db, &id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)", id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM workflow_transitions WHERE category_id = $1", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, t := range req.Transitions {
+		if t.AllowedRoles == nil {
+			t.AllowedRoles = []string{}
+		}
+		_, err := tx.Exec(`
+		INSERT INTO workflow_transitions (category_id, name, from_status, to_status, allowed_roles, allow_author)
+		VALUES ($1, $2, $3, $4, $5, $6)`, id, t.Name, t.FromStatus, t.ToStatus, pq.Array(t.AllowedRoles), t.AllowAuthor)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	transitions, err := loadWorkflow(tx, &id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := auditRecord{Action: "category.workflow_update", TargetType: "category", TargetID: intPtr(id), Before: before, After: transitions}
+	if err := commitAudited(tx, r, rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transitions)
+}
+
+// GetAvailableTransitions возвращает переходы, доступные текущему пользователю
+func (h *WorkflowHandler) GetAvailableTransitions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		status     string
+		categoryID *int
+		authorID   int
+	)
+	err = h.db.QueryRow("SELECT status, category_id, user_id FROM documents WHERE id = $1", id).Scan(&status, &categoryID, &authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	transitions, err := loadWorkflow(h.db, categoryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	available := []entities.WorkflowTransition{}
+	for _, t := range transitions {
+		if t.FromStatus == status && transitionAllowed(t, role, userID == authorID) {
+			available = append(available, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(available)
+}
+
+// Ошибки выбора перехода отображаются в 404, 409 и 403 соответственно
+var (
+	errTransitionNotFound   = errors.New("transition not found")
+	errTransitionNotAllowed = errors.New("transition is not allowed from the current status")
+	errTransitionForbidden  = errors.New("you are not allowed to perform this transition")
+)
+
+// ApplyTransition переводит документ в новый статус по имени перехода
+func (h *WorkflowHandler) ApplyTransition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	name := vars["name"]
+
+	var req entities.TransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := *currentUserID(r)
+	role, err := userRole(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanDocument(tx.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Пока идет согласование, статус меняет только маршрут (или его отмена)
+	active, err := approvalInProgress(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if active {
+		http.Error(w, "document has an approval route in progress; cancel it first", http.StatusConflict)
+		return
+	}
+
+	transitions, err := loadWorkflow(tx, before.CategoryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	transition, err := resolveTransition(transitions, name, before.Status, role, userID == before.UserID)
+	switch err {
+	case nil:
+	case errTransitionNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errTransitionForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	doc, err := scanDocument(tx.QueryRow(`
+	UPDATE documents SET status = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	RETURNING `+documentColumns, transition.ToStatus, id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := entities.TransitionResult{
+		Document:   doc,
+		Transition: transition.Name,
+		FromStatus: before.Status,
+		ToStatus:   doc.Status,
+		Comment:    req.Comment,
+	}
+	rec := auditRecord{Action: "document.transition", TargetType: "document", TargetID: intPtr(id), Before: before, After: result}
+	if err := commitAudited(tx, r, rec, outboxEvent{events.DocumentStatusChanged, result}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// resolveTransition находит переход по имени из текущего статуса и проверяет права
+func resolveTransition(transitions []entities.WorkflowTransition, name, status, role string, isAuthor bool) (entities.WorkflowTransition, error) {
+	err := errTransitionNotFound
+	for _, t := range transitions {
+		if t.Name != name {
+			continue
+		}
+		if t.FromStatus != status {
+			err = errTransitionNotAllowed
+			continue
+		}
+		if !transitionAllowed(t, role, isAuthor) {
+			return t, errTransitionForbidden
+		}
+		return t, nil
+	}
+	return entities.WorkflowTransition{}, err
+}
+
+// transitionAllowed проверяет guard-правило перехода
+func transitionAllowed(t entities.WorkflowTransition, role string, isAuthor bool) bool {
+	return slices.Contains(t.AllowedRoles, role) || (t.AllowAuthor && isAuthor)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadWorkflow возвращает переходы категории, а если своих нет - схему по умолчанию
+func loadWorkflow(q queryer, categoryID *int) ([]entities.WorkflowTransition, error) {
+	rows, err := q.Query(`
+	SELECT id, category_id, name, from_status, to_status, allowed_roles, allow_author
+	FROM workflow_transitions
+	WHERE category_id = $1 OR (category_id IS NULL AND NOT EXISTS (
+		SELECT 1 FROM workflow_transitions WHERE category_id = $1
+	))
+	ORDER BY id`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []entities.WorkflowTransition{}
+	for rows.Next() {
+		var t entities.WorkflowTransition
+		err := rows.Scan(&t.ID, &t.CategoryID, &t.Name, &t.FromStatus, &t.ToStatus, pq.Array(&t.AllowedRoles), &t.AllowAuthor)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+// userRole возвращает роль пользователя
+func userRole(db *sql.DB, userID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	return role, err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+
+	"backend/entities"
+)
+
+func TestResolveTransition(t *testing.T) {
+	transitions := []entities.WorkflowTransition{
+		{Name: "submit", FromStatus: "draft", ToStatus: "review", AllowedRoles: []string{"admin"}, AllowAuthor: true},
+		{Name: "approve", FromStatus: "review", ToStatus: "approved", AllowedRoles: []string{"admin", "reviewer"}},
+		{Name: "archive", FromStatus: "approved", ToStatus: "archived", AllowedRoles: []string{"admin"}},
+		{Name: "archive", FromStatus: "published", ToStatus: "archived", AllowedRoles: []string{"admin"}},
+	}
+
+	cases := []struct {
+		name, transition, status, role string
+		isAuthor                       bool
+		wantErr                        error
+		wantTo                         string
+	}{
+		{"author submits draft", "submit", "draft", "user", true, nil, "review"},
+		{"stranger cannot submit", "submit", "draft", "user", false, errTransitionForbidden, ""},
+		{"reviewer approves", "approve", "review", "reviewer", false, nil, "approved"},
+		{"approve from draft", "approve", "draft", "reviewer", false, errTransitionNotAllowed, ""},
+		{"unknown transition", "publish", "approved", "admin", false, errTransitionNotFound, ""},
+		{"same name from other status", "archive", "published", "admin", false, nil, "archived"},
+	}
+	for _, c := range cases {
+		got, err := resolveTransition(transitions, c.transition, c.status, c.role, c.isAuthor)
+		if err != c.wantErr {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.wantErr)
+			continue
+		}
+		if err == nil && got.ToStatus != c.wantTo {
+			t.Errorf("%s: to = %s, want %s", c.name, got.ToStatus, c.wantTo)
+		}
+	}
+}
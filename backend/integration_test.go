@@ -11,6 +11,10 @@ import (
 
 	"backend/database"
 	"backend/routes"
+	"backend/storage"
+	"backend/upload"
+
+	"github.com/gorilla/mux"
 )
 
 // setupIntegrationTestDB создает тестовую БД для интеграционных тестов
@@ -30,6 +34,19 @@ func setupIntegrationTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
+// setupIntegrationRouter создает роутер с хранилищем во временном каталоге и тестовым ключом
+func setupIntegrationRouter(t *testing.T, db *sql.DB) *mux.Router {
+	keys, err := storage.NewLocalKeys("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := upload.PolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes.SetupRoutes(db, storage.NewBlobs(t.TempDir(), keys), uploads)
+}
+
 // TestFullCRUDWorkflow тестирует полный цикл CRUD операций
 func TestFullCRUDWorkflow(t *testing.T) {
 	db := setupIntegrationTestDB(t)
@@ -39,7 +56,7 @@ func TestFullCRUDWorkflow(t *testing.T) {
 	defer db.Close()
 
 	// Создаем роутер
-	router := routes.SetupRoutes(db)
+	router := setupIntegrationRouter(t, db)
 
 	// 1. Создание документа
 	createData := map[string]string{
@@ -151,7 +168,7 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 	defer db.Close()
 
-	router := routes.SetupRoutes(db)
+	router := setupIntegrationRouter(t, db)
 
 	req := httptest.NewRequest("GET", "/health", nil)
 	w := httptest.NewRecorder()
@@ -177,7 +194,7 @@ func TestInvalidRequests(t *testing.T) {
 	}
 	defer db.Close()
 
-	router := routes.SetupRoutes(db)
+	router := setupIntegrationRouter(t, db)
 
 	// Тест некорректного JSON
 	req := httptest.NewRequest("POST", "/dock", bytes.NewBufferString("invalid json"))
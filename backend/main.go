@@ -1,11 +1,24 @@
 package main
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"backend/audit"
 	"backend/database"
+	"backend/events"
+	"backend/handlers"
+	"backend/preview"
+	"backend/render"
 	"backend/routes"
+	"backend/scan"
+	"backend/storage"
+	"backend/tasks"
+	"backend/upload"
+	"backend/webhooks"
 )
 
 func main() {
@@ -22,9 +35,92 @@ func main() {
 		log.Fatal("Failed to create tables:", err)
 	}
 
+	// Правила приема файлов
+	uploads, err := upload.PolicyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid upload settings:", err)
+	}
+
+	// Хранилище файлов и главные ключи шифрования
+	blobs, err := storage.NewBlobsFromEnv()
+	if err != nil {
+		log.Fatal("Invalid storage settings:", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(db, blobs)
+		return
+	}
+
+	// Цепочка аудита и периодические подписанные контрольные точки
+	signer, err := audit.NewSignerFromEnv()
+	if err != nil {
+		log.Fatal("Invalid audit signing key:", err)
+	}
+	if err := audit.ChainLegacy(db); err != nil {
+		log.Fatal("Failed to chain audit events:", err)
+	}
+	stop := make(chan struct{})
+	go audit.RunCheckpoints(db, signer, checkpointInterval(), stop)
+
+	// Шина событий: outbox разбирается в фоне и раздается подписчикам
+	bus := events.NewBus(db)
+	bus.Subscribe("webhooks", "*", webhooks.HandleEvent(db))
+	bus.Subscribe("renditions", "document.*", render.HandleEvent(render.NewCacheFromEnv()))
+	previews := preview.NewStoreFromEnv(db, blobs)
+	bus.Subscribe("previews", events.FileUploaded, previews.HandleUpload)
+	bus.Subscribe("previews.cleanup", events.DocumentDeleted, previews.HandleDelete)
+	scanner, err := scan.NewWorkerFromEnv(db, blobs)
+	if err != nil {
+		log.Fatal("Invalid scanner settings:", err)
+	}
+	bus.Subscribe("scan", events.FileUploaded, scanner.HandleUpload)
+	go bus.Run(stop)
+
+	// Доставка вебхуков
+	go webhooks.NewDispatcher(db).Run(stop)
+
+	// Удаление файлов, на которые не ссылается ни один документ
+	go blobs.RunGC(db, 10*time.Minute, stop)
+
+	// Проверка файлов, загруженных до включения антивируса или пропущенных при его недоступности
+	go scanner.RunPending(time.Minute, stop)
+
+	// Фоновые выгрузки документов и удаление устаревших архивов
+	go handlers.NewExportHandler(db, blobs).RunJobs(5*time.Second, stop)
+
+	// Поиск просроченных поручений
+	go tasks.RunOverdueCheck(db, time.Minute, stop)
+
 	// Настройка маршрутов
-	r := routes.SetupRoutes(db)
+	r := routes.SetupRoutes(db, blobs, uploads)
 
 	log.Println("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
+
+// checkpointInterval читает период контрольных точек аудита из AUDIT_CHECKPOINT_INTERVAL
+func checkpointInterval() time.Duration {
+	if v := os.Getenv("AUDIT_CHECKPOINT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid AUDIT_CHECKPOINT_INTERVAL %q, using default", v)
+	}
+	return time.Hour
+}
+
+// rotateKeys перешифровывает ключи данных файлов текущим главным ключом
+// и шифрует файлы, сохраненные до включения шифрования (команда rotate-keys)
+func rotateKeys(db *sql.DB, blobs *storage.Blobs) {
+	n, err := blobs.RewrapKeys(db)
+	if err != nil {
+		log.Fatalf("Key rotation failed after %d file(s): %v", n, err)
+	}
+	log.Printf("Rewrapped %d data key(s)", n)
+
+	n, err = blobs.EncryptPlain(db)
+	if err != nil {
+		log.Fatalf("Encryption failed after %d file(s): %v", n, err)
+	}
+	log.Printf("Encrypted %d file(s)", n)
+}
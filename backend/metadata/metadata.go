@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/entities"
+)
+
+// DateLayout - формат значений полей типа date
+const DateLayout = "2006-01-02"
+
+// namePattern ограничивает имена полей: они используются как ключи JSON и в параметрах запросов
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// ValidName сообщает, допустимо ли имя поля
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// ValidationError перечисляет все ошибки значений метаданных
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid metadata: " + strings.Join(e.Problems, "; ")
+}
+
+// ValidateSchema проверяет схему полей категории перед сохранением
+func ValidateSchema(fields []entities.CategoryField) error {
+	seen := map[string]bool{}
+	for _, f := range fields {
+		switch {
+		case !ValidName(f.Name):
+			return fmt.Errorf("field name %q must match %s", f.Name, namePattern)
+		case seen[f.Name]:
+			return fmt.Errorf("duplicate field %q", f.Name)
+		case !slices.Contains(entities.FieldTypes, f.Type):
+			return fmt.Errorf("field %q has unknown type %q", f.Name, f.Type)
+		case f.Type == entities.FieldEnum && len(f.Options) == 0:
+			return fmt.Errorf("enum field %q needs options", f.Name)
+		case f.Type != entities.FieldEnum && len(f.Options) > 0:
+			return fmt.Errorf("only enum fields have options (%q)", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	return nil
+}
+
+// Validate проверяет значения по схеме и возвращает нормализованные значения
+// и ID пользователей из полей типа user, существование которых проверяет вызывающий.
+// Пустые значения (null, "") считаются отсутствующими.
+func Validate(fields []entities.CategoryField, values entities.Metadata) (entities.Metadata, []int, error) {
+	result := entities.Metadata{}
+	var userIDs []int
+	var problems []string
+
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.Name] = true
+		value, present := values[f.Name]
+		if !present || value == nil || value == "" {
+			if f.Required {
+				problems = append(problems, f.Name+": required")
+			}
+			continue
+		}
+
+		normalized, err := normalize(f, value)
+		if err != nil {
+			problems = append(problems, f.Name+": "+err.Error())
+			continue
+		}
+		if f.Type == entities.FieldUser {
+			userIDs = append(userIDs, int(normalized.(float64)))
+		}
+		result[f.Name] = normalized
+	}
+
+	var unknown []string
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, name+": unknown field")
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+	return result, userIDs, nil
+}
+
+// normalize приводит значение к типу поля
+func normalize(f entities.CategoryField, value any) (any, error) {
+	switch f.Type {
+	case entities.FieldNumber, entities.FieldUser:
+		n, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("must be a number")
+		}
+		if f.Type == entities.FieldUser && (n != math.Trunc(n) || n <= 0) {
+			return nil, fmt.Errorf("must be a user ID")
+		}
+		return n, nil
+	case entities.FieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a date in YYYY-MM-DD format")
+		}
+		if _, err := time.Parse(DateLayout, s); err != nil {
+			return nil, fmt.Errorf("must be a date in YYYY-MM-DD format")
+		}
+		return s, nil
+	case entities.FieldEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(f.Options, s) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+		}
+		return s, nil
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		return s, nil
+	}
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
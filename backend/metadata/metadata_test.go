@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"backend/entities"
+)
+
+var invoiceFields = []entities.CategoryField{
+	{Name: "amount", Type: entities.FieldNumber, Required: true},
+	{Name: "counterparty", Type: entities.FieldString, Required: true},
+	{Name: "due", Type: entities.FieldDate},
+	{Name: "currency", Type: entities.FieldEnum, Options: []string{"RUB", "USD"}},
+	{Name: "manager", Type: entities.FieldUser},
+}
+
+func TestValidate(t *testing.T) {
+	values := entities.Metadata{
+		"amount":       json.Number("1500.50"),
+		"counterparty": "ООО Ромашка",
+		"due":          "2026-12-31",
+		"currency":     "RUB",
+		"manager":      float64(7),
+	}
+	got, users, err := Validate(invoiceFields, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := entities.Metadata{"amount": 1500.5, "counterparty": "ООО Ромашка", "due": "2026-12-31", "currency": "RUB", "manager": float64(7)}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(users, []int{7}) {
+		t.Errorf("Validate = %v, %v", got, users)
+	}
+
+	// Пустые необязательные значения отбрасываются
+	got, _, err = Validate(invoiceFields, entities.Metadata{"amount": float64(1), "counterparty": "A", "due": nil, "currency": ""})
+	if err != nil || len(got) != 2 {
+		t.Errorf("Validate with empty optionals = %v, %v", got, err)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	values := entities.Metadata{
+		"amount":   "много",
+		"due":      "31.12.2026",
+		"currency": "EUR",
+		"manager":  1.5,
+		"extra":    true,
+	}
+	_, _, err := Validate(invoiceFields, values)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v, want ValidationError", err)
+	}
+	want := []string{
+		"amount: must be a number",
+		"counterparty: required",
+		"due: must be a date in YYYY-MM-DD format",
+		"currency: must be one of RUB, USD",
+		"manager: must be a user ID",
+		"extra: unknown field",
+	}
+	if !reflect.DeepEqual(verr.Problems, want) {
+		t.Errorf("problems = %q", verr.Problems)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	if err := ValidateSchema(invoiceFields); err != nil {
+		t.Errorf("valid schema: %v", err)
+	}
+	bad := [][]entities.CategoryField{
+		{{Name: "Amount", Type: entities.FieldNumber}},
+		{{Name: "a", Type: entities.FieldString}, {Name: "a", Type: entities.FieldNumber}},
+		{{Name: "a", Type: "money"}},
+		{{Name: "a", Type: entities.FieldEnum}},
+		{{Name: "a", Type: entities.FieldString, Options: []string{"x"}}},
+	}
+	for _, fields := range bad {
+		if err := ValidateSchema(fields); err == nil {
+			t.Errorf("ValidateSchema(%+v) must fail", fields)
+		}
+	}
+}
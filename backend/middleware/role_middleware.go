@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// RequireAdmin пропускает только пользователей с ролью admin.
+// Должен подключаться после AuthMiddleware.
+func RequireAdmin(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(UserIDContextKey).(int)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var role string
+			err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+			if err != nil || role != "admin" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package numbering
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backend/entities"
+)
+
+// Format собирает регистрационный номер по шаблону последовательности.
+// Поддерживаются подстановки {prefix}, {year}, {category} и {n} (номер с дополнением нулями).
+func Format(seq entities.NumberingSequence, year int, categoryID *int, n int64) string {
+	format := seq.Format
+	if format == "" {
+		format = entities.DefaultNumberFormat
+	}
+	number := strconv.FormatInt(n, 10)
+	if pad := seq.Padding - len(number); pad > 0 {
+		number = strings.Repeat("0", pad) + number
+	}
+	category := ""
+	if categoryID != nil {
+		category = strconv.Itoa(*categoryID)
+	}
+	return strings.NewReplacer(
+		"{prefix}", seq.Prefix,
+		"{year}", strconv.Itoa(year),
+		"{category}", category,
+		"{n}", number,
+	).Replace(format)
+}
+
+// ValidateFormat проверяет, что шаблон содержит номер и не допускает повторов
+func ValidateFormat(seq entities.NumberingSequence) error {
+	format := seq.Format
+	if format == "" {
+		format = entities.DefaultNumberFormat
+	}
+	if !strings.Contains(format, "{n}") {
+		return fmt.Errorf("format must contain {n}")
+	}
+	// При сбросе по году без {year} номера разных лет совпали бы
+	if seq.YearReset && !strings.Contains(format, "{year}") {
+		return fmt.Errorf("format must contain {year} when year_reset is enabled")
+	}
+	if seq.PerCategory && !strings.Contains(format, "{category}") {
+		return fmt.Errorf("format must contain {category} when per_category is enabled")
+	}
+	return nil
+}
+
+// Next атомарно увеличивает счетчик и возвращает следующее значение.
+// Строка счетчика блокируется до конца транзакции, поэтому номера не дублируются,
+// а откат транзакции не оставляет пропусков.
+func Next(tx *sql.Tx, seq entities.NumberingSequence, year int, categoryID *int) (int64, error) {
+	counterYear := 0
+	if seq.YearReset {
+		counterYear = year
+	}
+	counterCategory := 0
+	if seq.PerCategory && categoryID != nil {
+		counterCategory = *categoryID
+	}
+
+	var value int64
+	err := tx.QueryRow(`
+	INSERT INTO numbering_counters (sequence_id, year, category_id, value)
+	VALUES ($1, $2, $3, 1)
+	ON CONFLICT (sequence_id, year, category_id) DO UPDATE SET value = numbering_counters.value + 1
+	RETURNING value`, seq.ID, counterYear, counterCategory).Scan(&value)
+	return value, err
+}
@@ -0,0 +1,44 @@
+package numbering
+
+import (
+	"testing"
+
+	"backend/entities"
+)
+
+func TestFormat(t *testing.T) {
+	seq := entities.NumberingSequence{Prefix: "ВХ", Padding: 6, YearReset: true}
+	if got := Format(seq, 2026, nil, 123); got != "ВХ-2026/000123" {
+		t.Errorf("Format() = %q, want %q", got, "ВХ-2026/000123")
+	}
+
+	seq = entities.NumberingSequence{Prefix: "ИСХ", Format: "{prefix}-{category}-{n}", PerCategory: true}
+	category := 4
+	if got := Format(seq, 2026, &category, 17); got != "ИСХ-4-17" {
+		t.Errorf("Format() = %q, want %q", got, "ИСХ-4-17")
+	}
+
+	// Номер длиннее дополнения не обрезается
+	seq = entities.NumberingSequence{Prefix: "П", Padding: 2}
+	if got := Format(seq, 2026, nil, 1234); got != "П-2026/1234" {
+		t.Errorf("Format() = %q, want %q", got, "П-2026/1234")
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	cases := []struct {
+		seq entities.NumberingSequence
+		ok  bool
+	}{
+		{entities.NumberingSequence{YearReset: true}, true},
+		{entities.NumberingSequence{Format: "{prefix}"}, false},
+		{entities.NumberingSequence{Format: "{prefix}-{n}", YearReset: true}, false},
+		{entities.NumberingSequence{Format: "{prefix}-{year}-{n}", PerCategory: true}, false},
+		{entities.NumberingSequence{Format: "{prefix}-{category}/{n}", PerCategory: true}, true},
+	}
+	for _, c := range cases {
+		if err := ValidateFormat(c.seq); (err == nil) != c.ok {
+			t.Errorf("ValidateFormat(%+v) = %v, want ok=%v", c.seq, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package preview
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sizes - размеры миниатюр: наибольшая сторона в пикселях
+var Sizes = map[string]int{
+	"small":  128,
+	"medium": 256,
+	"large":  512,
+}
+
+// DefaultSize - размер миниатюры, если он не указан в запросе
+const DefaultSize = "medium"
+
+// TextSize - имя превью текстового файла
+const TextSize = "text"
+
+const (
+	// maxPixels ограничивает размер исходного изображения (защита от "бомб" декомпрессии)
+	maxPixels = 50_000_000
+	// textLimit и textLines - объем первой страницы текстового превью
+	textLimit = 4000
+	textLines = 60
+)
+
+// Result - построенное превью
+type Result struct {
+	Size        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Generate строит превью по содержимому файла: миниатюры всех размеров для PNG и JPEG
+// или первую страницу для текстовых файлов. Для остальных типов возвращает пустой список.
+func Generate(data []byte) ([]Result, error) {
+	contentType := http.DetectContentType(data)
+	switch {
+	case contentType == "image/png" || contentType == "image/jpeg":
+		return thumbnails(data, contentType)
+	case isText(contentType, data):
+		text := TextPreview(data)
+		return []Result{{Size: TextSize, ContentType: "text/plain; charset=utf-8", Data: []byte(text)}}, nil
+	}
+	return nil, nil
+}
+
+func isText(contentType string, data []byte) bool {
+	return (strings.HasPrefix(contentType, "text/plain") || contentType == "application/json") && utf8.Valid(data[:validPrefix(data)])
+}
+
+// validPrefix возвращает длину начала data для превью без обрезанного в конце символа UTF-8
+func validPrefix(data []byte) int {
+	n := min(len(data), textLimit*utf8.UTFMax)
+	for i := 1; i < utf8.UTFMax && n > 0 && !utf8.Valid(data[:n]); i++ {
+		n--
+	}
+	return n
+}
+
+// TextPreview возвращает первую страницу текста: не больше textLines строк и textLimit символов
+func TextPreview(data []byte) string {
+	text := strings.ReplaceAll(string(data[:validPrefix(data)]), "\r\n", "\n")
+	lines := strings.SplitN(text, "\n", textLines+1)
+	if len(lines) > textLines {
+		lines = lines[:textLines]
+	}
+	text = strings.Join(lines, "\n")
+	if utf8.RuneCountInString(text) > textLimit {
+		text = string([]rune(text)[:textLimit])
+	}
+	return strings.TrimRight(text, "\n")
+}
+
+func thumbnails(data []byte, contentType string) ([]Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Один раз переводим изображение в NRGBA, чтобы уменьшать по байтам пикселей
+	rgba := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	var results []Result
+	for size, limit := range Sizes {
+		thumb := Thumbnail(rgba, limit)
+		var buf bytes.Buffer
+		if contentType == "image/png" {
+			err = png.Encode(&buf, thumb)
+		} else {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := thumb.Bounds()
+		results = append(results, Result{Size: size, ContentType: contentType, Width: b.Dx(), Height: b.Dy(), Data: buf.Bytes()})
+	}
+	return results, nil
+}
+
+// Thumbnail уменьшает изображение так, чтобы большая сторона не превышала limit,
+// усредняя исходные пиксели. Изображения меньше limit не увеличиваются.
+func Thumbnail(src *image.NRGBA, limit int) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := sw, sh
+	if sw > limit || sh > limit {
+		if sw >= sh {
+			dw, dh = limit, max(1, sh*limit/sw)
+		} else {
+			dw, dh = max(1, sw*limit/sh), limit
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					// Цвет взвешивается по прозрачности, иначе по краям появляется ореол
+					pa := int(src.Pix[i+3])
+					r += int(src.Pix[i]) * pa
+					g += int(src.Pix[i+1]) * pa
+					b += int(src.Pix[i+2]) * pa
+					a += pa
+					n++
+					i += 4
+				}
+			}
+			o := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[o] = uint8(r / a)
+				dst.Pix[o+1] = uint8(g / a)
+				dst.Pix[o+2] = uint8(b / a)
+			}
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,101 @@
+package preview
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/storage"
+)
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+3] = 200, 255
+	}
+	thumb := Thumbnail(src, 128)
+	if b := thumb.Bounds(); b.Dx() != 128 || b.Dy() != 32 {
+		t.Fatalf("thumbnail is %dx%d, want 128x32", b.Dx(), b.Dy())
+	}
+	if c := thumb.NRGBAAt(10, 10); c != (color.NRGBA{R: 200, A: 255}) {
+		t.Errorf("color = %v", c)
+	}
+
+	small := image.NewNRGBA(image.Rect(0, 0, 50, 80))
+	if b := Thumbnail(small, 128).Bounds(); b.Dx() != 50 || b.Dy() != 80 {
+		t.Errorf("small image must not be upscaled, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 1000, 600))); err != nil {
+		t.Fatal(err)
+	}
+	results, err := Generate(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(Sizes) {
+		t.Fatalf("got %d thumbnails, want %d", len(results), len(Sizes))
+	}
+	for _, res := range results {
+		if res.ContentType != "image/png" || res.Width != Sizes[res.Size] {
+			t.Errorf("%s: %s %dx%d", res.Size, res.ContentType, res.Width, res.Height)
+		}
+	}
+
+	results, err = Generate([]byte("Акт сверки\nстрока 2\n"))
+	if err != nil || len(results) != 1 || results[0].Size != TextSize || string(results[0].Data) != "Акт сверки\nстрока 2" {
+		t.Errorf("text preview = %+v, %v", results, err)
+	}
+
+	if results, _ := Generate([]byte("%PDF-1.4 binary")); len(results) != 0 {
+		t.Errorf("unsupported files must have no previews, got %d", len(results))
+	}
+}
+
+func TestTextPreview(t *testing.T) {
+	text := TextPreview([]byte(strings.Repeat("строка\n", 100)))
+	if n := strings.Count(text, "\n") + 1; n != textLines {
+		t.Errorf("preview has %d lines, want %d", n, textLines)
+	}
+
+	// Обрезка посреди многобайтового символа не ломает UTF-8
+	long := []byte(strings.Repeat("я", textLimit*3))
+	if got := TextPreview(long); len([]rune(got)) != textLimit {
+		t.Errorf("preview has %d runes, want %d", len([]rune(got)), textLimit)
+	}
+}
+
+func TestWriteSealed(t *testing.T) {
+	keys, err := storage.NewLocalKeys("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := storage.NewBlobs(t.TempDir(), keys)
+	s := NewStore(nil, blobs, t.TempDir())
+	path := filepath.Join(s.dir, TextSize)
+
+	keyID, wrapped, err := s.writeSealed(path, []byte("первая страница"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("первая страница")) {
+		t.Fatal("preview must be stored encrypted")
+	}
+	f, err := blobs.OpenSealed(path, keyID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := io.ReadAll(f); string(got) != "первая страница" {
+		t.Errorf("read %q", got)
+	}
+}
@@ -0,0 +1,154 @@
+package preview
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"backend/events"
+	"backend/storage"
+)
+
+// Store сохраняет зашифрованные превью в каталоге <dir>/<id документа>/ и описывает их в document_previews
+type Store struct {
+	db    *sql.DB
+	blobs *storage.Blobs
+	dir   string
+}
+
+func NewStore(db *sql.DB, blobs *storage.Blobs, dir string) *Store {
+	return &Store{db: db, blobs: blobs, dir: dir}
+}
+
+// NewStoreFromEnv создает хранилище в каталоге PREVIEW_DIR (по умолчанию previews)
+func NewStoreFromEnv(db *sql.DB, blobs *storage.Blobs) *Store {
+	dir := os.Getenv("PREVIEW_DIR")
+	if dir == "" {
+		dir = "previews"
+	}
+	return NewStore(db, blobs, dir)
+}
+
+// fileEvent - данные события file.uploaded
+type fileEvent struct {
+	DocumentID int    `json:"document_id"`
+	FilePath   string `json:"file_path"`
+	FileHash   string `json:"file_hash"`
+}
+
+// HandleUpload строит превью загруженного файла (событие file.uploaded)
+// и публикует file.preview_ready. Повторная обработка перезаписывает превью.
+func (s *Store) HandleUpload(e events.Event) error {
+	var data fileEvent
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return err
+	}
+
+	file, err := s.blobs.Open(s.db, data.FilePath, data.FileHash)
+	if os.IsNotExist(err) {
+		// Документ удален раньше, чем дошла очередь до превью
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	results, err := Generate(content)
+	if err != nil {
+		// Поврежденное изображение: повтор не поможет
+		log.Printf("preview: document %d: %v", data.DocumentID, err)
+		return nil
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return s.Save(data.DocumentID, results)
+}
+
+// Save записывает зашифрованные превью документа на диск и их ключи в базу
+func (s *Store) Save(documentID int, results []Result) error {
+	dir := filepath.Join(s.dir, strconv.Itoa(documentID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sizes []string
+	for _, res := range results {
+		path := filepath.Join(dir, res.Size)
+		keyID, wrapped, err := s.writeSealed(path, res.Data)
+		if err != nil {
+			return err
+		}
+		// Документ мог быть удален: тогда вставка ничего не делает
+		result, err := tx.Exec(`
+		INSERT INTO document_previews (document_id, size, content_type, width, height, path, key_id, wrapped_key)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8 FROM documents WHERE id = $1
+		ON CONFLICT (document_id, size) DO UPDATE
+		SET content_type = EXCLUDED.content_type, width = EXCLUDED.width, height = EXCLUDED.height,
+			path = EXCLUDED.path, key_id = EXCLUDED.key_id, wrapped_key = EXCLUDED.wrapped_key,
+			created_at = CURRENT_TIMESTAMP`,
+			documentID, res.Size, res.ContentType, res.Width, res.Height, path, keyID, wrapped)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return os.RemoveAll(dir)
+		}
+		sizes = append(sizes, res.Size)
+	}
+
+	if err := events.Publish(tx, events.FilePreviewReady, map[string]any{"document_id": documentID, "sizes": sizes}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeSealed шифрует превью новым ключом данных и возвращает этот ключ
+func (s *Store) writeSealed(path string, data []byte) (string, []byte, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	enc, keyID, wrapped, err := s.blobs.Seal(f)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := enc.Write(data); err != nil {
+		return "", nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return "", nil, err
+	}
+	return keyID, wrapped, f.Close()
+}
+
+// HandleDelete удаляет файлы превью удаленного документа (событие document.deleted);
+// строки document_previews удаляются каскадно
+func (s *Store) HandleDelete(e events.Event) error {
+	var doc struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(e.Data, &doc); err != nil {
+		return err
+	}
+	if doc.ID == 0 {
+		return fmt.Errorf("document.deleted event without id")
+	}
+	return os.RemoveAll(filepath.Join(s.dir, strconv.Itoa(doc.ID)))
+}
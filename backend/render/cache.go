@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"backend/events"
+)
+
+// version меняется при изменении оформления, чтобы старые файлы не отдавались из кэша
+const version = "1"
+
+// Cache хранит построенные PDF на диске: <dir>/<id документа>/<ключ>.pdf.
+// Ключ - хэш входных данных, поэтому любое изменение документа дает новый файл.
+type Cache struct {
+	dir string
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// NewCacheFromEnv создает кэш в каталоге RENDER_CACHE_DIR (по умолчанию renditions)
+func NewCacheFromEnv() *Cache {
+	dir := os.Getenv("RENDER_CACHE_DIR")
+	if dir == "" {
+		dir = "renditions"
+	}
+	return NewCache(dir)
+}
+
+// Key возвращает ключ кэша для входных данных
+func Key(in Input) string {
+	data, _ := json.Marshal(in)
+	sum := sha256.Sum256(append([]byte(version+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) documentDir(documentID int) string {
+	return filepath.Join(c.dir, strconv.Itoa(documentID))
+}
+
+// Path возвращает путь к закэшированному PDF, если он есть
+func (c *Cache) Path(documentID int, key string) (string, bool) {
+	path := filepath.Join(c.documentDir(documentID), key+".pdf")
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Build строит PDF, сохраняет его в кэш вместо прежних версий документа и возвращает путь
+func (c *Cache) Build(documentID int, key string, in Input) (string, error) {
+	var buf bytes.Buffer
+	if err := PDF(&buf, in); err != nil {
+		return "", err
+	}
+
+	dir := c.documentDir(documentID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// Запись через временный файл: параллельный запрос не увидит недописанный PDF
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, key+".pdf")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(dir, "*.pdf"))
+	for _, name := range stale {
+		if name != path {
+			os.Remove(name)
+		}
+	}
+	return path, nil
+}
+
+// Invalidate удаляет все закэшированные PDF документа
+func (c *Cache) Invalidate(documentID int) error {
+	return os.RemoveAll(c.documentDir(documentID))
+}
+
+// HandleEvent сбрасывает кэш документа при любом его событии (document.*).
+// ID берется из document_id, document.id или id - в зависимости от формы данных события.
+func HandleEvent(c *Cache) events.Handler {
+	return func(e events.Event) error {
+		var data struct {
+			ID         int  `json:"id"`
+			DocumentID *int `json:"document_id"`
+			Document   *struct {
+				ID int `json:"id"`
+			} `json:"document"`
+		}
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		id := data.ID
+		switch {
+		case data.DocumentID != nil:
+			id = *data.DocumentID
+		case data.Document != nil:
+			id = data.Document.ID
+		}
+		if id == 0 {
+			return nil
+		}
+		return c.Invalidate(id)
+	}
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Виды блоков Markdown, которые поддерживает рендер
+const (
+	blockParagraph = iota
+	blockHeading
+	blockBullet
+	blockNumbered
+	blockQuote
+	blockCode
+	blockRule
+)
+
+// block - блок текста: заголовок, абзац, пункт списка и т.д.
+type block struct {
+	kind int
+	// level - уровень заголовка (1-3)
+	level int
+	// marker - номер пункта нумерованного списка
+	marker string
+	text   string
+}
+
+// span - фрагмент строки с одним начертанием
+type span struct {
+	text string
+	bold bool
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletPattern   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	numberedPattern = regexp.MustCompile(`^\s*(\d+)[.)]\s+(.*)$`)
+	rulePattern     = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	linkPattern     = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	emphasisPattern = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s](?:[^*_]*[^*_\s])?)[*_]`)
+)
+
+// parseMarkdown разбирает подмножество Markdown: заголовки, абзацы, списки,
+// цитаты, блоки кода и горизонтальные линии. Строки абзаца склеиваются через пробел.
+func parseMarkdown(text string) []block {
+	var blocks []block
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, block{kind: blockParagraph, text: strings.Join(paragraph, " ")})
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, block{kind: blockCode, text: strings.Join(code, "\n")})
+		case trimmed == "":
+			flush()
+		case rulePattern.MatchString(line):
+			flush()
+			blocks = append(blocks, block{kind: blockRule})
+		case headingPattern.MatchString(trimmed):
+			flush()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			blocks = append(blocks, block{kind: blockHeading, level: min(len(m[1]), 3), text: m[2]})
+		case bulletPattern.MatchString(line):
+			flush()
+			blocks = append(blocks, block{kind: blockBullet, text: bulletPattern.FindStringSubmatch(line)[1]})
+		case numberedPattern.MatchString(line):
+			flush()
+			m := numberedPattern.FindStringSubmatch(line)
+			blocks = append(blocks, block{kind: blockNumbered, marker: m[1] + ".", text: m[2]})
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			// Соседние строки цитаты объединяются в один блок
+			if n := len(blocks); n > 0 && blocks[n-1].kind == blockQuote && i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), ">") {
+				blocks[n-1].text += " " + quote
+			} else {
+				blocks = append(blocks, block{kind: blockQuote, text: quote})
+			}
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// parseInline делит строку на обычные и полужирные фрагменты (**текст** или __текст__).
+// Курсив и код выводятся обычным начертанием, у ссылок рядом с текстом печатается адрес.
+func parseInline(text string) []span {
+	text = linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		if parts[1] == "" || parts[1] == parts[2] {
+			return parts[2]
+		}
+		return parts[1] + " (" + parts[2] + ")"
+	})
+	text = strings.ReplaceAll(text, "`", "")
+
+	var spans []span
+	bold := false
+	for {
+		i := strings.Index(text, "**")
+		j := strings.Index(text, "__")
+		if j >= 0 && (i < 0 || j < i) {
+			i = j
+		}
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			spans = append(spans, span{text: stripEmphasis(text[:i]), bold: bold})
+		}
+		bold = !bold
+		text = text[i+2:]
+	}
+	if text != "" {
+		spans = append(spans, span{text: stripEmphasis(text), bold: bold})
+	}
+	return spans
+}
+
+// stripEmphasis убирает маркеры курсива *текст* и _текст_
+func stripEmphasis(text string) string {
+	return emphasisPattern.ReplaceAllString(text, "$1$2")
+}
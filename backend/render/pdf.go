@@ -0,0 +1,171 @@
+package render
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+)
+
+//go:embed fonts/DejaVuSansCondensed.ttf
+var regularFont []byte
+
+//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+var boldFont []byte
+
+const (
+	fontFamily = "DejaVu"
+	// lineHeight - высота строки основного текста, мм
+	lineHeight = 5.5
+	listIndent = 6.0
+)
+
+// Field - строка таблицы реквизитов документа
+type Field struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Input - данные для построения PDF
+type Input struct {
+	Title string `json:"title"`
+	// Fields - реквизиты (номер, категория, статус, метаданные) в порядке вывода
+	Fields []Field `json:"fields"`
+	// Content - текст документа в Markdown
+	Content string `json:"content"`
+	// Footer - подпись внизу каждой страницы
+	Footer string `json:"footer"`
+}
+
+// PDF строит PDF-документ из названия, реквизитов и текста и пишет его в w
+func PDF(w io.Writer, in Input) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AddUTF8FontFromBytes(fontFamily, "", regularFont)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", boldFont)
+	pdf.SetTitle(in.Title, true)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(fontFamily, "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 5, in.Footer, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont(fontFamily, "B", 16)
+	pdf.MultiCell(0, 8, in.Title, "", "L", false)
+	pdf.Ln(3)
+
+	if len(in.Fields) > 0 {
+		writeFields(pdf, in.Fields)
+		pdf.Ln(4)
+	}
+
+	for _, b := range parseMarkdown(in.Content) {
+		writeBlock(pdf, b)
+	}
+
+	return pdf.Output(w)
+}
+
+// writeFields выводит реквизиты таблицей из двух колонок
+func writeFields(pdf *fpdf.Fpdf, fields []Field) {
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	labelWidth := 50.0
+	valueWidth := pageWidth - left - right - labelWidth
+
+	pdf.SetFont(fontFamily, "", 9)
+	pdf.SetDrawColor(200, 200, 200)
+	for _, f := range fields {
+		lines := max(len(pdf.SplitText(f.Value, valueWidth-2)), 1)
+		height := float64(lines) * 5
+		x, y := pdf.GetXY()
+
+		pdf.SetTextColor(96, 96, 96)
+		pdf.SetFillColor(245, 245, 245)
+		pdf.Rect(x, y, labelWidth, height, "FD")
+		pdf.MultiCell(labelWidth, 5, f.Label, "", "L", false)
+
+		pdf.SetXY(x+labelWidth, y)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Rect(x+labelWidth, y, valueWidth, height, "D")
+		pdf.MultiCell(valueWidth, 5, f.Value, "", "L", false)
+		pdf.SetXY(x, y+height)
+	}
+}
+
+// writeBlock выводит блок Markdown
+func writeBlock(pdf *fpdf.Fpdf, b block) {
+	left, _, _, _ := pdf.GetMargins()
+	pdf.SetTextColor(0, 0, 0)
+
+	switch b.kind {
+	case blockHeading:
+		sizes := map[int]float64{1: 14, 2: 12.5, 3: 11}
+		pdf.Ln(2)
+		pdf.SetFont(fontFamily, "B", sizes[b.level])
+		pdf.MultiCell(0, 7, plainText(b.text), "", "L", false)
+		pdf.Ln(1)
+	case blockBullet, blockNumbered:
+		marker := "•"
+		if b.kind == blockNumbered {
+			marker = b.marker
+		}
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.SetX(left + listIndent/2)
+		pdf.Write(lineHeight, marker)
+		pdf.SetLeftMargin(left + listIndent*1.5)
+		pdf.SetX(left + listIndent*1.5)
+		writeSpans(pdf, parseInline(b.text), 10)
+		pdf.SetLeftMargin(left)
+		pdf.Ln(lineHeight + 0.5)
+	case blockQuote:
+		pdf.SetLeftMargin(left + listIndent)
+		pdf.SetX(left + listIndent)
+		pdf.SetTextColor(96, 96, 96)
+		writeSpans(pdf, parseInline(b.text), 10)
+		pdf.SetLeftMargin(left)
+		pdf.Ln(lineHeight + 2)
+	case blockCode:
+		pdf.SetFont(fontFamily, "", 9)
+		pdf.SetFillColor(242, 242, 242)
+		pdf.MultiCell(0, 4.5, strings.ReplaceAll(b.text, "\t", "    "), "", "L", true)
+		pdf.Ln(2)
+	case blockRule:
+		pageWidth, _ := pdf.GetPageSize()
+		y := pdf.GetY() + 2
+		pdf.SetDrawColor(180, 180, 180)
+		pdf.Line(left, y, pageWidth-left, y)
+		pdf.Ln(5)
+	default:
+		writeSpans(pdf, parseInline(b.text), 10)
+		pdf.Ln(lineHeight + 2)
+	}
+}
+
+// writeSpans выводит строку с переносами, переключая начертание
+func writeSpans(pdf *fpdf.Fpdf, spans []span, size float64) {
+	for _, s := range spans {
+		style := ""
+		if s.bold {
+			style = "B"
+		}
+		pdf.SetFont(fontFamily, style, size)
+		pdf.Write(lineHeight, s.text)
+	}
+}
+
+// plainText возвращает текст строки без разметки
+func plainText(text string) string {
+	var sb strings.Builder
+	for _, s := range parseInline(text) {
+		sb.WriteString(s.text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"backend/events"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	blocks := parseMarkdown("# Договор\n\nСтороны\nдоговорились:\n\n- оплата\n2. поставка\n> важно\n> очень\n\n```\ncode\n```\n---")
+	want := []block{
+		{kind: blockHeading, level: 1, text: "Договор"},
+		{kind: blockParagraph, text: "Стороны договорились:"},
+		{kind: blockBullet, text: "оплата"},
+		{kind: blockNumbered, marker: "2.", text: "поставка"},
+		{kind: blockQuote, text: "важно очень"},
+		{kind: blockCode, text: "code"},
+		{kind: blockRule},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Fatalf("parseMarkdown = %+v", blocks)
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	got := parseInline("Срок **10 дней** с *даты* подписания, см. [сайт](https://example.com) и `snake_case`")
+	want := []span{
+		{text: "Срок "},
+		{text: "10 дней", bold: true},
+		{text: " с даты подписания, см. сайт (https://example.com) и snake_case"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseInline = %+v", got)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	var buf bytes.Buffer
+	err := PDF(&buf, Input{
+		Title:   "Договор поставки",
+		Fields:  []Field{{Label: "Сумма", Value: "150000"}},
+		Content: "## Предмет\n\nПоставщик **обязуется** поставить товар.\n\n- пункт",
+		Footer:  "Документ 1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatal("output is not a PDF")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(t.TempDir())
+	in := Input{Title: "A", Content: "text"}
+	key := Key(in)
+	if key != Key(Input{Title: "A", Content: "text"}) || key == Key(Input{Title: "B", Content: "text"}) {
+		t.Fatal("key must depend only on input")
+	}
+	if _, ok := c.Path(7, key); ok {
+		t.Fatal("empty cache must miss")
+	}
+
+	old, err := c.Build(7, key, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := c.Path(7, key); !ok || path != old {
+		t.Fatalf("Path = %q, %v", path, ok)
+	}
+
+	// Новая версия вытесняет старую
+	in.Title = "B"
+	if _, err := c.Build(7, Key(in), in); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("stale rendition must be removed")
+	}
+
+	// Событие документа сбрасывает кэш; ID может быть в document_id или document.id
+	data, _ := json.Marshal(map[string]any{"document": map[string]any{"id": 7}})
+	if err := HandleEvent(c)(events.Event{Type: events.DocumentStatusChanged, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Path(7, Key(in)); ok {
+		t.Error("cache must be invalidated by the event")
+	}
+}
@@ -6,23 +6,43 @@ import (
 
 	"backend/handlers"
 	"backend/middleware"
+	"backend/storage"
+	"backend/upload"
 
 	"github.com/gorilla/mux"
 )
 
-// SetupRoutes настраивает все маршруты API
-func SetupRoutes(db *sql.DB) *mux.Router {
+// SetupRoutes настраивает все маршруты API. Хранилище файлов и правила приема
+// создаются в main, где ошибки настроек останавливают запуск.
+func SetupRoutes(db *sql.DB, blobs *storage.Blobs, uploads upload.Policy) *mux.Router {
 	r := mux.NewRouter()
 
 	// Создаем обработчики
-	docHandler := handlers.NewDocumentHandler(db)
-	categoryHandler := handlers.NewCategoryHandler(db)
+	docHandler := handlers.NewDocumentHandler(db, blobs, uploads)
+	categoryHandler := handlers.NewCategoryHandler(db, uploads)
 	authHandler := handlers.NewAuthHandler(db)
+	auditHandler := handlers.NewAuditHandler(db)
+	webhookHandler := handlers.NewWebhookHandler(db)
+	eventStreamHandler := handlers.NewEventStreamHandler(db)
+	workflowHandler := handlers.NewWorkflowHandler(db)
+	approvalHandler := handlers.NewApprovalHandler(db)
+	groupHandler := handlers.NewGroupHandler(db)
+	userHandler := handlers.NewUserHandler(db)
+	taskHandler := handlers.NewTaskHandler(db)
+	numberingHandler := handlers.NewNumberingHandler(db)
+	commentHandler := handlers.NewCommentHandler(db)
+	tagHandler := handlers.NewTagHandler(db)
+	templateHandler := handlers.NewTemplateHandler(db)
+	linkHandler := handlers.NewLinkHandler(db, blobs)
+	exportHandler := handlers.NewExportHandler(db, blobs)
 
 	// Публичные маршруты авторизации
 	r.HandleFunc("/auth/register", authHandler.Register).Methods("POST")
 	r.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
 
+	// Публичные ссылки на файлы: доступ по токену без учетной записи
+	r.HandleFunc("/s/{token}", linkHandler.AccessLink).Methods("GET", "POST")
+
 	// Защищенные маршруты
 	api := r.NewRoute().Subrouter()
 	api.Use(middleware.AuthMiddleware)
@@ -30,17 +50,119 @@ func SetupRoutes(db *sql.DB) *mux.Router {
 	// Маршруты для документов
 	api.HandleFunc("/dock", docHandler.GetDocuments).Methods("GET")
 	api.HandleFunc("/dock", docHandler.CreateDocument).Methods("POST")
+	api.HandleFunc("/dock/from-template/{tid}", templateHandler.CreateFromTemplate).Methods("POST")
 	api.HandleFunc("/dock/{id}", docHandler.GetDocument).Methods("GET")
 	api.HandleFunc("/dock/{id}", docHandler.UpdateDocument).Methods("PUT")
+	api.HandleFunc("/dock/{id}", docHandler.PatchDocument).Methods("PATCH")
 	api.HandleFunc("/dock/{id}", docHandler.DeleteDocument).Methods("DELETE")
 	api.HandleFunc("/dock/{id}/download", docHandler.DownloadDocument).Methods("GET")
+	api.HandleFunc("/dock/{id}/render", docHandler.RenderDocument).Methods("GET")
+	api.HandleFunc("/dock/{id}/preview", docHandler.GetPreview).Methods("GET")
+	api.HandleFunc("/dock/{id}/links", linkHandler.GetLinks).Methods("GET")
+	api.HandleFunc("/dock/{id}/links", linkHandler.CreateLink).Methods("POST")
+	api.HandleFunc("/dock/{id}/links/{link_id}", linkHandler.RevokeLink).Methods("DELETE")
+	api.HandleFunc("/dock/{id}/checkout", docHandler.CheckoutDocument).Methods("POST")
+	api.HandleFunc("/dock/{id}/checkout", docHandler.UnlockDocument).Methods("DELETE")
+	api.HandleFunc("/dock/{id}/checkin", docHandler.CheckinDocument).Methods("POST")
+	api.HandleFunc("/dock/{id}/versions", docHandler.GetDocumentVersions).Methods("GET")
+	api.HandleFunc("/dock/{id}/versions/{version}", docHandler.GetDocumentVersion).Methods("GET")
+	api.HandleFunc("/dock/{id}/transitions", workflowHandler.GetAvailableTransitions).Methods("GET")
+	api.HandleFunc("/dock/{id}/transitions/{name}", workflowHandler.ApplyTransition).Methods("POST")
+
+	// Маршруты согласования документов
+	api.HandleFunc("/dock/{id}/approvals", approvalHandler.GetApprovalRoutes).Methods("GET")
+	api.HandleFunc("/dock/{id}/approvals", approvalHandler.CreateApprovalRoute).Methods("POST")
+	api.HandleFunc("/dock/{id}/approvals/{route_id}", approvalHandler.GetApprovalRoute).Methods("GET")
+	api.HandleFunc("/dock/{id}/approvals/{route_id}/cancel", approvalHandler.CancelApprovalRoute).Methods("POST")
+	api.HandleFunc("/dock/{id}/approvals/{route_id}/steps/{step_id}/approve", approvalHandler.ApproveStep).Methods("POST")
+	api.HandleFunc("/dock/{id}/approvals/{route_id}/steps/{step_id}/reject", approvalHandler.RejectStep).Methods("POST")
+	api.HandleFunc("/dock/{id}/approvals/{route_id}/steps/{step_id}/delegate", approvalHandler.DelegateStep).Methods("POST")
+
+	// Поручения по документам
+	api.HandleFunc("/dock/{id}/tasks", taskHandler.GetDocumentTasks).Methods("GET")
+	api.HandleFunc("/dock/{id}/tasks", taskHandler.CreateTask).Methods("POST")
+	api.HandleFunc("/tasks", taskHandler.GetTasks).Methods("GET")
+	api.HandleFunc("/tasks/{id}", taskHandler.GetTask).Methods("GET")
+	api.HandleFunc("/tasks/{id}", taskHandler.UpdateTask).Methods("PUT")
+	api.HandleFunc("/tasks/{id}", taskHandler.DeleteTask).Methods("DELETE")
+	api.HandleFunc("/tasks/{id}/status", taskHandler.UpdateTaskStatus).Methods("PUT")
+
+	// Комментарии и лента активности документа
+	api.HandleFunc("/dock/{id}/comments", commentHandler.GetComments).Methods("GET")
+	api.HandleFunc("/dock/{id}/comments", commentHandler.CreateComment).Methods("POST")
+	api.HandleFunc("/dock/{id}/comments/{comment_id}", commentHandler.UpdateComment).Methods("PUT")
+	api.HandleFunc("/dock/{id}/comments/{comment_id}", commentHandler.DeleteComment).Methods("DELETE")
+	api.HandleFunc("/dock/{id}/comments/{comment_id}/resolved", commentHandler.SetCommentResolved).Methods("PUT")
+	api.HandleFunc("/dock/{id}/activity", commentHandler.GetActivity).Methods("GET")
+
+	// Теги документов
+	api.HandleFunc("/dock/{id}/tags", tagHandler.SetDocumentTags).Methods("PUT")
+	api.HandleFunc("/tags", tagHandler.GetTags).Methods("GET")
+
+	// Шаблоны документов
+	api.HandleFunc("/templates", templateHandler.GetTemplates).Methods("GET")
+	api.HandleFunc("/templates", templateHandler.CreateTemplate).Methods("POST")
+	api.HandleFunc("/templates/{id}", templateHandler.GetTemplate).Methods("GET")
+	api.HandleFunc("/templates/{id}", templateHandler.UpdateTemplate).Methods("PUT")
+	api.HandleFunc("/templates/{id}", templateHandler.DeleteTemplate).Methods("DELETE")
+
+	// Регистрация документов и журнал регистрации
+	api.HandleFunc("/dock/{id}/register", numberingHandler.RegisterDocument).Methods("POST")
+	api.HandleFunc("/registrations", numberingHandler.GetRegistrations).Methods("GET")
+	api.HandleFunc("/numbering", numberingHandler.GetSequences).Methods("GET")
 
 	// Маршруты для категорий
 	api.HandleFunc("/categories", categoryHandler.GetCategories).Methods("GET")
 	api.HandleFunc("/categories", categoryHandler.CreateCategory).Methods("POST")
 	api.HandleFunc("/categories/{id}", categoryHandler.GetCategory).Methods("GET")
 	api.HandleFunc("/categories/{id}", categoryHandler.UpdateCategory).Methods("PUT")
+	api.HandleFunc("/categories/{id}", categoryHandler.PatchCategory).Methods("PATCH")
 	api.HandleFunc("/categories/{id}", categoryHandler.DeleteCategory).Methods("DELETE")
+	api.HandleFunc("/categories/{id}/workflow", workflowHandler.GetWorkflow).Methods("GET")
+	api.HandleFunc("/categories/{id}/fields", categoryHandler.GetCategoryFields).Methods("GET")
+
+	// Выгрузка документов с файлами в ZIP; большие выгрузки собираются в фоне
+	api.HandleFunc("/export", exportHandler.CreateExport).Methods("POST")
+	api.HandleFunc("/exports", exportHandler.GetExports).Methods("GET")
+	api.HandleFunc("/exports/{id}", exportHandler.GetExport).Methods("GET")
+	api.HandleFunc("/exports/{id}/download", exportHandler.DownloadExport).Methods("GET")
+
+	// Поток изменений (Server-Sent Events)
+	api.HandleFunc("/events", eventStreamHandler.StreamEvents).Methods("GET")
+
+	// Журнал аудита (только для администраторов)
+	admin := api.NewRoute().Subrouter()
+	admin.Use(middleware.RequireAdmin(db))
+	admin.HandleFunc("/audit", auditHandler.GetAuditEvents).Methods("GET")
+	admin.HandleFunc("/audit/verify", auditHandler.VerifyAudit).Methods("GET")
+
+	// Группы пользователей (только для администраторов)
+	admin.HandleFunc("/groups", groupHandler.GetGroups).Methods("GET")
+	admin.HandleFunc("/groups", groupHandler.CreateGroup).Methods("POST")
+	admin.HandleFunc("/groups/{id}/members", groupHandler.SetGroupMembers).Methods("PUT")
+
+	// Назначение ролей пользователям (только для администраторов)
+	admin.HandleFunc("/users/{id}/role", userHandler.SetUserRole).Methods("PUT")
+
+	// Настройка жизненного цикла, полей метаданных и ограничений категорий (только для администраторов)
+	admin.HandleFunc("/categories/{id}/workflow", workflowHandler.UpdateWorkflow).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/fields", categoryHandler.UpdateCategoryFields).Methods("PUT")
+	admin.HandleFunc("/categories/{id}/limits", categoryHandler.UpdateCategoryLimits).Methods("PUT")
+
+	// Последовательности регистрационных номеров (только для администраторов)
+	admin.HandleFunc("/numbering", numberingHandler.CreateSequence).Methods("POST")
+	admin.HandleFunc("/numbering/{id}", numberingHandler.UpdateSequence).Methods("PUT")
+
+	// Переименование и слияние тегов (только для администраторов)
+	admin.HandleFunc("/tags/{id}", tagHandler.RenameTag).Methods("PUT")
+	admin.HandleFunc("/tags/{id}/merge", tagHandler.MergeTag).Methods("POST")
+
+	// Исходящие вебхуки (только для администраторов)
+	admin.HandleFunc("/webhooks", webhookHandler.GetWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}/deliveries/{delivery_id}/redeliver", webhookHandler.Redeliver).Methods("POST")
 
 	// Health check endpoint
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
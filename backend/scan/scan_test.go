@@ -0,0 +1,148 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd принимает одну команду INSTREAM и отвечает по содержимому потока
+func fakeClamd(t *testing.T, reply func(data []byte) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var data []byte
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					chunk := make([]byte, n)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					data = append(data, chunk...)
+				}
+				conn.Write([]byte(reply(data) + "\x00"))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	addr := fakeClamd(t, func(data []byte) string {
+		if bytes.Contains(data, []byte(EICAR)) {
+			return "stream: Eicar-Test-Signature FOUND"
+		}
+		return "stream: OK"
+	})
+	c := &Clamd{Addr: addr, Timeout: 5 * time.Second}
+
+	// Файл больше одной порции проверяет разбиение потока
+	clean := strings.Repeat("a", chunkSize*2+10)
+	res, err := c.Scan(strings.NewReader(clean))
+	if err != nil || res.Infected {
+		t.Fatalf("clean file: %+v, %v", res, err)
+	}
+
+	res, err = c.Scan(strings.NewReader(clean + EICAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Errorf("infected file: %+v", res)
+	}
+}
+
+func TestClamdError(t *testing.T) {
+	addr := fakeClamd(t, func([]byte) string { return "INSTREAM size limit exceeded. ERROR" })
+	c := &Clamd{Addr: addr, Timeout: 5 * time.Second}
+	if _, err := c.Scan(strings.NewReader("data")); err == nil {
+		t.Error("clamd error reply must fail the scan")
+	}
+
+	closed := &Clamd{Addr: "127.0.0.1:1", Timeout: time.Second}
+	if _, err := closed.Scan(strings.NewReader("data")); err == nil {
+		t.Error("unreachable clamd must fail the scan")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		fails     bool
+	}{
+		{"stream: OK\x00", false, "", false},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND\n", true, "Win.Test.EICAR_HDB-1", false},
+		{"lstat() failed: No such file or directory. ERROR", false, "", true},
+		{"", false, "", true},
+	}
+	for _, tt := range tests {
+		res, err := parseReply(tt.reply)
+		if (err != nil) != tt.fails || res.Infected != tt.infected || res.Signature != tt.signature {
+			t.Errorf("parseReply(%q) = %+v, %v", tt.reply, res, err)
+		}
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	if res, _ := f.Scan(strings.NewReader("hello")); res.Infected {
+		t.Error("plain text must be clean")
+	}
+	if res, _ := f.Scan(strings.NewReader("prefix " + EICAR)); !res.Infected {
+		t.Error("EICAR must be detected")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("CLAMD_ADDR", "")
+	t.Setenv("SCAN_FAKE", "")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("scanner without CLAMD_ADDR must require SCAN_FAKE=1")
+	}
+
+	t.Setenv("SCAN_FAKE", "1")
+	if s, err := NewFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := s.(*Fake); !ok {
+		t.Errorf("SCAN_FAKE=1 scanner = %T", s)
+	}
+
+	t.Setenv("CLAMD_ADDR", "clamav:3310")
+	if s, err := NewFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if c, ok := s.(*Clamd); !ok || c.Addr != "clamav:3310" {
+		t.Errorf("CLAMD_ADDR scanner = %+v", s)
+	}
+}
@@ -0,0 +1,140 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Result - результат проверки файла
+type Result struct {
+	Infected bool
+	// Signature - название найденной угрозы
+	Signature string
+}
+
+// Scanner проверяет содержимое файла антивирусом
+type Scanner interface {
+	Scan(r io.Reader) (Result, error)
+}
+
+// NewFromEnv возвращает клиент clamd по адресу CLAMD_ADDR (host:port).
+// Без адреса сервер не запускается: иначе файлы считались бы чистыми без проверки.
+// Fake, распознающий только тестовый файл EICAR, включается явно через SCAN_FAKE=1.
+func NewFromEnv() (Scanner, error) {
+	if addr := os.Getenv("CLAMD_ADDR"); addr != "" {
+		return &Clamd{Addr: addr, Timeout: 2 * time.Minute}, nil
+	}
+	if os.Getenv("SCAN_FAKE") != "1" {
+		return nil, fmt.Errorf("CLAMD_ADDR is not set (SCAN_FAKE=1 enables the EICAR-only test scanner)")
+	}
+	log.Println("scan: SCAN_FAKE=1, only the EICAR test file is detected")
+	return NewFake(), nil
+}
+
+// chunkSize - размер порции данных в команде INSTREAM
+const chunkSize = 64 << 10
+
+// Clamd проверяет файлы через демон ClamAV по TCP командой INSTREAM
+type Clamd struct {
+	Addr string
+	// Timeout ограничивает проверку одного файла целиком
+	Timeout time.Duration
+}
+
+func (c *Clamd) Scan(r io.Reader) (Result, error) {
+	conn, err := net.DialTimeout("tcp", c.Addr, 10*time.Second)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	// Поток передается порциями: 4 байта длины (big-endian) и данные, в конце - порция нулевой длины
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := w.Write(size); err != nil {
+				return Result{}, fmt.Errorf("clamd: %w", err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return Result{}, fmt.Errorf("clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := w.Write(size); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// parseReply разбирает ответ clamd: "stream: OK", "stream: <угроза> FOUND" или "<текст> ERROR"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	status := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
+
+// EICAR - стандартная тестовая строка антивирусов
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake - сканер для разработки и тестов: находит заданные строки в содержимом
+type Fake struct {
+	// Signatures - искомая строка и название угрозы
+	Signatures map[string]string
+}
+
+// NewFake создает сканер, распознающий тестовый файл EICAR
+func NewFake() *Fake {
+	return &Fake{Signatures: map[string]string{EICAR: "Eicar-Test-Signature"}}
+}
+
+func (f *Fake) Scan(r io.Reader) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	for pattern, name := range f.Signatures {
+		if bytes.Contains(data, []byte(pattern)) {
+			return Result{Infected: true, Signature: name}, nil
+		}
+	}
+	return Result{}, nil
+}
@@ -0,0 +1,277 @@
+package scan
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"backend/audit"
+	"backend/entities"
+	"backend/events"
+	"backend/storage"
+)
+
+// Worker проверяет загруженные файлы и переводит документы из pending в clean или infected
+type Worker struct {
+	db      *sql.DB
+	scanner Scanner
+	blobs   *storage.Blobs
+	// quarantine - каталог, куда переносятся зараженные файлы
+	quarantine string
+}
+
+func NewWorker(db *sql.DB, scanner Scanner, blobs *storage.Blobs, quarantine string) *Worker {
+	return &Worker{db: db, scanner: scanner, blobs: blobs, quarantine: quarantine}
+}
+
+// NewWorkerFromEnv создает проверку со сканером из NewFromEnv и карантином в QUARANTINE_DIR
+// (по умолчанию quarantine)
+func NewWorkerFromEnv(db *sql.DB, blobs *storage.Blobs) (*Worker, error) {
+	dir := os.Getenv("QUARANTINE_DIR")
+	if dir == "" {
+		dir = "quarantine"
+	}
+	scanner, err := NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewWorker(db, scanner, blobs, dir), nil
+}
+
+// file - проверяемый файл документа
+type file struct {
+	DocumentID int    `json:"document_id"`
+	FilePath   string `json:"file_path"`
+	FileHash   string `json:"file_hash"`
+}
+
+// HandleUpload проверяет файл из события file.uploaded.
+// Ошибка сканера возвращается, чтобы шина повторила доставку.
+func (wk *Worker) HandleUpload(e events.Event) error {
+	var f file
+	if err := json.Unmarshal(e.Data, &f); err != nil {
+		return err
+	}
+	return wk.Check(f)
+}
+
+// Check проверяет файл и сохраняет результат для всех документов с этим файлом
+func (wk *Worker) Check(f file) error {
+	if f.FilePath == "" {
+		return nil
+	}
+	src, err := wk.blobs.Open(wk.db, f.FilePath, f.FileHash)
+	if os.IsNotExist(err) {
+		// Документ удален или файл уже в карантине. Время попытки отодвигает
+		// документ в конец очереди CheckPending.
+		_, err := wk.db.Exec("UPDATE documents SET scanned_at = CURRENT_TIMESTAMP WHERE id = $1 AND scan_status = 'pending'", f.DocumentID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	result, err := wk.scanner.Scan(src)
+	src.Close()
+	if err != nil {
+		return fmt.Errorf("scan document %d: %w", f.DocumentID, err)
+	}
+	if result.Infected {
+		return wk.quarantineFile(f, result.Signature)
+	}
+	return wk.markClean(f)
+}
+
+// sameFile - условие на документы с тем же файлом: по хэшу в хранилище
+// или по пути для файлов, загруженных до него
+const sameFile = "(CASE WHEN $2 <> '' THEN file_hash = $2 ELSE file_path = $1 END)"
+
+func (wk *Worker) markClean(f file) error {
+	tx, err := wk.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := updateStatus(tx, `
+	UPDATE documents SET scan_status = $3, scan_signature = NULL, scanned_at = CURRENT_TIMESTAMP
+	WHERE `+sameFile+` AND scan_status = 'pending'
+	RETURNING id`, f.FilePath, f.FileHash, entities.ScanClean)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := events.Publish(tx, events.FileScanned, map[string]any{"document_id": id, "scan_status": entities.ScanClean}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// quarantineFile переносит файл в карантин, помечает документы зараженными
+// и записывает событие аудита. Файл остается зашифрованным; ключ данных хранится в blobs,
+// пока на файл ссылаются документы.
+func (wk *Worker) quarantineFile(f file, signature string) error {
+	tx, err := wk.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки не дает загрузке того же файла вернуть его на место во время переноса
+	if f.FileHash != "" {
+		if _, err := tx.Exec("SELECT hash FROM blobs WHERE hash = $1 FOR UPDATE", f.FileHash); err != nil {
+			return err
+		}
+	}
+
+	ids, err := updateStatus(tx, `
+	UPDATE documents SET scan_status = $3, scan_signature = $4, scanned_at = CURRENT_TIMESTAMP
+	WHERE `+sameFile+`
+	RETURNING id`, f.FilePath, f.FileHash, entities.ScanInfected, signature)
+	if err != nil {
+		return err
+	}
+
+	name := f.FileHash
+	if name == "" {
+		name = strconv.Itoa(f.DocumentID) + "_" + filepath.Base(f.FilePath)
+	}
+	target := filepath.Join(wk.quarantine, name)
+	if err := moveFile(f.FilePath, target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	after, err := json.Marshal(map[string]string{"signature": signature, "file_path": f.FilePath, "quarantine_path": target})
+	if err != nil {
+		return err
+	}
+	state := string(after)
+	for _, id := range ids {
+		id := id
+		if err := audit.AppendTx(tx, audit.Event{Action: "document.quarantine", TargetType: "document", TargetID: &id, After: &state}); err != nil {
+			return err
+		}
+		if err := events.Publish(tx, events.FileInfected, map[string]any{"document_id": id, "scan_status": entities.ScanInfected, "signature": signature}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("scan: %s found in %s, moved to %s", signature, f.FilePath, target)
+	return nil
+}
+
+func updateStatus(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// moveFile переносит файл, копируя его, если каталоги на разных файловых системах
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil || os.IsNotExist(err) {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// CheckPending проверяет файлы, оставшиеся в pending дольше минуты:
+// загруженные до включения проверки или не проверенные из-за недоступности сканера.
+// Возвращает число проверенных файлов.
+func (wk *Worker) CheckPending() (int, error) {
+	rows, err := wk.db.Query(`
+	SELECT id, file_path, COALESCE(file_hash, '')
+	FROM documents
+	WHERE scan_status = 'pending' AND file_path IS NOT NULL AND created_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+	ORDER BY scanned_at NULLS FIRST, id
+	LIMIT 50`)
+	if err != nil {
+		return 0, err
+	}
+	var files []file
+	for rows.Next() {
+		var f file
+		if err := rows.Scan(&f.DocumentID, &f.FilePath, &f.FileHash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Одинаковый файл нескольких документов проверяется один раз
+	checked := map[string]bool{}
+	n := 0
+	for _, f := range files {
+		key := f.FileHash + f.FilePath
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		if err := wk.Check(f); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RunPending периодически проверяет зависшие файлы до закрытия stop
+func (wk *Worker) RunPending(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := wk.CheckPending(); err != nil {
+				log.Printf("scan: pending files: %v", err)
+			} else if n > 0 {
+				log.Printf("scan: checked %d pending files", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
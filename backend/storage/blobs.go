@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// blobLockClass - первая часть ключа advisory-блокировки файла хранилища (вторая - hashtext(hash)).
+// Acquire держит ее до конца транзакции, а сборщик мусора не трогает файл под блокировкой.
+const blobLockClass = 727200
+
+// orphanGrace - возраст, после которого файл без строки в blobs считается брошенным
+// (например, после отката транзакции, в которой он был перенесен в хранилище)
+const orphanGrace = time.Hour
+
+// Blobs - хранилище файлов по содержимому: файл лежит в <dir>/<первые 2 символа хэша>/<sha256>,
+// а таблица blobs считает ссылки документов на него. Одинаковые файлы хранятся один раз.
+// Каждый файл зашифрован своим ключом данных, который хранится в blobs зашифрованным главным ключом.
+type Blobs struct {
+	dir string
+	kms KMS
+}
+
+func NewBlobs(dir string, kms KMS) *Blobs {
+	return &Blobs{dir: dir, kms: kms}
+}
+
+// NewBlobsFromEnv создает хранилище в каталоге UPLOAD_DIR (по умолчанию uploads)
+// с главными ключами из NewKeysFromEnv
+func NewBlobsFromEnv() (*Blobs, error) {
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	kms, err := NewKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewBlobs(dir, kms), nil
+}
+
+// Path возвращает путь к файлу с хэшем hash
+func (b *Blobs) Path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+// Staged - файл, записанный во временный каталог и еще не добавленный в хранилище
+type Staged struct {
+	Hash string
+	Size int64
+	path string
+	key  dataKey
+}
+
+// Stage шифрует поток во временный файл, считая SHA-256 и размер открытого текста
+func (b *Blobs) Stage(r io.Reader) (*Staged, error) {
+	key, err := newDataKey(b.kms)
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.createTemp()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	enc, err := NewEncryptWriter(f, key.key)
+	var size int64
+	if err == nil {
+		size, err = io.Copy(io.MultiWriter(enc, hash), r)
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &Staged{Hash: hex.EncodeToString(hash.Sum(nil)), Size: size, path: f.Name(), key: key}, nil
+}
+
+func (b *Blobs) createTemp() (*os.File, error) {
+	tmpDir := filepath.Join(b.dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(tmpDir, "upload-*")
+}
+
+// Discard удаляет временный файл, если он не был добавлен в хранилище
+func (s *Staged) Discard() {
+	if s.path != "" {
+		os.Remove(s.path)
+		s.path = ""
+	}
+}
+
+// Acquire добавляет ссылку на файл в транзакции tx и переносит его в хранилище.
+// Строка blobs и блокировка файла держатся до конца транзакции, поэтому сборщик мусора
+// не удалит файл, пока документ не сохранен. Если транзакция откатится, файл без строки
+// удалит сборщик мусора. Возвращает путь к файлу.
+func (b *Blobs) Acquire(tx *sql.Tx, s *Staged) (string, error) {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, hashtext($2))", blobLockClass, s.Hash); err != nil {
+		return "", err
+	}
+
+	// xmax = 0 только у вставленной строки
+	var inserted bool
+	err := tx.QueryRow(`
+	INSERT INTO blobs (hash, size, ref_count, key_id, wrapped_key) VALUES ($1, $2, 1, $3, $4)
+	ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1, updated_at = CURRENT_TIMESTAMP
+	RETURNING xmax = 0`, s.Hash, s.Size, s.key.keyID, s.key.wrapped).Scan(&inserted)
+	if err != nil {
+		return "", err
+	}
+
+	path := b.Path(s.Hash)
+	if !inserted {
+		// Файл уже есть со своим ключом данных, копия не нужна
+		if _, err := os.Stat(path); err == nil {
+			s.Discard()
+			return path, nil
+		}
+		// Файла нет (например, перенесен в карантин): восстанавливаем его из загрузки с новым ключом
+		_, err := tx.Exec("UPDATE blobs SET key_id = $2, wrapped_key = $3 WHERE hash = $1", s.Hash, s.key.keyID, s.key.wrapped)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(s.path, path); err != nil {
+		return "", err
+	}
+	s.path = ""
+	return path, nil
+}
+
+// File - открытый файл хранилища с расшифровкой на лету
+type File struct {
+	io.ReadSeeker
+	f       *os.File
+	size    int64
+	modTime time.Time
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Size возвращает размер содержимого
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// ModTime возвращает время записи файла
+func (f *File) ModTime() time.Time {
+	return f.modTime
+}
+
+// keyQueryer - *sql.DB или *sql.Tx
+type keyQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Open открывает файл документа для чтения. Файлы без хэша (загруженные до хранилища
+// по содержимому) и еще не зашифрованные файлы читаются как есть.
+func (b *Blobs) Open(q keyQueryer, path, hash string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file := &File{ReadSeeker: f, f: f, size: info.Size(), modTime: info.ModTime()}
+	if hash == "" {
+		return file, nil
+	}
+
+	// Ключ читается после открытия: EncryptPlain сохраняет ключ раньше, чем заменяет файл,
+	// поэтому открытый файл без заголовка - еще не зашифрованная версия
+	var keyID sql.NullString
+	var wrapped []byte
+	err = q.QueryRow("SELECT key_id, wrapped_key FROM blobs WHERE hash = $1", hash).Scan(&keyID, &wrapped)
+	if err != nil && err != sql.ErrNoRows {
+		f.Close()
+		return nil, err
+	}
+	if !keyID.Valid || !encrypted(f) {
+		return file, nil
+	}
+
+	key, err := b.kms.Unwrap(keyID.String, wrapped)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	dec, err := NewDecryptReader(f, info.Size(), key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file.ReadSeeker, file.size = dec, dec.Size()
+	return file, nil
+}
+
+// encrypted сообщает, начинается ли файл с заголовка зашифрованного формата
+func encrypted(f io.ReaderAt) bool {
+	header := make([]byte, headerLength)
+	_, err := f.ReadAt(header, 0)
+	return err == nil && bytes.Equal(header, magic)
+}
+
+// Release убирает ссылку на файл. Сам файл удаляет сборщик мусора.
+func Release(tx *sql.Tx, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE blobs SET ref_count = ref_count - 1, updated_at = CURRENT_TIMESTAMP WHERE hash = $1 AND ref_count > 0", hash)
+	return err
+}
+
+// CollectGarbage удаляет файлы без ссылок, а также брошенные файлы без строки в blobs
+// и временные файлы старше orphanGrace. Возвращает число удаленных файлов.
+// Строки, заблокированные загрузкой того же файла, пропускаются до следующего запуска.
+func (b *Blobs) CollectGarbage(db *sql.DB) (int, error) {
+	n, err := b.collectUnreferenced(db)
+	if err != nil {
+		return n, err
+	}
+	orphans, err := b.collectOrphans(db, time.Now().Add(-orphanGrace))
+	return n + orphans, err
+}
+
+func (b *Blobs) collectUnreferenced(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT hash FROM blobs WHERE ref_count = 0 LIMIT 100 FOR UPDATE SKIP LOCKED")
+	if err != nil {
+		return 0, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, hash := range hashes {
+		// Если фиксация не пройдет, строка останется и файл будет удален повторно
+		if err := os.Remove(b.Path(hash)); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		if _, err := tx.Exec("DELETE FROM blobs WHERE hash = $1", hash); err != nil {
+			return 0, err
+		}
+	}
+	return len(hashes), tx.Commit()
+}
+
+// collectOrphans удаляет файлы хранилища без строки в blobs и временные файлы,
+// измененные раньше before
+func (b *Blobs) collectOrphans(db *sql.DB, before time.Time) (int, error) {
+	removed := 0
+	tmp, err := staleFiles(filepath.Join(b.dir, "tmp"), before, func(string, string) bool { return true })
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range tmp {
+		if err := os.Remove(filepath.Join(b.dir, "tmp", name)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+
+	prefixes, err := os.ReadDir(b.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return removed, nil
+		}
+		return removed, err
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || len(prefix.Name()) != 2 || !isHex(prefix.Name()) {
+			continue
+		}
+		hashes, err := staleFiles(filepath.Join(b.dir, prefix.Name()), before, storedFile)
+		if err != nil {
+			return removed, err
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+
+		rows, err := db.Query("SELECT hash FROM blobs WHERE hash = ANY($1)", pq.Array(hashes))
+		if err != nil {
+			return removed, err
+		}
+		known := map[string]bool{}
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				rows.Close()
+				return removed, err
+			}
+			known[hash] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return removed, err
+		}
+
+		for _, hash := range hashes {
+			if known[hash] {
+				continue
+			}
+			ok, err := b.removeOrphan(db, hash)
+			if err != nil {
+				return removed, err
+			}
+			if ok {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// removeOrphan удаляет файл, если у него по-прежнему нет строки в blobs.
+// Файл, который сейчас добавляется в хранилище (Acquire), пропускается.
+func (b *Blobs) removeOrphan(db *sql.DB, hash string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var locked, exists bool
+	err = tx.QueryRow("SELECT pg_try_advisory_xact_lock($1, hashtext($2))", blobLockClass, hash).Scan(&locked)
+	if err != nil || !locked {
+		return false, err
+	}
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = $1)", hash).Scan(&exists); err != nil || exists {
+		return false, err
+	}
+	if err := os.Remove(b.Path(hash)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// staleFiles возвращает имена файлов каталога dir, измененных раньше before и подходящих под match
+func staleFiles(dir string, before time.Time, match func(dir, name string) bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !match(dir, e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if info.ModTime().Before(before) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// storedFile сообщает, что файл - файл хранилища <первые 2 символа хэша>/<sha256>,
+// а не файл, загруженный до хранения по содержимому
+func storedFile(dir, name string) bool {
+	return len(name) == sha256.Size*2 && isHex(name) && name[:2] == filepath.Base(dir)
+}
+
+// isHex сообщает, состоит ли строка только из строчных шестнадцатеричных цифр
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// RunGC периодически удаляет файлы без ссылок до закрытия stop
+func (b *Blobs) RunGC(db *sql.DB, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := b.CollectGarbage(db)
+			if err != nil {
+				log.Printf("storage: garbage collection failed: %v", err)
+			} else if n > 0 {
+				log.Printf("storage: removed %d unreferenced file(s)", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStage(t *testing.T) {
+	b := NewBlobs(t.TempDir(), testKeys(t))
+	content := "договор поставки"
+	staged, err := b.Stage(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer staged.Discard()
+
+	sum := sha256.Sum256([]byte(content))
+	if staged.Hash != hex.EncodeToString(sum[:]) || staged.Size != int64(len(content)) {
+		t.Fatalf("staged %s (%d bytes)", staged.Hash, staged.Size)
+	}
+	if got := b.Path(staged.Hash); got != filepath.Join(b.dir, staged.Hash[:2], staged.Hash) {
+		t.Errorf("Path = %s", got)
+	}
+
+	tmp := staged.path
+	staged.Discard()
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("Discard must remove the temporary file")
+	}
+}
+
+func TestStaleFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ab")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * orphanGrace)
+	hash := "ab" + strings.Repeat("0", 62)
+	files := map[string]time.Time{
+		hash:                           old,
+		"ab" + strings.Repeat("1", 62): time.Now(),
+		"cd" + strings.Repeat("0", 62): old,
+		"1712345678_договор.pdf":       old,
+		"AB" + strings.Repeat("0", 62): old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := staleFiles(dir, time.Now().Add(-orphanGrace), storedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != hash {
+		t.Errorf("staleFiles = %v, want only the old file named by its hash", names)
+	}
+
+	if names, err := staleFiles(filepath.Join(dir, "missing"), time.Now(), nil); err != nil || names != nil {
+		t.Errorf("missing directory = %v, %v", names, err)
+	}
+}
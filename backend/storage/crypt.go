@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Формат зашифрованного файла: заголовок magic и порции по chunkSize байт открытого текста,
+// каждая зашифрована AES-256-GCM отдельно. Nonce порции - ее номер и признак последней порции,
+// поэтому файл читается с любого места, а перестановка или обрезка порций обнаруживается.
+const (
+	chunkSize    = 64 << 10
+	sealedChunk  = chunkSize + 16
+	dataKeySize  = 32
+	nonceFinal   = 1
+	headerLength = 8
+)
+
+var magic = []byte("DFENC\x00\x00\x01")
+
+// ErrCorrupted - содержимое зашифрованного файла повреждено или ключ не подходит
+var ErrCorrupted = errors.New("storage: encrypted file is corrupted")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if final {
+		nonce[11] = nonceFinal
+	}
+	return nonce
+}
+
+// encryptWriter шифрует поток порциями; Close записывает последнюю порцию
+type encryptWriter struct {
+	w     io.Writer
+	gcm   cipher.AEAD
+	buf   []byte
+	index uint64
+	err   error
+}
+
+// NewEncryptWriter возвращает writer, шифрующий данные ключом key (32 байта).
+// Без Close файл останется неполным.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(magic); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, gcm: gcm, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// Полная порция записывается только когда известно, что она не последняя
+		if len(e.buf) == chunkSize {
+			if e.err = e.seal(false); e.err != nil {
+				return written, e.err
+			}
+		}
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	sealed := e.gcm.Seal(nil, chunkNonce(e.index, final), e.buf, nil)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.seal(true); err != nil {
+		e.err = err
+		return err
+	}
+	e.err = errors.New("storage: write after close")
+	return nil
+}
+
+// PlainSize возвращает размер открытого текста по размеру зашифрованного файла
+func PlainSize(encrypted int64) (int64, error) {
+	body := encrypted - headerLength
+	if body < 16 {
+		return 0, ErrCorrupted
+	}
+	chunks := (body + sealedChunk - 1) / sealedChunk
+	last := body - (chunks-1)*sealedChunk
+	if last < 16 {
+		return 0, ErrCorrupted
+	}
+	return body - chunks*16, nil
+}
+
+// DecryptReader читает зашифрованный файл с произвольного места (io.ReadSeeker и io.ReaderAt)
+type DecryptReader struct {
+	r      io.ReaderAt
+	gcm    cipher.AEAD
+	size   int64
+	chunks int64
+	offset int64
+
+	// Последняя расшифрованная порция
+	cached int64
+	plain  []byte
+}
+
+// NewDecryptReader проверяет заголовок файла размером encrypted байт и возвращает reader
+// открытого текста
+func NewDecryptReader(r io.ReaderAt, encrypted int64, key []byte) (*DecryptReader, error) {
+	header := make([]byte, headerLength)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, ErrCorrupted
+	}
+	if !bytes.Equal(header, magic) {
+		return nil, ErrCorrupted
+	}
+	size, err := PlainSize(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	chunks := (encrypted - headerLength + sealedChunk - 1) / sealedChunk
+	return &DecryptReader{r: r, gcm: gcm, size: size, chunks: chunks, cached: -1}, nil
+}
+
+// Size возвращает размер открытого текста
+func (d *DecryptReader) Size() int64 {
+	return d.size
+}
+
+// chunk расшифровывает порцию с номером index
+func (d *DecryptReader) chunk(index int64) ([]byte, error) {
+	if index == d.cached {
+		return d.plain, nil
+	}
+	length := int64(sealedChunk)
+	final := index == d.chunks-1
+	if final {
+		length = d.size - index*chunkSize + 16
+	}
+	sealed := make([]byte, length)
+	if _, err := d.r.ReadAt(sealed, headerLength+index*sealedChunk); err != nil && err != io.EOF {
+		return nil, err
+	}
+	plain, err := d.gcm.Open(sealed[:0], chunkNonce(uint64(index), final), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d", ErrCorrupted, index)
+	}
+	d.cached, d.plain = index, plain
+	return plain, nil
+}
+
+func (d *DecryptReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("storage: negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		if off >= d.size {
+			return n, io.EOF
+		}
+		plain, err := d.chunk(off / chunkSize)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off%chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+	// Чтение не выходит за порцию, чтобы не расшифровывать лишнее
+	plain, err := d.chunk(d.offset / chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, plain[d.offset%chunkSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *DecryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	d.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKeys(t *testing.T) *LocalKeys {
+	t.Helper()
+	keys, err := NewLocalKeys("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func encrypt(t *testing.T, plain, key []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := NewEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Запись небольшими порциями проверяет буферизацию
+	for rest := plain; len(rest) > 0; {
+		n := min(len(rest), 1000)
+		if _, err := enc.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		sealed := encrypt(t, plain, key)
+
+		if got, err := PlainSize(int64(len(sealed))); err != nil || got != int64(size) {
+			t.Errorf("size %d: PlainSize = %d, %v", size, got, err)
+		}
+		dec, err := NewDecryptReader(bytes.NewReader(sealed), int64(len(sealed)), key)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		got, err := io.ReadAll(dec)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip failed: %v", size, err)
+		}
+	}
+}
+
+func TestDecryptSeek(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plain := make([]byte, 2*chunkSize+500)
+	rand.Read(plain)
+	sealed := encrypt(t, plain, key)
+	dec, err := NewDecryptReader(bytes.NewReader(sealed), int64(len(sealed)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Диапазон через границу порций
+	start := int64(chunkSize - 10)
+	if _, err := dec.Seek(start, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	part := make([]byte, 100)
+	if _, err := io.ReadFull(dec, part); err != nil || !bytes.Equal(part, plain[start:start+100]) {
+		t.Errorf("read after seek: %v", err)
+	}
+
+	end, _ := dec.Seek(-20, io.SeekEnd)
+	tail, _ := io.ReadAll(dec)
+	if end != int64(len(plain)-20) || !bytes.Equal(tail, plain[len(plain)-20:]) {
+		t.Errorf("tail read at %d: %d bytes", end, len(tail))
+	}
+
+	at := make([]byte, 50)
+	if n, err := dec.ReadAt(at, int64(len(plain)-30)); n != 30 || err != io.EOF {
+		t.Errorf("ReadAt past end = %d, %v", n, err)
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plain := make([]byte, 2*chunkSize+500)
+	sealed := encrypt(t, plain, key)
+
+	flipped := bytes.Clone(sealed)
+	flipped[headerLength+chunkSize+100] ^= 1
+	// Обрезка по границе порции: последней становится порция, зашифрованная как промежуточная
+	truncated := sealed[:headerLength+2*sealedChunk]
+
+	for name, data := range map[string][]byte{"flipped": flipped, "truncated": truncated} {
+		dec, err := NewDecryptReader(bytes.NewReader(data), int64(len(data)), key)
+		if err == nil {
+			_, err = io.ReadAll(dec)
+		}
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: err = %v, want ErrCorrupted", name, err)
+		}
+	}
+
+	wrongKey := bytes.Repeat([]byte{8}, 32)
+	dec, err := NewDecryptReader(bytes.NewReader(sealed), int64(len(sealed)), wrongKey)
+	if err == nil {
+		_, err = io.ReadAll(dec)
+	}
+	if !errors.Is(err, ErrCorrupted) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+}
+
+func TestLocalKeys(t *testing.T) {
+	old := bytes.Repeat([]byte{1}, 32)
+	t.Setenv("STORAGE_MASTER_KEYS", "k2:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))+",k1:"+base64.StdEncoding.EncodeToString(old))
+	keys, err := NewKeysFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.KeyID() != "k2" {
+		t.Errorf("current key = %s, want the first one", keys.KeyID())
+	}
+
+	// Ключ, зашифрованный старым главным ключом, расшифровывается и после ротации
+	oldKeys, _ := NewLocalKeys("k1", map[string][]byte{"k1": old})
+	dataKey := bytes.Repeat([]byte{9}, 32)
+	keyID, wrapped, err := oldKeys.Wrap(dataKey)
+	if err != nil || keyID != "k1" {
+		t.Fatal(keyID, err)
+	}
+	if got, err := keys.Unwrap(keyID, wrapped); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("Unwrap = %v", err)
+	}
+	// Идентификатор ключа проверяется вместе с содержимым
+	if _, err := keys.Unwrap("k2", wrapped); err == nil {
+		t.Error("unwrap with another master key must fail")
+	}
+
+	for _, bad := range []string{"nokey", "k1:not-base64!", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1:AAAA,k1:AAAA"} {
+		t.Setenv("STORAGE_MASTER_KEYS", bad)
+		if _, err := NewKeysFromEnv(); err == nil {
+			t.Errorf("STORAGE_MASTER_KEYS=%q must be rejected", bad)
+		}
+	}
+
+	// Ключ разработки - только по явному DEV_MODE=1
+	t.Setenv("STORAGE_MASTER_KEYS", "")
+	t.Setenv("DEV_MODE", "")
+	if _, err := NewKeysFromEnv(); err == nil {
+		t.Error("missing STORAGE_MASTER_KEYS must be rejected without DEV_MODE=1")
+	}
+	t.Setenv("DEV_MODE", "1")
+	if keys, err := NewKeysFromEnv(); err != nil || keys.KeyID() != "dev" {
+		t.Errorf("DEV_MODE=1: %v", err)
+	}
+}
+
+func TestStagedFileIsEncrypted(t *testing.T) {
+	b := NewBlobs(t.TempDir(), testKeys(t))
+	content := "конфиденциальный договор"
+	staged, err := b.Stage(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer staged.Discard()
+
+	data, err := os.ReadFile(staged.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(content)) || !bytes.HasPrefix(data, magic) {
+		t.Fatal("staged file must be encrypted")
+	}
+	key, err := b.kms.Unwrap(staged.key.keyID, staged.key.wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewDecryptReader(bytes.NewReader(data), int64(len(data)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(dec); string(got) != content {
+		t.Errorf("decrypted %q", got)
+	}
+}
+
+func TestOpenPlainFile(t *testing.T) {
+	// Файлы без хэша читаются как есть, без обращения к базе
+	path := filepath.Join(t.TempDir(), "legacy.txt")
+	os.WriteFile(path, []byte("old file"), 0644)
+	f, err := NewBlobs(t.TempDir(), testKeys(t)).Open(nil, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := io.ReadAll(f); string(got) != "old file" || f.Size() != 8 {
+		t.Errorf("read %q (%d bytes)", got, f.Size())
+	}
+}
+
+func TestSealedFile(t *testing.T) {
+	b := NewBlobs(t.TempDir(), testKeys(t))
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, keyID, wrapped, err := b.Seal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(enc, "архив выгрузки")
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if data, _ := os.ReadFile(path); !bytes.HasPrefix(data, magic) {
+		t.Fatal("sealed file must be encrypted")
+	}
+	sealed, err := b.OpenSealed(path, keyID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sealed.Close()
+	if got, _ := io.ReadAll(sealed); string(got) != "архив выгрузки" || sealed.Size() != int64(len("архив выгрузки")) {
+		t.Errorf("read %q (%d bytes)", got, sealed.Size())
+	}
+}
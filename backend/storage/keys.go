@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KMS шифрует ключи данных файлов главным ключом. Реализация может обращаться
+// к внешней системе управления ключами; главный ключ не покидает ее.
+type KMS interface {
+	// KeyID возвращает идентификатор текущего главного ключа
+	KeyID() string
+	// Wrap шифрует ключ данных текущим главным ключом и возвращает его идентификатор
+	Wrap(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap расшифровывает ключ данных главным ключом keyID
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeys - главные ключи AES-256 из конфигурации. Первый ключ текущий,
+// остальные нужны только для расшифровки до ротации.
+type LocalKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalKeys создает набор ключей; current должен быть среди keys
+func NewLocalKeys(current string, keys map[string][]byte) (*LocalKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("master key %q is not configured", current)
+	}
+	for id, key := range keys {
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("master key %q: expected %d bytes, got %d", id, dataKeySize, len(key))
+		}
+	}
+	return &LocalKeys{current: current, keys: keys}, nil
+}
+
+// NewKeysFromEnv читает главные ключи из STORAGE_MASTER_KEYS: список "id:base64" через запятую,
+// первый ключ текущий. Ключ разработки из открытой строки используется только при DEV_MODE=1:
+// им может расшифровать файлы любой.
+func NewKeysFromEnv() (*LocalKeys, error) {
+	value := os.Getenv("STORAGE_MASTER_KEYS")
+	if value == "" {
+		if os.Getenv("DEV_MODE") != "1" {
+			return nil, fmt.Errorf("STORAGE_MASTER_KEYS is not set (DEV_MODE=1 allows the development key)")
+		}
+		key := sha256.Sum256([]byte("dev_storage_key_change_me"))
+		return NewLocalKeys("dev", map[string][]byte{"dev": key[:]})
+	}
+
+	var current string
+	keys := map[string][]byte{}
+	for _, item := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("STORAGE_MASTER_KEYS: expected id:base64, got %q", item)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("STORAGE_MASTER_KEYS: duplicate key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("STORAGE_MASTER_KEYS: key %q: %w", id, err)
+		}
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+	local, err := NewLocalKeys(current, keys)
+	if err != nil {
+		return nil, fmt.Errorf("STORAGE_MASTER_KEYS: %w", err)
+	}
+	return local, nil
+}
+
+func (k *LocalKeys) KeyID() string {
+	return k.current
+}
+
+// Wrap шифрует ключ данных AES-GCM; идентификатор ключа входит в проверяемые данные
+func (k *LocalKeys) Wrap(dataKey []byte) (string, []byte, error) {
+	gcm, err := newGCM(k.keys[k.current])
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.current, gcm.Seal(nonce, nonce, dataKey, []byte(k.current)), nil
+}
+
+func (k *LocalKeys) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not configured", keyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	nonce, sealed := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	dataKey, err := gcm.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key with master key %q", keyID)
+	}
+	return dataKey, nil
+}
+
+// dataKey - ключ данных файла и он же, зашифрованный главным ключом keyID
+type dataKey struct {
+	key     []byte
+	keyID   string
+	wrapped []byte
+}
+
+// newDataKey создает случайный ключ данных и шифрует его текущим главным ключом
+func newDataKey(kms KMS) (dataKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return dataKey{}, err
+	}
+	keyID, wrapped, err := kms.Wrap(key)
+	if err != nil {
+		return dataKey{}, err
+	}
+	return dataKey{key: key, keyID: keyID, wrapped: wrapped}, nil
+}
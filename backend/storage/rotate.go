@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"database/sql"
+	"io"
+	"os"
+)
+
+// rotateBatch - число файлов, обрабатываемых в одной транзакции
+const rotateBatch = 100
+
+// RewrapKeys перешифровывает ключи данных файлов и превью, зашифрованные не текущим главным ключом.
+// Содержимое файлов не меняется. Возвращает число обновленных ключей.
+func (b *Blobs) RewrapKeys(db *sql.DB) (int, error) {
+	total := 0
+	after := ""
+	for {
+		n, last, err := b.rewrapBatch(db, after)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if last == "" {
+			break
+		}
+		after = last
+	}
+
+	var position previewKey
+	for {
+		n, last, err := b.rewrapPreviewBatch(db, position)
+		total += n
+		if err != nil || last == nil {
+			return total, err
+		}
+		position = *last
+	}
+}
+
+// rewrapBatch обрабатывает файлы с хэшем больше after и возвращает последний хэш
+func (b *Blobs) rewrapBatch(db *sql.DB, after string) (int, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	current := b.kms.KeyID()
+	rows, err := tx.Query(`
+	SELECT hash, key_id, wrapped_key FROM blobs
+	WHERE key_id IS NOT NULL AND key_id <> $1 AND hash > $2
+	ORDER BY hash LIMIT $3
+	FOR UPDATE`, current, after, rotateBatch)
+	if err != nil {
+		return 0, "", err
+	}
+	type wrappedKey struct {
+		hash, keyID string
+		wrapped     []byte
+	}
+	var keys []wrappedKey
+	for rows.Next() {
+		var k wrappedKey
+		if err := rows.Scan(&k.hash, &k.keyID, &k.wrapped); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+	if len(keys) == 0 {
+		return 0, "", nil
+	}
+
+	for _, k := range keys {
+		key, err := b.kms.Unwrap(k.keyID, k.wrapped)
+		if err != nil {
+			return 0, "", err
+		}
+		keyID, wrapped, err := b.kms.Wrap(key)
+		if err != nil {
+			return 0, "", err
+		}
+		if _, err := tx.Exec("UPDATE blobs SET key_id = $2, wrapped_key = $3 WHERE hash = $1", k.hash, keyID, wrapped); err != nil {
+			return 0, "", err
+		}
+	}
+	return len(keys), keys[len(keys)-1].hash, tx.Commit()
+}
+
+// previewKey - ключ строки document_previews
+type previewKey struct {
+	documentID int
+	size       string
+}
+
+// rewrapPreviewBatch обрабатывает превью после строки after и возвращает последнюю обработанную
+func (b *Blobs) rewrapPreviewBatch(db *sql.DB, after previewKey) (int, *previewKey, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	current := b.kms.KeyID()
+	rows, err := tx.Query(`
+	SELECT document_id, size, key_id, wrapped_key FROM document_previews
+	WHERE key_id IS NOT NULL AND key_id <> $1 AND (document_id, size) > ($2, $3)
+	ORDER BY document_id, size LIMIT $4
+	FOR UPDATE`, current, after.documentID, after.size, rotateBatch)
+	if err != nil {
+		return 0, nil, err
+	}
+	type wrappedKey struct {
+		previewKey
+		keyID   string
+		wrapped []byte
+	}
+	var keys []wrappedKey
+	for rows.Next() {
+		var k wrappedKey
+		if err := rows.Scan(&k.documentID, &k.size, &k.keyID, &k.wrapped); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(keys) == 0 {
+		return 0, nil, nil
+	}
+
+	for _, k := range keys {
+		key, err := b.kms.Unwrap(k.keyID, k.wrapped)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyID, wrapped, err := b.kms.Wrap(key)
+		if err != nil {
+			return 0, nil, err
+		}
+		_, err = tx.Exec("UPDATE document_previews SET key_id = $3, wrapped_key = $4 WHERE document_id = $1 AND size = $2",
+			k.documentID, k.size, keyID, wrapped)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	return len(keys), &keys[len(keys)-1].previewKey, tx.Commit()
+}
+
+// EncryptPlain шифрует файлы, сохраненные до включения шифрования.
+// Возвращает число зашифрованных файлов; отсутствующие на диске пропускаются.
+func (b *Blobs) EncryptPlain(db *sql.DB) (int, error) {
+	total := 0
+	after := ""
+	for {
+		var hash string
+		err := db.QueryRow("SELECT hash FROM blobs WHERE key_id IS NULL AND hash > $1 ORDER BY hash LIMIT 1", after).Scan(&hash)
+		if err == sql.ErrNoRows {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		after = hash
+
+		done, err := b.encryptFile(db, hash)
+		if err != nil {
+			return total, err
+		}
+		if done {
+			total++
+		}
+	}
+}
+
+// encryptFile шифрует один файл. Ключ сохраняется до замены файла:
+// Open читает файл без заголовка как незашифрованный, так что читатели не ломаются.
+func (b *Blobs) encryptFile(db *sql.DB, hash string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки исключает одновременную загрузку, а файлы без ссылок скоро удалит сборщик мусора
+	var keyID sql.NullString
+	err = tx.QueryRow("SELECT key_id FROM blobs WHERE hash = $1 AND ref_count > 0 FOR UPDATE", hash).Scan(&keyID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if keyID.Valid {
+		return false, nil
+	}
+
+	path := b.Path(hash)
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	if encrypted(src) {
+		return false, nil
+	}
+
+	key, err := newDataKey(b.kms)
+	if err != nil {
+		return false, err
+	}
+	tmp, err := b.createTemp()
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	enc, err := NewEncryptWriter(tmp, key.key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(enc, src); err != nil {
+		return false, err
+	}
+	if err := enc.Close(); err != nil {
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec("UPDATE blobs SET key_id = $2, wrapped_key = $3 WHERE hash = $1", hash, key.keyID, key.wrapped); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// Seal возвращает writer, шифрующий w новым ключом данных, и этот ключ, зашифрованный
+// главным ключом. Нужен для файлов вне хранилища по содержимому (архивов выгрузки и превью):
+// ключ хранит вызывающий код. RewrapKeys перешифровывает ключи превью, но не архивов выгрузки.
+func (b *Blobs) Seal(w io.Writer) (io.WriteCloser, string, []byte, error) {
+	key, err := newDataKey(b.kms)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	enc, err := NewEncryptWriter(w, key.key)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return enc, key.keyID, key.wrapped, nil
+}
+
+// OpenSealed открывает файл, записанный через Seal
+func (b *Blobs) OpenSealed(path, keyID string, wrapped []byte) (*File, error) {
+	key, err := b.kms.Unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	dec, err := NewDecryptReader(f, info.Size(), key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &File{ReadSeeker: dec, f: f, size: dec.Size(), modTime: info.ModTime()}, nil
+}
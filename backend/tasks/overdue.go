@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"backend/events"
+)
+
+// overdueTask - данные события task.overdue
+type overdueTask struct {
+	ID         int       `json:"id"`
+	DocumentID int       `json:"document_id"`
+	Title      string    `json:"title"`
+	AssigneeID int       `json:"assignee_id"`
+	DueAt      time.Time `json:"due_at"`
+}
+
+// MarkOverdue отмечает просроченные поручения и публикует по каждому событие task.overdue.
+// Возвращает число отмеченных поручений.
+func MarkOverdue(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	UPDATE tasks SET overdue = TRUE
+	WHERE NOT overdue AND due_at < NOW() AND status IN ('open', 'in_progress')
+	RETURNING id, document_id, title, assignee_id, due_at`)
+	if err != nil {
+		return 0, err
+	}
+	var marked []overdueTask
+	for rows.Next() {
+		var t overdueTask
+		if err := rows.Scan(&t.ID, &t.DocumentID, &t.Title, &t.AssigneeID, &t.DueAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		marked = append(marked, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, t := range marked {
+		if err := events.Publish(tx, events.TaskOverdue, t); err != nil {
+			return 0, err
+		}
+	}
+	return len(marked), tx.Commit()
+}
+
+// RunOverdueCheck периодически ищет просроченные поручения до закрытия stop
+func RunOverdueCheck(db *sql.DB, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := MarkOverdue(db)
+			if err != nil {
+				log.Printf("tasks: overdue check failed: %v", err)
+			} else if n > 0 {
+				log.Printf("tasks: %d task(s) became overdue", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
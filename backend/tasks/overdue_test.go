@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"backend/database"
+	"backend/events"
+)
+
+// setupOverdueTestDB подключается к тестовой БД или пропускает тест, если она недоступна
+func setupOverdueTestDB(t *testing.T) *sql.DB {
+	db, err := database.Connect()
+	if err != nil {
+		t.Skipf("Skipping integration test: cannot connect to database: %v", err)
+	}
+	if err := database.CreateTables(db); err != nil {
+		db.Close()
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	return db
+}
+
+// TestMarkOverdueOnce проверяет, что просроченное открытое поручение отмечается
+// и порождает событие task.overdue ровно один раз, в том числе при периодической проверке
+func TestMarkOverdueOnce(t *testing.T) {
+	db := setupOverdueTestDB(t)
+	defer db.Close()
+
+	login := fmt.Sprintf("overdue-test-%d", time.Now().UnixNano())
+	var userID, docID, overdueID, futureID, doneID int
+	if err := db.QueryRow("INSERT INTO users (login, password_hash) VALUES ($1, '') RETURNING id", login).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id = $1", userID)
+	if err := db.QueryRow("INSERT INTO documents (title, user_id) VALUES ('Overdue test', $1) RETURNING id", userID).Scan(&docID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM documents WHERE id = $1", docID)
+
+	insertTask := func(due time.Duration, status string) int {
+		var id int
+		err := db.QueryRow(`
+		INSERT INTO tasks (document_id, title, assignee_id, author_id, due_at, status)
+		VALUES ($1, 'Overdue test', $2, $2, NOW() + $3 * INTERVAL '1 second', $4) RETURNING id`,
+			docID, userID, int(due.Seconds()), status).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	overdueID = insertTask(-time.Hour, "open")
+	futureID = insertTask(time.Hour, "open")
+	doneID = insertTask(-time.Hour, "done")
+	defer db.Exec(`DELETE FROM event_outbox WHERE event_type = $1 AND (payload->>'document_id')::int = $2`, events.TaskOverdue, docID)
+
+	if n, err := MarkOverdue(db); err != nil || n < 1 {
+		t.Fatalf("MarkOverdue = %d, %v", n, err)
+	}
+	// Повторные проверки по таймеру не должны отмечать поручение снова
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		RunOverdueCheck(db, 10*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-done
+
+	for id, want := range map[int]bool{overdueID: true, futureID: false, doneID: false} {
+		var overdue bool
+		if err := db.QueryRow("SELECT overdue FROM tasks WHERE id = $1", id).Scan(&overdue); err != nil {
+			t.Fatal(err)
+		}
+		if overdue != want {
+			t.Errorf("task %d: overdue = %v, want %v", id, overdue, want)
+		}
+	}
+
+	var published int
+	err := db.QueryRow(`SELECT COUNT(*) FROM event_outbox WHERE event_type = $1 AND (payload->>'id')::int = $2`,
+		events.TaskOverdue, overdueID).Scan(&published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 1 {
+		t.Errorf("task.overdue published %d times, want 1", published)
+	}
+}
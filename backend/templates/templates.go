@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern находит подстановки вида {{ name }} или {{ client.name }}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+(?:\.[A-Za-z0-9_]+)*)\s*\}\}`)
+
+// Placeholders возвращает имена подстановок из текстов без повторов, по алфавиту
+func Placeholders(texts ...string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, text := range texts {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render заменяет подстановки значениями и возвращает имена,
+// для которых значений нет (такие подстановки остаются в тексте как есть)
+func Render(text string, values map[string]string) (string, []string) {
+	var missing []string
+	result := placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderPattern.FindStringSubmatch(m)[1]
+		value, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		return value
+	})
+	return result, missing
+}
+
+// Flatten превращает значения из JSON в строки для подстановки.
+// Вложенные объекты доступны через точку ({{client.name}}), массивы
+// выводятся через запятую, null считается отсутствующим значением.
+func Flatten(values map[string]any) map[string]string {
+	result := map[string]string{}
+	flatten("", values, result)
+	return result
+}
+
+func flatten(prefix string, values map[string]any, result map[string]string) {
+	for key, value := range values {
+		if nested, ok := value.(map[string]any); ok {
+			flatten(prefix+key+".", nested, result)
+			continue
+		}
+		if s, ok := format(value); ok {
+			result[prefix+key] = s
+		}
+	}
+}
+
+func format(value any) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := format(item); ok {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", "), true
+	}
+	return "", false
+}
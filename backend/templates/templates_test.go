@@ -0,0 +1,49 @@
+package templates
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	got := Placeholders("Договор {{ number }} от {{today}}", "{{client.name}}, {{number}}", "{{ bad name }}")
+	want := []string{"client.name", "number", "today"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Placeholders = %v, want %v", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	text, missing := Render("{{client.name}} платит {{ amount }} до {{due}}", map[string]string{
+		"client.name": "ООО Ромашка",
+		"amount":      "1500",
+	})
+	if text != "ООО Ромашка платит 1500 до {{due}}" {
+		t.Errorf("text = %q", text)
+	}
+	if !reflect.DeepEqual(missing, []string{"due"}) {
+		t.Errorf("missing = %v", missing)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	got := Flatten(map[string]any{
+		"amount": 1500.0,
+		"rate":   0.25,
+		"signed": true,
+		"empty":  nil,
+		"client": map[string]any{"name": "ООО Ромашка", "inn": "7700000000"},
+		"items":  []any{"аренда", "охрана"},
+	})
+	want := map[string]string{
+		"amount":      "1500",
+		"rate":        "0.25",
+		"signed":      "true",
+		"client.name": "ООО Ромашка",
+		"client.inn":  "7700000000",
+		"items":       "аренда, охрана",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Flatten = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package upload
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxSize - ограничение размера файла по умолчанию (50 МБ)
+const DefaultMaxSize = 50 << 20
+
+// DefaultDenied - запрещенные по умолчанию типы и расширения: исполняемые файлы и скрипты
+var DefaultDenied = []string{
+	"application/x-msdownload", "application/x-executable", "application/x-mach-binary", "text/x-shellscript",
+	".exe", ".dll", ".com", ".bat", ".cmd", ".scr", ".msi", ".ps1", ".vbs", ".js", ".jar", ".sh",
+}
+
+// Коды ошибок проверки загрузки
+const (
+	CodeTooLarge          = "file_too_large"
+	CodeTypeNotAllowed    = "file_type_not_allowed"
+	CodeExtensionMismatch = "extension_mismatch"
+)
+
+// Error - причина отказа в загрузке, возвращается клиенту в JSON
+type Error struct {
+	Code              string   `json:"error"`
+	Message           string   `json:"message"`
+	FileName          string   `json:"file_name,omitempty"`
+	DeclaredExtension string   `json:"declared_extension,omitempty"`
+	DetectedType      string   `json:"detected_type,omitempty"`
+	ExpectedTypes     []string `json:"expected_types,omitempty"`
+	Size              int64    `json:"size,omitempty"`
+	MaxSize           int64    `json:"max_size,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Policy - правила приема файлов. Элементы списков - MIME-типы (можно "image/*")
+// или расширения с точкой (".exe"). Пустой список разрешенных допускает все, кроме запрещенных.
+type Policy struct {
+	MaxSize int64
+	Allowed []string
+	Denied  []string
+}
+
+// PolicyFromEnv читает правила из UPLOAD_MAX_SIZE (байты), UPLOAD_ALLOWED_TYPES
+// и UPLOAD_DENIED_TYPES (через запятую). Без UPLOAD_DENIED_TYPES действует DefaultDenied.
+func PolicyFromEnv() (Policy, error) {
+	p := Policy{MaxSize: DefaultMaxSize, Denied: DefaultDenied}
+	if v := os.Getenv("UPLOAD_MAX_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return p, fmt.Errorf("UPLOAD_MAX_SIZE: expected a positive number of bytes, got %q", v)
+		}
+		p.MaxSize = size
+	}
+	if v, ok := os.LookupEnv("UPLOAD_ALLOWED_TYPES"); ok {
+		p.Allowed = splitList(v)
+	}
+	if v, ok := os.LookupEnv("UPLOAD_DENIED_TYPES"); ok {
+		p.Denied = splitList(v)
+	}
+	return p, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LimitFor возвращает ограничение размера с учетом ограничения категории.
+// Категория может только уменьшить глобальный предел.
+func (p Policy) LimitFor(categoryMax *int64) int64 {
+	if categoryMax != nil && *categoryMax > 0 && *categoryMax < p.MaxSize {
+		return *categoryMax
+	}
+	return p.MaxSize
+}
+
+// CheckSize проверяет размер файла
+func (p Policy) CheckSize(name string, size int64, categoryMax *int64) *Error {
+	limit := p.LimitFor(categoryMax)
+	if size > limit {
+		return &Error{Code: CodeTooLarge, Message: fmt.Sprintf("file is larger than %d bytes", limit), FileName: name, Size: size, MaxSize: limit}
+	}
+	return nil
+}
+
+// CheckType определяет тип файла по первым байтам head, сверяет его с расширением
+// и списками и возвращает тип для хранения
+func (p Policy) CheckType(name string, head []byte) (string, *Error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	sniffed := Sniff(head)
+
+	if !compatible(ext, sniffed) {
+		return "", &Error{
+			Code:              CodeExtensionMismatch,
+			Message:           fmt.Sprintf("file extension %s does not match its content (%s)", ext, sniffed),
+			FileName:          name,
+			DeclaredExtension: ext,
+			DetectedType:      sniffed,
+			ExpectedTypes:     extensionTypes[ext],
+		}
+	}
+
+	contentType := ContentType(ext, sniffed)
+	notAllowed := &Error{
+		Code:              CodeTypeNotAllowed,
+		Message:           fmt.Sprintf("files of type %s are not allowed", contentType),
+		FileName:          name,
+		DeclaredExtension: ext,
+		DetectedType:      contentType,
+	}
+	if matchesAny(p.Denied, ext, sniffed, contentType) {
+		return "", notAllowed
+	}
+	if len(p.Allowed) > 0 && !matchesAny(p.Allowed, ext, sniffed, contentType) {
+		return "", notAllowed
+	}
+	return contentType, nil
+}
+
+// matchesAny сообщает, подходит ли файл под один из элементов списка
+func matchesAny(list []string, ext string, types ...string) bool {
+	for _, item := range list {
+		if strings.HasPrefix(item, ".") {
+			if item == ext {
+				return true
+			}
+			continue
+		}
+		for _, t := range types {
+			if ok, _ := path.Match(item, t); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxNameLength - ограничение длины имени файла в байтах
+const maxNameLength = 255
+
+// windowsReserved - имена устройств, которые нельзя использовать как имена файлов в Windows
+var windowsReserved = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// SanitizeFileName приводит присланное клиентом имя файла к безопасному виду:
+// без каталогов, управляющих и зарезервированных символов, не длиннее 255 байт
+// с сохранением расширения
+func SanitizeFileName(name string) string {
+	// Браузеры на Windows могут прислать полный путь
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, "")
+
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			// Управляющие символы и невидимые символы форматирования (в т.ч. смена направления текста)
+		case strings.ContainsRune(`<>:"|?*`, r):
+			sb.WriteRune('_')
+		case unicode.IsSpace(r):
+			sb.WriteRune(' ')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	name = strings.Trim(strings.Join(strings.Fields(sb.String()), " "), ". ")
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base = "file"
+	}
+	if windowsReserved[strings.ToLower(base)] {
+		base = "_" + base
+	}
+	if len(ext) > maxNameLength/2 {
+		ext = ""
+	}
+	for len(base)+len(ext) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return base + ext
+}
@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// signature - сигнатура формата, которую не распознает http.DetectContentType
+type signature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{0, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, "application/x-ole-storage"},
+	{0, []byte(`{\rtf`), "application/rtf"},
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("\x7FELF"), "application/x-executable"},
+	{0, []byte{0xCF, 0xFA, 0xED, 0xFE}, "application/x-mach-binary"},
+	{0, []byte{0xFE, 0xED, 0xFA, 0xCF}, "application/x-mach-binary"},
+	{0, []byte("#!"), "text/x-shellscript"},
+}
+
+// Sniff определяет MIME-тип по первым байтам файла (до 512), без параметров вроде charset
+func Sniff(head []byte) string {
+	if isPE(head) {
+		return "application/x-msdownload"
+	}
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.contentType
+		}
+	}
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+// isPE распознает исполняемые файлы Windows: заголовок MZ и ссылка на сигнатуру PE
+func isPE(head []byte) bool {
+	if len(head) < 0x40 || !bytes.HasPrefix(head, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(head[0x3C:]))
+	// Сигнатура PE может лежать за пределами прочитанного начала файла
+	return offset+4 > len(head) || bytes.Equal(head[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// extensionTypes - какие определенные по содержимому типы допустимы для расширения.
+// Форматы Office Open XML и OpenDocument - это ZIP-архивы, старые форматы Office - OLE.
+var extensionTypes = map[string][]string{
+	".pdf":  {"application/pdf"},
+	".doc":  {"application/x-ole-storage"},
+	".xls":  {"application/x-ole-storage"},
+	".ppt":  {"application/x-ole-storage"},
+	".msg":  {"application/x-ole-storage"},
+	".docx": {"application/zip"},
+	".xlsx": {"application/zip"},
+	".pptx": {"application/zip"},
+	".odt":  {"application/zip"},
+	".ods":  {"application/zip"},
+	".odp":  {"application/zip"},
+	".zip":  {"application/zip"},
+	".rtf":  {"application/rtf"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/plain"},
+	".md":   {"text/plain"},
+	".log":  {"text/plain"},
+	".json": {"text/plain", "application/json"},
+	".xml":  {"text/xml", "text/plain"},
+	".html": {"text/html"},
+	".htm":  {"text/html"},
+	".png":  {"image/png"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".tif":  {"image/tiff"},
+	".tiff": {"image/tiff"},
+	".gz":   {"application/x-gzip"},
+	".rar":  {"application/x-rar-compressed"},
+	".7z":   {"application/x-7z-compressed"},
+	".mp3":  {"audio/mpeg"},
+	".mp4":  {"video/mp4"},
+	".wav":  {"audio/wave"},
+}
+
+// contentTypes - тип для ответа при скачивании, если расширение уточняет формат контейнера
+var contentTypes = map[string]string{
+	".doc":  "application/msword",
+	".xls":  "application/vnd.ms-excel",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".msg":  "application/vnd.ms-outlook",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".csv":  "text/csv",
+	".md":   "text/markdown",
+	".json": "application/json",
+}
+
+// ContentType возвращает тип файла для хранения и скачивания: уточненный по расширению,
+// если содержимое ему соответствует, иначе определенный по содержимому
+func ContentType(ext, sniffed string) string {
+	ext = strings.ToLower(ext)
+	if t, ok := contentTypes[ext]; ok && compatible(ext, sniffed) {
+		return t
+	}
+	return sniffed
+}
+
+// compatible сообщает, соответствует ли тип содержимого расширению.
+// Неизвестные расширения принимаются с любым содержимым.
+func compatible(ext, sniffed string) bool {
+	expected, ok := extensionTypes[strings.ToLower(ext)]
+	if !ok {
+		return true
+	}
+	for _, t := range expected {
+		if t == sniffed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package upload
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdfHead = []byte("%PDF-1.7\n")
+	zipHead = []byte("PK\x03\x04\x14\x00\x06\x00")
+	oleHead = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1, 0, 0}
+)
+
+func TestSniff(t *testing.T) {
+	pe := make([]byte, 0x90)
+	copy(pe, "MZ")
+	pe[0x3C] = 0x80
+	copy(pe[0x80:], "PE\x00\x00")
+
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{pngHead, "image/png"},
+		{pdfHead, "application/pdf"},
+		{zipHead, "application/zip"},
+		{oleHead, "application/x-ole-storage"},
+		{[]byte("Акт сверки"), "text/plain"},
+		{pe, "application/x-msdownload"},
+		{[]byte("MZ - просто текст"), "text/plain"},
+		{[]byte("#!/bin/sh\nrm -rf /"), "text/x-shellscript"},
+	}
+	for _, tt := range tests {
+		if got := Sniff(tt.head); got != tt.want {
+			t.Errorf("Sniff(%q) = %s, want %s", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	p := Policy{MaxSize: DefaultMaxSize, Denied: DefaultDenied}
+
+	if ct, err := p.CheckType("Договор.docx", zipHead); err != nil || ct != contentTypes[".docx"] {
+		t.Errorf("docx: %q, %v", ct, err)
+	}
+	if ct, err := p.CheckType("scan.PDF", pdfHead); err != nil || ct != "application/pdf" {
+		t.Errorf("pdf: %q, %v", ct, err)
+	}
+	if ct, err := p.CheckType("data.bin", pngHead); err != nil || ct != "image/png" {
+		t.Errorf("unknown extension must be accepted with the sniffed type: %q, %v", ct, err)
+	}
+
+	_, err := p.CheckType("invoice.pdf", pngHead)
+	if err == nil || err.Code != CodeExtensionMismatch || err.DetectedType != "image/png" || err.DeclaredExtension != ".pdf" {
+		t.Errorf("mismatch: %+v", err)
+	}
+	if _, err := p.CheckType("run.sh", []byte("echo hi")); err == nil || err.Code != CodeTypeNotAllowed {
+		t.Errorf("denied extension: %+v", err)
+	}
+
+	images := Policy{MaxSize: DefaultMaxSize, Allowed: []string{"image/*", ".pdf"}}
+	if _, err := images.CheckType("photo.png", pngHead); err != nil {
+		t.Errorf("allowed pattern: %v", err)
+	}
+	if _, err := images.CheckType("scan.pdf", pdfHead); err != nil {
+		t.Errorf("allowed extension: %v", err)
+	}
+	if _, err := images.CheckType("table.xls", oleHead); err == nil || err.Code != CodeTypeNotAllowed {
+		t.Errorf("not in allowlist: %+v", err)
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	p := Policy{MaxSize: 100}
+	small, large := int64(10), int64(1000)
+
+	if err := p.CheckSize("a.txt", 100, nil); err != nil {
+		t.Errorf("size at the limit: %v", err)
+	}
+	if err := p.CheckSize("a.txt", 11, &small); err == nil || err.MaxSize != 10 {
+		t.Errorf("category limit: %+v", err)
+	}
+	// Категория не может поднять глобальный предел
+	var err error = p.CheckSize("a.txt", 101, &large)
+	var uerr *Error
+	if !errors.As(err, &uerr) || uerr.Code != CodeTooLarge || uerr.MaxSize != 100 {
+		t.Errorf("global limit: %+v", err)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		`C:\Users\ivanov\Договор №5.pdf`: "Договор №5.pdf",
+		"../../etc/passwd":               "passwd",
+		"report\u202Efdp.exe":            "reportfdp.exe",
+		"a<b>:c?.txt":                    "a_b__c_.txt",
+		"  spaced \t name .docx  ":       "spaced name .docx",
+		"CON.txt":                        "_CON.txt",
+		"...":                            "file",
+		"":                               "file",
+	}
+	for in, want := range tests {
+		if got := SanitizeFileName(in); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	long := SanitizeFileName(strings.Repeat("я", 200) + ".pdf")
+	if len(long) > maxNameLength || !strings.HasSuffix(long, ".pdf") {
+		t.Errorf("long name: %d bytes, %q", len(long), long[len(long)-8:])
+	}
+}
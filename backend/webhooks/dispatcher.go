@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxAttempts - после стольких неудачных попыток доставка помечается failed
+	maxAttempts = 8
+	// baseBackoff удваивается после каждой неудачной попытки
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// claimLease - на это время доставка резервируется за обработчиком
+	claimLease = time.Minute
+	batchSize  = 20
+)
+
+// Dispatcher в фоне отправляет доставки из webhook_deliveries
+type Dispatcher struct {
+	db       *sql.DB
+	client   *http.Client
+	interval time.Duration
+}
+
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: 5 * time.Second,
+	}
+}
+
+// Run обрабатывает очередь до закрытия stop
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.processBatch(); err != nil {
+				log.Printf("webhooks: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+type pendingDelivery struct {
+	id       int64
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+}
+
+func (d *Dispatcher) processBatch() error {
+	// Резервируем доставки, чтобы несколько экземпляров не отправили одно и то же
+	rows, err := d.db.Query(`
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+	FROM webhooks w
+	WHERE w.id = d.webhook_id AND d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = $2 AND next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.event, d.payload, d.attempts, w.url, w.secret, w.active`,
+		int(claimLease.Seconds()), StatusPending, batchSize)
+	if err != nil {
+		return err
+	}
+
+	var batch []pendingDelivery
+	var inactive []int64
+	for rows.Next() {
+		var (
+			p      pendingDelivery
+			active bool
+		)
+		if err := rows.Scan(&p.id, &p.event, &p.payload, &p.attempts, &p.url, &p.secret, &active); err != nil {
+			rows.Close()
+			return err
+		}
+		if !active {
+			inactive = append(inactive, p.id)
+			continue
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range inactive {
+		d.finish(id, StatusFailed, nil, "webhook is disabled")
+	}
+	for _, p := range batch {
+		d.deliver(p)
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(p pendingDelivery) {
+	statusCode, err := d.send(p)
+	attempts := p.attempts + 1
+
+	if err == nil {
+		d.finish(p.id, StatusSucceeded, &statusCode, "")
+		return
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	if attempts >= maxAttempts {
+		d.finish(p.id, StatusFailed, code, err.Error())
+		return
+	}
+
+	_, dbErr := d.db.Exec(`
+	UPDATE webhook_deliveries
+	SET attempts = $1, last_status_code = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 second'
+	WHERE id = $5`, attempts, code, err.Error(), int(Backoff(attempts).Seconds()), p.id)
+	if dbErr != nil {
+		log.Printf("webhooks: failed to reschedule delivery %d: %v", p.id, dbErr)
+	}
+}
+
+func (d *Dispatcher) finish(id int64, status string, code *int, lastError string) {
+	_, err := d.db.Exec(`
+	UPDATE webhook_deliveries
+	SET status = $1, attempts = attempts + 1, last_status_code = $2, last_error = $3, next_attempt_at = NULL,
+		delivered_at = CASE WHEN $1 = 'succeeded' THEN NOW() ELSE NULL END
+	WHERE id = $4`, status, code, lastError, id)
+	if err != nil {
+		log.Printf("webhooks: failed to update delivery %d: %v", id, err)
+	}
+}
+
+// send отправляет подписанный запрос; успехом считается любой ответ 2xx
+func (d *Dispatcher) send(p pendingDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(p.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DocFlow-Webhooks/1.0")
+	req.Header.Set("X-DocFlow-Event", p.event)
+	req.Header.Set("X-DocFlow-Delivery", strconv.FormatInt(p.id, 10))
+	req.Header.Set("X-DocFlow-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-DocFlow-Signature", Sign(p.secret, timestamp, p.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff возвращает задержку перед следующей попыткой после attempts неудач
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
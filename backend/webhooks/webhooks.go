@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"backend/events"
+
+	"github.com/lib/pq"
+)
+
+// Статусы доставки
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ValidPattern проверяет шаблон подписки: точное имя события, "group.*" или "*"
+func ValidPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, eventType := range events.Types {
+		if events.Matches(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope - тело запроса, отправляемого подписчику
+type envelope struct {
+	ID         int64           `json:"id"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// HandleEvent - подписчик шины событий, ставящий доставки в очередь
+func HandleEvent(db *sql.DB) events.Handler {
+	return func(e events.Event) error {
+		return Enqueue(db, e)
+	}
+}
+
+// Enqueue ставит событие в очередь доставки всем активным подпискам на него.
+// Повторный вызов для того же события не создает дубликатов.
+func Enqueue(db *sql.DB, e events.Event) error {
+	payload, err := json.Marshal(envelope{ID: e.ID, Event: e.Type, OccurredAt: e.OccurredAt.UTC(), Data: e.Data})
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT id, events FROM webhooks WHERE active")
+	if err != nil {
+		return err
+	}
+	var targets []int
+	for rows.Next() {
+		var (
+			id       int
+			patterns []string
+		)
+		if err := rows.Scan(&id, pq.Array(&patterns)); err != nil {
+			rows.Close()
+			return err
+		}
+		for _, p := range patterns {
+			if events.Matches(p, e.Type) {
+				targets = append(targets, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range targets {
+		_, err := db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (webhook_id, event_id) WHERE event_id IS NOT NULL DO NOTHING`,
+			id, e.ID, e.Type, string(payload), StatusPending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowQueryer - *sql.DB или *sql.Tx
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Redeliver ставит копию доставки в очередь повторно
+func Redeliver(db rowQueryer, webhookID int, deliveryID int64) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+	INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at)
+	SELECT webhook_id, event, payload, $3, NOW() FROM webhook_deliveries
+	WHERE id = $1 AND webhook_id = $2
+	RETURNING id`, deliveryID, webhookID, StatusPending).Scan(&id)
+	return id, err
+}
+
+// Sign вычисляет подпись тела: HMAC-SHA256(secret, timestamp + "." + body)
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
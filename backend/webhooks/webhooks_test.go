@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidPattern(t *testing.T) {
+	for _, p := range []string{"*", "document.created", "category.*", "file.uploaded"} {
+		if !ValidPattern(p) {
+			t.Errorf("ValidPattern(%q) = false, want true", p)
+		}
+	}
+	for _, p := range []string{"folder.*", "doc.*", "document"} {
+		if ValidPattern(p) {
+			t.Errorf("ValidPattern(%q) = true, want false", p)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if got := Backoff(1); got != baseBackoff {
+		t.Errorf("Backoff(1) = %v, want %v", got, baseBackoff)
+	}
+	if got := Backoff(3); got != 4*baseBackoff {
+		t.Errorf("Backoff(3) = %v, want %v", got, 4*baseBackoff)
+	}
+	if got := Backoff(50); got != maxBackoff {
+		t.Errorf("Backoff(50) = %v, want %v", got, maxBackoff)
+	}
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	payload := []byte(`{"event":"document.created"}`)
+	var gotSignature, gotTimestamp string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-DocFlow-Signature")
+		gotTimestamp = r.Header.Get("X-DocFlow-Timestamp")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{client: &http.Client{Timeout: time.Second}}
+	code, err := d.send(pendingDelivery{id: 1, event: "document.created", payload: payload, url: srv.URL, secret: "s3cret"})
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("send() = %d, %v", code, err)
+	}
+
+	ts, _ := strconv.ParseInt(gotTimestamp, 10, 64)
+	if want := Sign("s3cret", ts, gotBody); gotSignature != want {
+		t.Errorf("signature = %q, want %q", gotSignature, want)
+	}
+}
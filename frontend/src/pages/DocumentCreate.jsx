@@ -15,13 +15,21 @@ export default function DocumentCreate() {
       formData.append('content', values.content);
       if (file) formData.append('file', file);
 
-      await axios.post(`${API_BASE_URL}/dock`, formData, {
+      const { data } = await axios.post(`${API_BASE_URL}/dock`, formData, {
         headers: { 'Content-Type': 'multipart/form-data' },
       });
 
+      // Сервер сообщает о документах, к которым уже прикреплен такой же файл
+      if (data.duplicates && data.duplicates.length > 0) {
+        const titles = data.duplicates.map((d) => `#${d.id} ${d.title}`).join('\n');
+        window.alert(`Такой файл уже прикреплен к документам:\n${titles}`);
+      }
+
       navigate('/');
     } catch (err) {
-      setError('Ошибка при создании документа: ' + err.message);
+      // Отказ в загрузке файла приходит JSON-объектом с полем message
+      const details = err.response && err.response.data && err.response.data.message;
+      setError('Ошибка при создании документа: ' + (details || err.message));
     }
   };
 
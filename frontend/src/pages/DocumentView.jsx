@@ -30,7 +30,7 @@ export default function DocumentView() {
       });
       
       // Получаем имя файла из пути
-      const fileName = documentData.file_path ? documentData.file_path.split('/').pop() : `document_${id}`;
+      const fileName = documentData.file_name || (documentData.file_path ? documentData.file_path.split('/').pop() : `document_${id}`);
       
       // Создаем ссылку для скачивания
       const url = window.URL.createObjectURL(new Blob([response.data]));
@@ -60,11 +60,13 @@ export default function DocumentView() {
 
       <div className="buttons">
         <Link to={`/documents/${id}/edit`} className="btn btn-warning">Редактировать</Link>
-        {documentData.file_path && (
+        {documentData.file_path && documentData.scan_status === 'clean' && (
           <button className="btn btn-success" onClick={handleDownload}>
             Скачать файл
           </button>
         )}
+        {documentData.scan_status === 'pending' && <span className="meta">Файл проверяется антивирусом</span>}
+        {documentData.scan_status === 'infected' && <span className="error">Файл заражен и помещен в карантин</span>}
         <Link to="/" className="btn">Назад к списку</Link>
       </div>
     </div>
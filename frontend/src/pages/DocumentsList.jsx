@@ -108,7 +108,7 @@ export default function DocumentsList() {
                 {doc.file_path && (
                   <button
                     className="btn btn-success btn-download"
-                    onClick={() => handleDownload(doc.id, doc.file_path)}
+                    onClick={() => handleDownload(doc.id, doc.file_name || doc.file_path)}
                     title="Скачать файл"
                   >
                     <DownloadIcon />